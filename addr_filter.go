@@ -0,0 +1,126 @@
+package ice
+
+import (
+	"fmt"
+	"net"
+	"path"
+
+	"gortc.io/ice/gather"
+)
+
+// AddrFilter is policy for host addresses that are used in gathering, so
+// addresses of container bridges, VPN tunnels or management networks can be
+// excluded from candidates.
+//
+// Address is used if it matches every non-empty allow list and none of the
+// deny lists. Interface names are matched by path.Match glob patterns, like
+// "docker*" or "br-*".
+type AddrFilter struct {
+	Interfaces        []string             // allowed interface name patterns
+	ExcludeInterfaces []string             // denied interface name patterns
+	Networks          []*net.IPNet         // allowed networks
+	ExcludeNetworks   []*net.IPNet         // denied networks
+	Types             []gather.NetworkType // allowed interface network types
+	ExcludeTypes      []gather.NetworkType // denied interface network types
+}
+
+// FilteredAddr is host address that was excluded by AddrFilter.
+type FilteredAddr struct {
+	Addr   gather.Addr
+	Reason string
+}
+
+func (f FilteredAddr) String() string {
+	return fmt.Sprintf("%s on %q: %s", f.Addr.IP, f.Addr.Interface, f.Reason)
+}
+
+// validate checks interface name patterns.
+func (f *AddrFilter) validate() error {
+	for _, patterns := range [][]string{f.Interfaces, f.ExcludeInterfaces} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func matchInterface(patterns []string, name string) (string, bool) {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+func matchNetwork(networks []*net.IPNet, ip net.IP) (*net.IPNet, bool) {
+	for _, n := range networks {
+		if n.Contains(ip) {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+func matchType(types []gather.NetworkType, t gather.NetworkType) bool {
+	for _, v := range types {
+		if v == t {
+			return true
+		}
+	}
+	return false
+}
+
+// reason returns why addr is excluded, or blank string if it is allowed.
+func (f *AddrFilter) reason(addr gather.Addr) string {
+	if len(f.Interfaces) > 0 {
+		if _, ok := matchInterface(f.Interfaces, addr.Interface); !ok {
+			return "interface is not allowed"
+		}
+	}
+	if pattern, ok := matchInterface(f.ExcludeInterfaces, addr.Interface); ok {
+		return fmt.Sprintf("interface matches %q", pattern)
+	}
+	if len(f.Networks) > 0 {
+		if _, ok := matchNetwork(f.Networks, addr.IP); !ok {
+			return "network is not allowed"
+		}
+	}
+	if n, ok := matchNetwork(f.ExcludeNetworks, addr.IP); ok {
+		return fmt.Sprintf("network %s is denied", n)
+	}
+	if len(f.Types) > 0 && !matchType(f.Types, addr.Network) {
+		return fmt.Sprintf("network type %s is not allowed", addr.Network)
+	}
+	if matchType(f.ExcludeTypes, addr.Network) {
+		return fmt.Sprintf("network type %s is denied", addr.Network)
+	}
+	return ""
+}
+
+// Filter splits addresses to allowed and filtered ones. Nil filter allows
+// all addresses.
+func (f *AddrFilter) Filter(addrs []gather.Addr) (allowed []gather.Addr, filtered []FilteredAddr) {
+	if f == nil {
+		return addrs, nil
+	}
+	allowed = make([]gather.Addr, 0, len(addrs))
+	for _, addr := range addrs {
+		if reason := f.reason(addr); reason != "" {
+			filtered = append(filtered, FilteredAddr{Addr: addr, Reason: reason})
+			continue
+		}
+		allowed = append(allowed, addr)
+	}
+	return allowed, filtered
+}
+
+// FilteredAddrs returns host addresses that were excluded by AddrFilter on
+// last gathering.
+func (a *Agent) FilteredAddrs() []FilteredAddr {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return append([]FilteredAddr(nil), a.filtered...)
+}
@@ -0,0 +1,143 @@
+package ice
+
+import (
+	"net"
+	"testing"
+
+	"gortc.io/ice/gather"
+	"gortc.io/ice/internal"
+)
+
+var filterTestAddrs = staticGatherer{
+	{IP: net.IPv4(10, 0, 0, 1), Interface: "eth0", Network: gather.NetworkWired},
+	{IP: net.IPv4(172, 17, 0, 1), Interface: "docker0", Network: gather.NetworkVirtual},
+	{IP: net.IPv4(10, 8, 0, 2), Interface: "tun0", Network: gather.NetworkVPN},
+	{IP: net.IPv4(192, 168, 100, 5), Interface: "eth1", Network: gather.NetworkWired},
+	{IP: net.IPv4(192, 168, 1, 10), Interface: "wlan0", Network: gather.NetworkWiFi},
+}
+
+func TestAddrFilter_Filter(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		filter  *AddrFilter
+		allowed []string
+	}{
+		{
+			name:    "Nil",
+			allowed: []string{"eth0", "docker0", "tun0", "eth1", "wlan0"},
+		},
+		{
+			name:    "Blank",
+			filter:  &AddrFilter{},
+			allowed: []string{"eth0", "docker0", "tun0", "eth1", "wlan0"},
+		},
+		{
+			name:    "Interfaces",
+			filter:  &AddrFilter{Interfaces: []string{"eth*"}},
+			allowed: []string{"eth0", "eth1"},
+		},
+		{
+			name:    "ExcludeInterfaces",
+			filter:  &AddrFilter{ExcludeInterfaces: []string{"docker*", "tun?"}},
+			allowed: []string{"eth0", "eth1", "wlan0"},
+		},
+		{
+			name: "Networks",
+			filter: &AddrFilter{Networks: []*net.IPNet{
+				internal.MustParseNet("192.168.0.0/16"),
+			}},
+			allowed: []string{"eth1", "wlan0"},
+		},
+		{
+			name: "ExcludeNetworks",
+			filter: &AddrFilter{ExcludeNetworks: []*net.IPNet{
+				internal.MustParseNet("192.168.100.0/24"),
+				internal.MustParseNet("172.16.0.0/12"),
+			}},
+			allowed: []string{"eth0", "tun0", "wlan0"},
+		},
+		{
+			name:    "Types",
+			filter:  &AddrFilter{Types: []gather.NetworkType{gather.NetworkWiFi, gather.NetworkVPN}},
+			allowed: []string{"tun0", "wlan0"},
+		},
+		{
+			name: "ExcludeTypes",
+			filter: &AddrFilter{ExcludeTypes: []gather.NetworkType{
+				gather.NetworkVirtual, gather.NetworkVPN,
+			}},
+			allowed: []string{"eth0", "eth1", "wlan0"},
+		},
+		{
+			name: "Combined",
+			filter: &AddrFilter{
+				ExcludeInterfaces: []string{"docker*"},
+				ExcludeNetworks:   []*net.IPNet{internal.MustParseNet("192.168.100.0/24")},
+				ExcludeTypes:      []gather.NetworkType{gather.NetworkVPN},
+			},
+			allowed: []string{"eth0", "wlan0"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			allowed, filtered := tc.filter.Filter(filterTestAddrs)
+			if len(allowed)+len(filtered) != len(filterTestAddrs) {
+				t.Fatalf("%d allowed and %d filtered", len(allowed), len(filtered))
+			}
+			if len(allowed) != len(tc.allowed) {
+				t.Fatalf("unexpected allowed addresses: %v", allowed)
+			}
+			for i, name := range tc.allowed {
+				if allowed[i].Interface != name {
+					t.Errorf("[%d] %s (got) != %s (expected)", i, allowed[i].Interface, name)
+				}
+			}
+			for _, f := range filtered {
+				if f.Reason == "" {
+					t.Errorf("no reason for %s", f.Addr)
+				}
+				t.Log(f)
+			}
+		})
+	}
+}
+
+func TestWithAddrFilter(t *testing.T) {
+	t.Run("BadPattern", func(t *testing.T) {
+		if _, err := NewAgent(WithAddrFilter(AddrFilter{Interfaces: []string{"eth["}})); err == nil {
+			t.Error("should fail")
+		}
+	})
+	t.Run("Gather", func(t *testing.T) {
+		l := &portListener{busy: make(map[int]bool)}
+		a, err := NewAgent(
+			withGatherer(systemCandidateGatherer{addr: filterTestAddrs, listen: l.listen}),
+			WithAddrFilter(AddrFilter{
+				ExcludeInterfaces: []string{"docker*"},
+				ExcludeTypes:      []gather.NetworkType{gather.NetworkVPN},
+			}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mustClose(t, a)
+		if err = a.GatherCandidates(); err != nil {
+			t.Fatal(err)
+		}
+		candidates, err := a.LocalCandidates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) != 3 {
+			t.Errorf("unexpected candidates: %v", candidates)
+		}
+		filtered := a.FilteredAddrs()
+		if len(filtered) != 2 {
+			t.Fatalf("unexpected filtered addresses: %v", filtered)
+		}
+		for i, name := range []string{"docker0", "tun0"} {
+			if filtered[i].Addr.Interface != name {
+				t.Errorf("[%d] %s (got) != %s (expected)", i, filtered[i].Addr.Interface, name)
+			}
+		}
+	})
+}
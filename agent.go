@@ -19,6 +19,8 @@ import (
 
 	ct "gortc.io/ice/candidate"
 	"gortc.io/ice/gather"
+	"gortc.io/ice/internal/pcapng"
+	"gortc.io/ice/mdns"
 )
 
 // Role represents ICE agent role, which can be controlling or controlled.
@@ -84,14 +86,32 @@ func NewAgent(opts ...AgentOption) (*Agent, error) {
 		ta:          defaultAgentTa,
 		maxAttempts: defaultMaxAttempts,
 	}
+	a.closing, a.cancel = context.WithCancel(context.Background())
 	for _, o := range opts {
 		if err := o(a); err != nil {
 			return nil, err
 		}
 	}
+	if a.nat != nil && a.nat.mode == NAT1To1Host && a.mdnsMode == MulticastDNSQueryAndGather {
+		return nil, errNATMulticastDNS
+	}
+	if a.candidatePolicy == CandidatePolicyRelay && len(a.turn) == 0 {
+		return nil, errCandidatePolicyNoTURN
+	}
+	if a.recorder != nil {
+		if a.rand == nil {
+			a.rand = rand.Reader
+		}
+		a.startRecording()
+	}
 	if err := a.init(); err != nil {
 		return nil, err
 	}
+	a.inc(CounterAgents)
+	if a.watcher != nil {
+		a.watching.Add(1)
+		go a.watch(a.watcher)
+	}
 	return a, nil
 }
 
@@ -116,15 +136,47 @@ type Agent struct {
 	role             Role
 	state            State
 	ipv4Only         bool
+	linkLocal        bool // use IPv6 link-local host addresses
 	rand             io.Reader
 	t                map[transactionID]*agentTransaction
 	tMux             sync.Mutex
+	streams          []*stream // by stream ID
 	localCandidates  [][]*localUDPCandidate
 	remoteCandidates [][]Candidate
 	gatherer         candidateGatherer
+	packetHandlers   map[PacketType]PacketHandler
+	portMin          int
+	portMax          int
+	ports            []int
+	nat              *natMapping // 1:1 NAT mapping, if set
+	filter           *AddrFilter
+	filtered         []FilteredAddr     // by last gathering
+	policy           gather.PolicyTable // RFC 6724, default if nil
+	candidatePolicy  CandidatePolicy
+	watcher          gather.Watcher
+	watching         sync.WaitGroup
+	onCandidate      CandidateHandler
+	stats            map[pairKey]*pairCounters
+	capture          *pcapng.Writer
+	recorder         *recorder
+	tracer           Tracer  // nil if not tracing
+	metrics          Metrics // nil if not collecting
+	timeline         Timeline
+	servers          []Server
+	errs             []string         // last errors for report
+	now              func() time.Time // time.Now if nil
+	statsMux         sync.Mutex
 	log              *zap.Logger
 	mux              sync.Mutex
 
+	mdnsMode  MulticastDNSMode
+	mdns      multicastDNSConn
+	resolver  Resolver
+	resolving sync.WaitGroup  // remote candidates
+	published map[string]int  // mDNS name to count of local candidates
+	closing   context.Context // done on Close
+	cancel    context.CancelFunc
+
 	localUsername  string
 	localPassword  string
 	remoteUsername string
@@ -140,8 +192,11 @@ type Agent struct {
 
 // SetLocalCredentials sets local username fragment and password.
 func (a *Agent) SetLocalCredentials(username, password string) {
+	a.mux.Lock()
 	a.localUsername = username
 	a.localPassword = password
+	a.mux.Unlock()
+	a.record(RecordEvent{Type: RecordLocalCredentials, Username: username, Password: password})
 }
 
 // Username returns local username fragment.
@@ -150,10 +205,12 @@ func (a *Agent) Username() string { return a.localUsername }
 // Password returns local password.
 func (a *Agent) Password() string { return a.localPassword }
 
-// SetRemoteCredentials sets ufrag and password for remote candidate.
+// SetRemoteCredentials sets session-level ufrag and password for remote
+// candidates, see SetRemoteCredentialsForMid for media-level ones.
 func (a *Agent) SetRemoteCredentials(username, password string) {
 	a.remoteUsername = username
 	a.remotePassword = password
+	a.record(RecordEvent{Type: RecordRemoteCredentials, Username: username, Password: password})
 }
 
 // tick of ta.
@@ -200,14 +257,21 @@ func (a *Agent) tick(t time.Time, metChecklists map[int]bool) error {
 
 // Conclude starts connectivity checks and returns when ICE is fully concluded.
 func (a *Agent) Conclude(ctx context.Context) error {
+	err := a.conclude(ctx)
+	if err != nil {
+		a.reportError(err)
+	}
+	return err
+}
+
+func (a *Agent) conclude(ctx context.Context) error {
 	// TODO: Start async job.
 	ticker := time.NewTicker(a.ta)
 	defer ticker.Stop()
 	for {
 		select {
 		case t := <-ticker.C:
-			a.collect(t)
-			if err := a.tick(t, make(map[int]bool)); err != nil {
+			if err := a.tickStep(t); err != nil {
 				return err
 			}
 			a.mux.Lock()
@@ -226,12 +290,16 @@ func (a *Agent) Conclude(ctx context.Context) error {
 	}
 }
 
-func (a *Agent) localCandidateByAddr(addr Addr) (candidate *localUDPCandidate, ok bool) {
-	for _, cs := range a.localCandidates {
-		for i := range cs {
-			if addr.Equal(cs[i].candidate.Addr) {
-				return cs[i], true
-			}
+// localCandidate returns local candidate of data stream with provided
+// address. Streams can share sockets, e.g. of UDPMux, so candidate is looked
+// up only in candidates of the stream. Should be called with a.mux held.
+func (a *Agent) localCandidate(streamID int, addr Addr) (candidate *localUDPCandidate, ok bool) {
+	if streamID < 0 || streamID >= len(a.localCandidates) {
+		return nil, false
+	}
+	for _, c := range a.localCandidates[streamID] {
+		if addr.Equal(c.candidate.Addr) {
+			return c, true
 		}
 	}
 	return nil, false
@@ -239,10 +307,27 @@ func (a *Agent) localCandidateByAddr(addr Addr) (candidate *localUDPCandidate, o
 
 // Close immediately stops all transactions and frees underlying resources.
 func (a *Agent) Close() error {
-	for _, streamCandidates := range a.localCandidates {
-		for i := range streamCandidates {
-			_ = streamCandidates[i].conn.Close()
+	a.stopRecording()
+	if a.cancel != nil {
+		a.cancel()
+	}
+	a.resolving.Wait()
+	if a.watcher != nil {
+		if err := a.watcher.Close(); err != nil {
+			a.log.Debug("failed to close watcher", zap.Error(err))
 		}
+		a.watching.Wait()
+	}
+	a.mux.Lock()
+	var candidates []*localUDPCandidate
+	for _, streamCandidates := range a.localCandidates {
+		candidates = append(candidates, streamCandidates...)
+		a.unpublishHostCandidates(streamCandidates)
+	}
+	a.mux.Unlock()
+	a.closeCandidates(candidates)
+	if a.mdns != nil {
+		return a.mdns.Close()
 	}
 	return nil
 }
@@ -265,12 +350,17 @@ var errNoStreamFound = errors.New("data stream with provided id not found")
 
 // LocalCandidatesForStream returns list of local candidates for stream.
 func (a *Agent) LocalCandidatesForStream(streamID int) ([]Candidate, error) {
-	if len(a.localCandidates) <= streamID {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if streamID < 0 || len(a.streams) <= streamID || !a.streams[streamID].gathered {
 		return nil, errNoStreamFound
 	}
+	if a.streams[streamID].removed {
+		return nil, errStreamRemoved
+	}
 	var localCandidates []Candidate
-	for i := range a.localCandidates[streamID] {
-		localCandidates = append(localCandidates, a.localCandidates[streamID][i].candidate)
+	for _, c := range a.allowedCandidates(a.localCandidates[streamID]) {
+		localCandidates = append(localCandidates, a.hideHostAddr(c))
 	}
 	return localCandidates, nil
 }
@@ -283,36 +373,156 @@ func (a *Agent) AddRemoteCandidates(c []Candidate) error {
 
 // AddRemoteCandidatesForStream adds remote candidate list, associating
 // them with data stream with provided id.
+//
+// Candidates with host names are resolved asynchronously, using mDNS for
+// ".local" names if enabled (ignoring them otherwise) and Resolver for
+// other names.
 func (a *Agent) AddRemoteCandidatesForStream(streamID int, c []Candidate) error {
-	if len(a.remoteCandidates) > streamID {
+	remoteCandidates, unresolved := a.splitRemoteCandidates(c)
+	a.mux.Lock()
+	s, err := a.streamAt(streamID)
+	if err != nil {
+		a.mux.Unlock()
+		return err
+	}
+	if s.removed {
+		a.mux.Unlock()
+		return errStreamRemoved
+	}
+	if s.remote {
+		a.mux.Unlock()
 		return errStreamAlreadyExist
 	}
-	a.remoteCandidates = append(a.remoteCandidates, c)
+	s.remote = true
+	a.remoteCandidates[streamID] = remoteCandidates
+	a.mux.Unlock()
+	a.record(RecordEvent{Type: RecordRemoteCandidates, Stream: streamID, Candidates: remoteCandidates})
+	a.resolveRemoteCandidates(streamID, unresolved)
+	return nil
+}
+
+// trickleRemoteCandidates adds remote candidates to data stream that can
+// already have remote candidates, pairing them with local candidates if
+// checklist is prepared. Candidates with host name are added after they are
+// resolved.
+func (a *Agent) trickleRemoteCandidates(streamID int, c []Candidate) error {
+	remoteCandidates, unresolved := a.splitRemoteCandidates(c)
+	e := RecordEvent{Type: RecordTrickledCandidates, Stream: streamID, Candidates: remoteCandidates}
+	err := a.step(e, func() error {
+		return a.addRemoteCandidates(streamID, remoteCandidates)
+	})
+	if err != nil {
+		return err
+	}
+	a.resolveRemoteCandidates(streamID, unresolved)
+	return nil
+}
+
+func (a *Agent) addRemoteCandidates(streamID int, remoteCandidates []Candidate) error {
+	a.mux.Lock()
+	s, err := a.streamAt(streamID)
+	if err != nil {
+		a.mux.Unlock()
+		return err
+	}
+	if s.removed {
+		a.mux.Unlock()
+		return errStreamRemoved
+	}
+	s.remote = true
+	a.appendRemoteCandidates(streamID, remoteCandidates)
+	a.mux.Unlock()
 	return nil
 }
 
+// appendRemoteCandidates adds remote candidates to data stream, pairing
+// them with local candidates if checklist is prepared. Should be called
+// with a.mux held.
+func (a *Agent) appendRemoteCandidates(streamID int, c []Candidate) {
+	a.remoteCandidates[streamID] = append(a.remoteCandidates[streamID], c...)
+	if streamID < len(a.set) {
+		a.addPairs(streamID, a.allowedCandidates(a.localCandidates[streamID]), c)
+	}
+}
+
+// splitRemoteCandidates splits remote candidates to ones with IP address and
+// ones with host name that should be resolved, ignoring unresolvable ones.
+func (a *Agent) splitRemoteCandidates(c []Candidate) (remoteCandidates, unresolved []Candidate) {
+	remoteCandidates = make([]Candidate, 0, len(c))
+	for i := range c {
+		if len(c[i].Addr.IP) > 0 {
+			remoteCandidates = append(remoteCandidates, c[i])
+			continue
+		}
+		if c[i].Addr.Host == "" || (a.mdns == nil && isMulticastDNSName(c[i].Addr.Host)) {
+			a.log.Debug("ignoring unresolvable remote candidate", zap.Stringer("addr", c[i].Addr))
+			continue
+		}
+		unresolved = append(unresolved, c[i])
+	}
+	return remoteCandidates, unresolved
+}
+
+func (a *Agent) resolveRemoteCandidates(streamID int, unresolved []Candidate) {
+	for i := range unresolved {
+		a.resolving.Add(1)
+		go a.resolveRemoteCandidate(streamID, unresolved[i])
+	}
+}
+
 var errStreamCountMismatch = errors.New("remote and local stream count mismatch")
 
 // PrepareChecklistSet initializes checklists for each data stream, generating
 // candidate pairs for each local and remote candidates.
+//
+// If checklist set is already prepared, checklists are initialized only for
+// data streams that were added after that, so it can be called while agent
+// is running.
+//
+// Blocks until all remote candidates are resolved.
 func (a *Agent) PrepareChecklistSet() error {
-	if len(a.remoteCandidates) != len(a.localCandidates) {
-		return errStreamCountMismatch
-	}
-	for streamID := 0; streamID < len(a.localCandidates); streamID++ {
-		var localCandidates []Candidate
-		for i := range a.localCandidates[streamID] {
-			localCandidates = append(localCandidates, a.localCandidates[streamID][i].candidate)
+	a.resolving.Wait()
+	return a.step(RecordEvent{Type: RecordPrepare}, a.prepareChecklistSet)
+}
+
+func (a *Agent) prepareChecklistSet() error {
+	a.mux.Lock()
+	prepared := len(a.set)
+	for streamID := prepared; streamID < len(a.streams); streamID++ {
+		s := a.streams[streamID]
+		if !s.removed && (!s.gathered || !s.remote) {
+			a.mux.Unlock()
+			return errStreamCountMismatch
 		}
-		pairs := NewPairs(localCandidates, a.remoteCandidates[streamID])
-		list := Checklist{Pairs: pairs}
-		list.ComputePriorities(a.role)
-		list.Sort()
-		list.Prune()
-		list.Limit(a.maxChecks)
-		a.set = append(a.set, list)
 	}
-	return a.init()
+	for streamID := prepared; streamID < len(a.streams); streamID++ {
+		a.set = append(a.set, a.newChecklist(streamID))
+	}
+	markOnce(&a.timeline.ChecklistPrepared, a.clock())
+	a.mux.Unlock()
+	if prepared == 0 {
+		return a.init()
+	}
+	a.mux.Lock()
+	a.unfreeze(prepared)
+	a.mux.Unlock()
+	return nil
+}
+
+// newChecklist returns checklist for data stream. Should be called with
+// a.mux held.
+func (a *Agent) newChecklist(streamID int) Checklist {
+	if a.streams[streamID].removed {
+		return Checklist{State: ChecklistFailed}
+	}
+	localCandidates := a.allowedCandidates(a.localCandidates[streamID])
+	pairs := NewPairs(localCandidates, a.remoteCandidates[streamID])
+	list := Checklist{Pairs: pairs}
+	list.ComputePriorities(a.role)
+	list.SortPolicy(a.policy)
+	list.Prune()
+	list.Limit(a.maxChecks)
+	return list
 }
 
 const minRTO = time.Millisecond * 500
@@ -346,10 +556,19 @@ func (a *Agent) updateState() {
 		state        = Running
 		allCompleted = true
 		allFailed    = true
+		active       int
 	)
 	for streamID, c := range a.set {
+		if a.streamRemoved(streamID) {
+			// Checklists of removed streams are ignored.
+			continue
+		}
+		active++
 		if a.concluded(streamID) {
 			a.log.Debug("checklist concluded", zap.Int("stream", streamID))
+			if c.State != ChecklistCompleted {
+				a.observeSelected(streamID, a.clock())
+			}
 			c.State = ChecklistCompleted
 			a.set[streamID] = c
 		}
@@ -363,8 +582,12 @@ func (a *Agent) updateState() {
 			allCompleted = false
 		}
 	}
-	if allCompleted {
+	if active == 0 && len(a.set) > 0 {
+		// All data streams are removed, nothing can be concluded.
+		state = Failed
+	} else if allCompleted {
 		state = Completed
+		markOnce(&a.timeline.Completed, a.clock())
 	} else if allFailed {
 		state = Failed
 	}
@@ -384,7 +607,7 @@ func (a *Agent) addPeerReflexive(t *agentTransaction, p *Pair, addr Addr) error
 	pr.Foundation = Foundation(&pr, Addr{})
 	a.mux.Lock()
 	defer a.mux.Unlock()
-	c, ok := a.localCandidateByAddr(p.Local.Addr)
+	c, ok := a.localCandidate(t.checklist, p.Local.Addr)
 	if !ok {
 		return errCandidateNotFound
 	}
@@ -402,6 +625,7 @@ func (a *Agent) setPairState(checklist, pair int, state PairState) {
 	p.State = state
 	c.Pairs[pair] = p
 	a.set[checklist] = c
+	a.tracePair(TracePairState, checklist, &p)
 }
 
 func (a *Agent) setPairStateByKey(checklist int, k pairKey, state PairState) {
@@ -409,6 +633,7 @@ func (a *Agent) setPairStateByKey(checklist int, k pairKey, state PairState) {
 	for i := range c.Pairs {
 		if k.Equal(&c.Pairs[i]) {
 			c.Pairs[i].State = state
+			a.tracePair(TracePairState, checklist, &c.Pairs[i])
 			break
 		}
 	}
@@ -486,7 +711,8 @@ func (a *Agent) getPair(streamID int, k pairKey) (*Pair, bool) {
 	return nil, false
 }
 
-func (a *Agent) processUDP(buf []byte, c *localUDPCandidate, addr *net.UDPAddr) error {
+// processUDP handles packet that is received on candidate socket at now.
+func (a *Agent) processUDP(buf []byte, c *localUDPCandidate, addr *net.UDPAddr, now time.Time) error {
 	a.log.Debug("got udp packet",
 		zap.Stringer("local", c.candidate.Addr),
 		zap.Stringer("from", addr),
@@ -499,13 +725,17 @@ func (a *Agent) processUDP(buf []byte, c *localUDPCandidate, addr *net.UDPAddr)
 		return err
 	}
 	a.log.Debug("got message", zap.Stringer("m", m))
-	raddr := Addr{Port: addr.Port, IP: addr.IP, Proto: ct.UDP}
+	raddr := Addr{Port: addr.Port, IP: addr.IP, Zone: addr.Zone, Proto: ct.UDP}
 	if m.Type == stun.BindingRequest {
 		return a.handleBindingRequest(m, c, raddr)
 	}
 
 	a.tMux.Lock()
 	t, ok := a.t[m.TransactionID]
+	if ok {
+		// Transaction is completed by response, so it is not retried.
+		delete(a.t, m.TransactionID)
+	}
 	a.tMux.Unlock()
 
 	if !ok {
@@ -520,7 +750,7 @@ func (a *Agent) processUDP(buf []byte, c *localUDPCandidate, addr *net.UDPAddr)
 
 	switch m.Type {
 	case stun.BindingSuccess, stun.BindingError:
-		return a.handleBindingResponse(t, p, m, raddr)
+		return a.handleBindingResponse(t, p, m, raddr, now)
 	default:
 		a.log.Debug("unknown message type", zap.Stringer("t", m.Type))
 	}
@@ -590,20 +820,35 @@ func (a *Agent) shouldNominate(streamID int) bool {
 	return true
 }
 
+// startNomination nominates valid pair with least smoothed round trip
+// time, preferring pairs with measured round trip time and then order of
+// valid list.
 func (a *Agent) startNomination(streamID int) error {
 	s := a.set[streamID]
+	var (
+		best     = -1
+		bestRTT  time.Duration
+		measured bool
+	)
 	for i := range s.Valid {
 		if s.Valid[i].Nominated {
 			continue
 		}
-		pair := s.Valid[i]
-		pair.Nominated = true
-		s.Triggered = append(s.Triggered, pair)
-		a.set[streamID] = s
-		a.log.Debug("starting nomination")
-		return nil
+		rtt, ok := a.smoothedRTT(&s.Valid[i])
+		switch {
+		case best < 0, ok && !measured, ok && rtt < bestRTT:
+			best, bestRTT, measured = i, rtt, ok
+		}
+	}
+	if best < 0 {
+		return errNoPair
 	}
-	return errNoPair
+	pair := s.Valid[best]
+	pair.Nominated = true
+	s.Triggered = append(s.Triggered, pair)
+	a.set[streamID] = s
+	a.log.Debug("starting nomination")
+	return nil
 }
 
 // startCheck initializes connectivity check for pair.
@@ -620,7 +865,11 @@ func (a *Agent) startCheck(p *Pair, t time.Time) error {
 	// the pair to the remote candidate of the pair, as described in
 	// Section 7.2.4.
 	// See RFC 8445 Section 7.2.2. Forming Credentials.
-	integrity := stun.NewShortTermIntegrity(a.remotePassword)
+	a.mux.Lock()
+	checklist := a.checklist
+	remoteUsername, remotePassword := a.remoteCredentials(checklist)
+	a.mux.Unlock()
+	integrity := stun.NewShortTermIntegrity(remotePassword)
 	// The PRIORITY attribute MUST be included in a Binding request and be
 	// set to the value computed by the algorithm in Section 5.1.2 for the
 	// local candidate, but with the candidate type preference of peer-
@@ -628,9 +877,15 @@ func (a *Agent) startCheck(p *Pair, t time.Time) error {
 	localPref := p.Local.LocalPreference
 	priority := Priority(TypePreference(ct.PeerReflexive), localPref, p.Local.ComponentID)
 	role := AttrControl{Role: a.role, Tiebreaker: a.tiebreaker}
-	username := stun.NewUsername(a.remoteUsername + ":" + a.localUsername)
+	username := stun.NewUsername(remoteUsername + ":" + a.localUsername)
+	// Transaction ID is read from agent random source, so it is reproduced
+	// by replay.
+	var id transactionID
+	if _, err := io.ReadFull(a.rand, id[:]); err != nil {
+		return err
+	}
 	attrs := []stun.Setter{
-		stun.TransactionID, stun.BindingRequest,
+		id, stun.BindingRequest,
 		&username, PriorityAttr(priority), &role,
 	}
 	if p.Nominated {
@@ -638,7 +893,7 @@ func (a *Agent) startCheck(p *Pair, t time.Time) error {
 	}
 	attrs = append(attrs, &integrity, stun.Fingerprint)
 	m := stun.MustBuild(attrs...)
-	return a.startBinding(p, m, priority, t)
+	return a.startBinding(checklist, p, m, priority, t)
 }
 
 func randUint64(r io.Reader) (uint64, error) {
@@ -690,6 +945,16 @@ func (a *Agent) init() error {
 	if a.rand == nil {
 		a.rand = rand.Reader
 	}
+	if a.resolver == nil {
+		a.resolver = net.DefaultResolver
+	}
+	if a.mdnsMode != MulticastDNSDisabled && a.mdns == nil {
+		conn, err := mdns.Listen(a.log.Named("mdns"))
+		if err != nil {
+			return err
+		}
+		a.mdns = conn
+	}
 	// Generating random tiebreaker number.
 	tbValue, err := randUint64(a.rand)
 	if err != nil {
@@ -697,18 +962,31 @@ func (a *Agent) init() error {
 	}
 	a.tiebreaker = tbValue
 	a.foundations = a.foundations[:0]
+	a.unfreeze(0)
+	a.checklist = noChecklist
+	return nil
+}
+
+// unfreeze sets initial pair states for checklists starting from provided
+// index, collecting their foundations.
+func (a *Agent) unfreeze(from int) {
 	// Gathering all unique foundations.
 	foundations := make(foundationSet)
-	for _, c := range a.set {
+	for _, f := range a.foundations {
+		foundations.Add(f)
+	}
+	var added [][]byte
+	for _, c := range a.set[from:] {
 		for i := range c.Pairs {
 			pair := c.Pairs[i]
 			if foundations.Contains(pair.Foundation) {
 				continue
 			}
 			foundations.Add(pair.Foundation)
-			a.foundations = append(a.foundations, pair.Foundation)
+			added = append(added, pair.Foundation)
 		}
 	}
+	a.foundations = append(a.foundations, added...)
 	// For each foundation, the agent sets the state of exactly one
 	// candidate pair to the Waiting state (unfreezing it).  The
 	// candidate pair to unfreeze is chosen by finding the first
@@ -716,17 +994,16 @@ func (a *Agent) init() error {
 	// highest priority if component IDs are equal) in the first
 	// checklist (according to the usage-defined checklist set order)
 	// that has that foundation.
-	for _, f := range a.foundations {
-		for _, c := range a.set {
-			for i := range c.Pairs {
-				if !bytes.Equal(c.Pairs[i].Foundation, f) {
+	for _, f := range added {
+		for checklist := from; checklist < len(a.set); checklist++ {
+			pairs := a.set[checklist].Pairs
+			for i := range pairs {
+				if !bytes.Equal(pairs[i].Foundation, f) {
 					continue
 				}
-				c.Pairs[i].State = PairWaiting
+				a.setPairState(checklist, i, PairWaiting)
 				break
 			}
 		}
 	}
-	a.checklist = noChecklist
-	return nil
 }
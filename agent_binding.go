@@ -25,12 +25,23 @@ func (a *Agent) handleBindingRequest(m *stun.Message, c *localUDPCandidate, radd
 	if err := integrity.Check(m); err != nil {
 		return err
 	}
+	k := newPairKey(c.candidate.Addr, raddr)
+	a.count(k, func(s *pairCounters) { s.requestsReceived++ })
+	a.mux.Lock()
 	remoteCandidate, ok := a.remoteCandidateByAddr(raddr)
+	localCandidate, allowed := a.pairedCandidate(c)
+	a.mux.Unlock()
 	if !ok {
 		return errCandidateNotFound
 	}
+	if !allowed {
+		a.log.Debug("local candidate is not allowed by candidate policy",
+			zap.Stringer("local", c.candidate.Addr),
+		)
+		return nil
+	}
 	pair := Pair{
-		Local:  c.candidate,
+		Local:  localCandidate,
 		Remote: remoteCandidate,
 	}
 	pair.SetFoundation()
@@ -38,6 +49,10 @@ func (a *Agent) handleBindingRequest(m *stun.Message, c *localUDPCandidate, radd
 
 	a.mux.Lock()
 	defer a.mux.Unlock()
+	if c.stream >= len(a.set) {
+		// Checklist for stream is not prepared yet.
+		return errNoChecklist
+	}
 	list := a.set[c.stream]
 
 	for i := range list.Pairs {
@@ -49,6 +64,11 @@ func (a *Agent) handleBindingRequest(m *stun.Message, c *localUDPCandidate, radd
 		}
 		state := list.Pairs[i].State
 		a.log.Debug("found", zap.Stringer("state", state))
+		if UseCandidate.IsSet(m) {
+			markOnce(&a.timeline.Nomination, a.clock())
+			a.tracePair(TraceNomination, c.stream, &list.Pairs[i])
+			c.nominate(raddr)
+		}
 		pair.State = PairWaiting
 		list.Triggered = append(list.Triggered, list.Pairs[i])
 		a.set[c.stream] = list
@@ -68,8 +88,10 @@ func (a *Agent) handleBindingRequest(m *stun.Message, c *localUDPCandidate, radd
 		_, err := c.conn.WriteTo(res.Raw, &net.UDPAddr{
 			Port: raddr.Port,
 			IP:   raddr.IP,
+			Zone: raddr.Zone,
 		})
 		if err == nil {
+			a.count(k, func(s *pairCounters) { s.responsesSent++ })
 			a.log.Debug("wrote response", zap.Stringer("m", res))
 		} else {
 			a.log.Debug("write err", zap.Error(err))
@@ -78,14 +100,18 @@ func (a *Agent) handleBindingRequest(m *stun.Message, c *localUDPCandidate, radd
 	}
 
 	list.Pairs = append(list.Pairs, pair)
-	list.Sort()
+	list.SortPolicy(a.policy)
 	a.set[c.stream] = list
 	return nil
 }
 
-func (a *Agent) handleBindingResponse(t *agentTransaction, p *Pair, m *stun.Message, raddr Addr) error {
+func (a *Agent) handleBindingResponse(t *agentTransaction, p *Pair, m *stun.Message, raddr Addr, now time.Time) error {
 	if err := a.processBindingResponse(t, p, m, raddr); err != nil {
 		// TODO: Handle nomination failure.
+		t.traceCheck(TraceResponse, now, err)
+		if err == errRoleConflict {
+			a.inc(CounterRoleConflicts)
+		}
 
 		a.mux.Lock()
 		a.setPairStateByKey(t.checklist, t.pair, PairFailed)
@@ -98,6 +124,8 @@ func (a *Agent) handleBindingResponse(t *agentTransaction, p *Pair, m *stun.Mess
 		return err
 	}
 
+	a.countResponse(t, now)
+	t.traceCheck(TraceResponse, now, nil)
 	a.mux.Lock()
 	a.setPairStateByKey(t.checklist, t.pair, PairSucceeded)
 	a.mux.Unlock()
@@ -158,6 +186,17 @@ func (a *Agent) handleBindingResponse(t *agentTransaction, p *Pair, m *stun.Mess
 	if !found {
 		cl.Valid = append(cl.Valid, validPair)
 	}
+	if a.timeline.FirstSuccess.IsZero() {
+		a.timeline.FirstSuccess = now
+		a.observeSinceChecks(HistogramFirstValidPair, now)
+	}
+	if validPair.Nominated {
+		markOnce(&a.timeline.Nomination, now)
+		a.tracePair(TraceNomination, t.checklist, &validPair)
+		if c, ok := a.localCandidate(t.checklist, validPair.Local.Addr); ok {
+			c.nominate(validPair.Remote.Addr)
+		}
+	}
 	a.set[t.checklist] = cl
 	// Updating checklist states.
 	a.updateState()
@@ -172,7 +211,10 @@ var (
 )
 
 func (a *Agent) processBindingResponse(t *agentTransaction, p *Pair, m *stun.Message, raddr Addr) error {
-	integrity := stun.NewShortTermIntegrity(a.remotePassword)
+	a.mux.Lock()
+	_, remotePassword := a.remoteCredentials(t.checklist)
+	a.mux.Unlock()
+	integrity := stun.NewShortTermIntegrity(remotePassword)
 	if err := stun.Fingerprint.Check(m); err != nil {
 		if err == stun.ErrAttributeNotFound {
 			return errFingerprintNotFound
@@ -212,7 +254,10 @@ func (a *Agent) processBindingResponse(t *agentTransaction, p *Pair, m *stun.Mes
 		Proto: p.Local.Addr.Proto,
 	}
 	copy(addr.IP, xAddr.IP)
-	if _, ok := a.localCandidateByAddr(addr); !ok {
+	a.mux.Lock()
+	_, ok := a.localCandidate(t.checklist, addr)
+	a.mux.Unlock()
+	if !ok {
 		if err := a.addPeerReflexive(t, p, addr); err != nil {
 			return err
 		}
@@ -222,22 +267,22 @@ func (a *Agent) processBindingResponse(t *agentTransaction, p *Pair, m *stun.Mes
 
 var errUnsupportedProtocol = errors.New("protocol not supported")
 
-func (a *Agent) startBinding(p *Pair, m *stun.Message, priority int, t time.Time) error {
+func (a *Agent) startBinding(checklist int, p *Pair, m *stun.Message, priority int, t time.Time) error {
 	if p.Remote.Addr.Proto != candidate.UDP {
 		return errUnsupportedProtocol
 	}
-	c, ok := a.localCandidateByAddr(p.Local.Addr)
+	a.mux.Lock()
+	c, ok := a.localCandidate(checklist, p.Local.Addr)
+	markOnce(&a.timeline.FirstCheck, t)
+	a.mux.Unlock()
 	if !ok {
 		return errCandidateNotFound
 	}
-	a.mux.Lock()
-	checklist := a.checklist
-	a.mux.Unlock()
 
 	at := &agentTransaction{
 		id:          m.TransactionID,
 		start:       t,
-		rto:         a.rto(),
+		rto:         a.pairRTO(getPairKey(p)),
 		raw:         m.Raw,
 		checklist:   checklist,
 		priority:    priority,
@@ -247,15 +292,13 @@ func (a *Agent) startBinding(p *Pair, m *stun.Message, priority int, t time.Time
 		maxAttempts: a.maxAttempts,
 	}
 	at.setDeadline(t)
+	a.startCheckSpan(at, p)
 
 	a.tMux.Lock()
 	a.t[m.TransactionID] = at
 	a.tMux.Unlock()
 
-	udpAddr := &net.UDPAddr{
-		IP:   p.Remote.Addr.IP,
-		Port: p.Remote.Addr.Port,
-	}
+	udpAddr := p.remoteUDPAddr()
 	_, err := c.conn.WriteTo(m.Raw, udpAddr)
 	// TODO: Add write deadline.
 	// TODO: Check n if needed.
@@ -267,6 +310,7 @@ func (a *Agent) startBinding(p *Pair, m *stun.Message, priority int, t time.Time
 		)
 
 		// TODO: If temporary, just perform STUN retries normally.
+		at.traceCheck(TraceTimeout, t, err)
 		a.tMux.Lock()
 		delete(a.t, m.TransactionID)
 		a.tMux.Unlock()
@@ -281,12 +325,15 @@ func (a *Agent) startBinding(p *Pair, m *stun.Message, priority int, t time.Time
 		for i := range cl.Pairs {
 			if samePair(&cl.Pairs[i], p) {
 				cl.Pairs[i].State = PairFailed
+				a.tracePair(TracePairState, checklist, &cl.Pairs[i])
 			}
 		}
 		a.mux.Unlock()
 
 		return nil
 	}
+	a.count(at.pair, func(s *pairCounters) { s.requestsSent++ })
+	a.inc(CounterChecks)
 	a.log.Debug("started",
 		zap.Stringer("remote", udpAddr),
 		zap.Stringer("msg", m),
@@ -0,0 +1,104 @@
+package ice
+
+import (
+	"errors"
+	"fmt"
+
+	ct "gortc.io/ice/candidate"
+)
+
+// CandidatePolicy controls which local candidates are advertised and paired,
+// e.g. to avoid exposing host IP addresses. Host candidates are gathered
+// regardless of policy, because their sockets are bases for reflexive and
+// relayed candidates.
+type CandidatePolicy byte
+
+const (
+	// CandidatePolicyAll allows candidates of any type.
+	CandidatePolicyAll CandidatePolicy = iota
+	// CandidatePolicyNoHost allows any candidates except host ones.
+	CandidatePolicyNoHost
+	// CandidatePolicyRelay allows only relayed candidates.
+	CandidatePolicyRelay
+)
+
+var candidatePolicyToStr = map[CandidatePolicy]string{
+	CandidatePolicyAll:    "all",
+	CandidatePolicyNoHost: "no-host",
+	CandidatePolicyRelay:  "relay",
+}
+
+func (p CandidatePolicy) String() string {
+	if s, ok := candidatePolicyToStr[p]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// MarshalText implements TextMarshaler.
+func (p CandidatePolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements TextUnmarshaler.
+func (p *CandidatePolicy) UnmarshalText(text []byte) error {
+	for k, v := range candidatePolicyToStr {
+		if string(text) == v {
+			*p = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown candidate policy %q", text)
+}
+
+var (
+	errCandidatePolicyUnsupported = errors.New("unsupported candidate policy")
+	errCandidatePolicyNoTURN      = errors.New("relay candidate policy requires TURN server")
+)
+
+// allows reports whether local candidate can be advertised and paired.
+func (p CandidatePolicy) allows(c Candidate) bool {
+	switch p {
+	case CandidatePolicyNoHost:
+		return c.Type != ct.Host
+	case CandidatePolicyRelay:
+		return c.Type == ct.Relayed
+	default:
+		return true
+	}
+}
+
+// allowedCandidates returns local candidates that are allowed by candidate
+// policy of agent.
+func (a *Agent) allowedCandidates(candidates []*localUDPCandidate) []Candidate {
+	allowed := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		if !a.candidatePolicy.allows(c.candidate) {
+			continue
+		}
+		allowed = append(allowed, c.candidate)
+	}
+	return allowed
+}
+
+// pairedCandidate returns local candidate to pair with remote one that sent
+// check to socket of host candidate c: c itself if it is allowed by candidate
+// policy, or allowed reflexive candidate with c as base otherwise. Should be
+// called with a.mux held.
+func (a *Agent) pairedCandidate(c *localUDPCandidate) (Candidate, bool) {
+	if a.candidatePolicy.allows(c.candidate) {
+		return c.candidate, true
+	}
+	if c.stream >= len(a.localCandidates) {
+		return Candidate{}, false
+	}
+	for _, l := range a.localCandidates[c.stream] {
+		if l.candidate.Type != ct.ServerReflexive || !l.candidate.Base.Equal(c.candidate.Addr) {
+			continue
+		}
+		if a.candidatePolicy.allows(l.candidate) {
+			return l.candidate, true
+		}
+	}
+	return Candidate{}, false
+}
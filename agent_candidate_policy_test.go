@@ -0,0 +1,425 @@
+package ice
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/stun"
+	"gortc.io/turn"
+)
+
+func TestAgent_CandidatePolicy(t *testing.T) {
+	gatherer := &mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			base := Addr{IP: net.IPv4(10, 0, 0, 1), Port: 1000, Proto: candidate.UDP}
+			relayed := Addr{IP: net.IPv4(5, 6, 7, 8), Port: 2000, Proto: candidate.UDP}
+			var candidates []*localUDPCandidate
+			for _, c := range []Candidate{
+				{Base: base, Addr: base, Type: candidate.Host},
+				{Base: base, Addr: Addr{IP: net.IPv4(1, 2, 3, 4), Port: 1000, Proto: candidate.UDP}, Type: candidate.ServerReflexive},
+				{Base: relayed, Addr: relayed, Type: candidate.Relayed},
+			} {
+				c.ComponentID = 1
+				c.Foundation = Foundation(&c, Addr{})
+				c.Priority = Priority(TypePreference(c.Type), singleIPAddrPreference, c.ComponentID)
+				candidates = append(candidates, &localUDPCandidate{candidate: c, conn: mockPacketConn{}})
+			}
+			return candidates, nil
+		},
+	}
+	remote := Candidate{
+		Addr:        Addr{IP: net.IPv4(10, 0, 0, 2), Port: 3000, Proto: candidate.UDP},
+		Type:        candidate.Host,
+		ComponentID: 1,
+	}
+	remote.Foundation = Foundation(&remote, Addr{})
+	remote.Priority = Priority(TypePreference(remote.Type), singleIPAddrPreference, remote.ComponentID)
+	for _, tc := range []struct {
+		policy CandidatePolicy
+		types  []candidate.Type
+		pairs  int // server reflexive pairs are pruned as redundant
+	}{
+		{
+			policy: CandidatePolicyAll,
+			types:  []candidate.Type{candidate.Host, candidate.ServerReflexive, candidate.Relayed},
+			pairs:  2,
+		},
+		{
+			policy: CandidatePolicyNoHost,
+			types:  []candidate.Type{candidate.ServerReflexive, candidate.Relayed},
+			pairs:  2,
+		},
+	} {
+		t.Run(tc.policy.String(), func(t *testing.T) {
+			a, err := NewAgent(withGatherer(gatherer), WithCandidatePolicy(tc.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mustClose(t, a)
+			if err = a.GatherCandidates(); err != nil {
+				t.Fatal(err)
+			}
+			candidates, err := a.LocalCandidates()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(candidates) != len(tc.types) {
+				t.Fatalf("unexpected candidates: %v", candidates)
+			}
+			for i := range candidates {
+				if candidates[i].Type != tc.types[i] {
+					t.Errorf("[%d] %s (got) != %s (expected)", i, candidates[i].Type, tc.types[i])
+				}
+			}
+			if r := a.Report(); len(r.LocalCandidates) != 1 || len(r.LocalCandidates[0]) != len(tc.types) {
+				t.Errorf("unexpected report candidates: %v", r.LocalCandidates)
+			}
+			if err = a.AddRemoteCandidates([]Candidate{remote}); err != nil {
+				t.Fatal(err)
+			}
+			if err = a.PrepareChecklistSet(); err != nil {
+				t.Fatal(err)
+			}
+			pairs := a.set[0].Pairs
+			if len(pairs) != tc.pairs {
+				t.Fatalf("unexpected pairs: %v", pairs)
+			}
+			for _, p := range pairs {
+				if !tc.policy.allows(p.Local) {
+					t.Errorf("pair with %s local candidate", p.Local.Type)
+				}
+			}
+		})
+	}
+	t.Run("Unsupported", func(t *testing.T) {
+		if _, err := NewAgent(WithCandidatePolicy(100)); err != errCandidatePolicyUnsupported {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("NoTURN", func(t *testing.T) {
+		if _, err := NewAgent(WithCandidatePolicy(CandidatePolicyRelay)); err != errCandidatePolicyNoTURN {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+// serveSTUN responds to binding requests on conn with provided mapped IP
+// and port of request source until conn is closed.
+func serveSTUN(conn net.PacketConn, mapped net.IP) {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		m := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+		if m.Decode() != nil || m.Type != stun.BindingRequest {
+			continue
+		}
+		res := stun.MustBuild(stun.NewTransactionIDSetter(m.TransactionID), stun.BindingSuccess,
+			&stun.XORMappedAddress{IP: mapped, Port: addr.(*net.UDPAddr).Port},
+			stun.Fingerprint,
+		)
+		_, _ = conn.WriteTo(res.Raw, addr)
+	}
+}
+
+func TestAgent_CandidatePolicyNoHost(t *testing.T) {
+	server := listenLoopback(t)
+	defer mustClose(t, server)
+	mapped := net.IPv4(203, 0, 113, 1)
+	go serveSTUN(server, mapped)
+	// Loopback addresses are not gathered, so host candidate is mocked.
+	hostConn := listenLoopback(t)
+	gatherer := &mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			local := hostConn.LocalAddr().(*net.UDPAddr)
+			addr := Addr{IP: local.IP, Port: local.Port, Proto: candidate.UDP}
+			c := Candidate{Base: addr, Addr: addr, Type: candidate.Host, ComponentID: 1}
+			c.Foundation = Foundation(&c, Addr{})
+			c.Priority = Priority(TypePreference(c.Type), singleIPAddrPreference, c.ComponentID)
+			return []*localUDPCandidate{{candidate: c, conn: hostConn}}, nil
+		},
+	}
+	a, err := NewAgent(
+		withGatherer(gatherer),
+		WithServer(Server{URI: []string{"stun:" + server.LocalAddr().String()}}),
+		WithCandidatePolicy(CandidatePolicyNoHost),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	a.SetLocalCredentials("local", "password")
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	candidates, err := a.LocalCandidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 {
+		t.Fatalf("unexpected candidates: %v", candidates)
+	}
+	if c := candidates[0]; c.Type != candidate.ServerReflexive || !c.Addr.IP.Equal(mapped) ||
+		!c.Related.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("unexpected candidate %+v", c)
+	}
+	peer := listenLoopback(t)
+	defer mustClose(t, peer)
+	peerAddr := peer.LocalAddr().(*net.UDPAddr)
+	remote := Candidate{
+		Addr:        Addr{IP: peerAddr.IP, Port: peerAddr.Port, Proto: candidate.UDP},
+		Type:        candidate.Host,
+		ComponentID: 1,
+	}
+	remote.Foundation = Foundation(&remote, Addr{})
+	remote.Priority = Priority(TypePreference(remote.Type), singleIPAddrPreference, remote.ComponentID)
+	if err = a.AddRemoteCandidates([]Candidate{remote}); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.PrepareChecklistSet(); err != nil {
+		t.Fatal(err)
+	}
+	// Checks from peer are received on host candidate socket, but pairs
+	// should use server reflexive candidate.
+	a.mux.Lock()
+	var host *localUDPCandidate
+	for _, c := range a.localCandidates[0] {
+		if c.candidate.Type == candidate.Host {
+			host = c
+		}
+	}
+	a.mux.Unlock()
+	req := stun.MustBuild(stun.TransactionID, stun.BindingRequest,
+		stun.NewUsername("local:remote"), stun.NewShortTermIntegrity("password"), stun.Fingerprint,
+	)
+	if err = a.handleBindingRequest(req, host, remote.Addr); err != nil {
+		t.Fatal(err)
+	}
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	list := a.set[0]
+	if len(list.Pairs) != 1 || len(list.Triggered) != 1 {
+		t.Fatalf("unexpected pairs %v, triggered %v", list.Pairs, list.Triggered)
+	}
+	for _, p := range append(list.Pairs, list.Triggered...) {
+		if p.Local.Type != candidate.ServerReflexive {
+			t.Errorf("pair with %s local candidate", p.Local.Type)
+		}
+	}
+}
+
+// serveTURN is minimal TURN server that allocates relay socket for client
+// with "user" and "secret" credentials, relaying data between client and
+// peers, until conn is closed. Permissions are not checked. Deleted
+// allocations are sent to released.
+func serveTURN(conn, relay net.PacketConn, released chan<- net.Addr) {
+	const realm, nonce = "realm", "nonce"
+	integrity := stun.NewLongTermIntegrity("user", realm, "secret")
+	var (
+		mux    sync.Mutex
+		client net.Addr
+	)
+	go func() {
+		buf := make([]byte, maxPacketSize)
+		for {
+			n, addr, err := relay.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			mux.Lock()
+			to := client
+			mux.Unlock()
+			if to == nil {
+				continue
+			}
+			peer := addr.(*net.UDPAddr)
+			m := stun.MustBuild(stun.TransactionID, stun.NewType(stun.MethodData, stun.ClassIndication),
+				&turn.PeerAddress{IP: peer.IP, Port: peer.Port}, turn.Data(buf[:n]), stun.Fingerprint,
+			)
+			_, _ = conn.WriteTo(m.Raw, to)
+		}
+	}()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		m := &stun.Message{Raw: append([]byte{}, buf[:n]...)}
+		if m.Decode() != nil {
+			continue
+		}
+		id := stun.NewTransactionIDSetter(m.TransactionID)
+		var res *stun.Message
+		if _, err = m.Get(stun.AttrMessageIntegrity); err != nil && m.Type.Class == stun.ClassRequest {
+			res = stun.MustBuild(id, stun.NewType(m.Type.Method, stun.ClassErrorResponse),
+				&stun.ErrorCodeAttribute{Code: 401, Reason: []byte("Unauthorized")},
+				stun.NewRealm(realm), stun.NewNonce(nonce), stun.Fingerprint,
+			)
+			_, _ = conn.WriteTo(res.Raw, addr)
+			continue
+		}
+		switch m.Type {
+		case stun.NewType(stun.MethodSend, stun.ClassIndication):
+			var (
+				peer turn.PeerAddress
+				data turn.Data
+			)
+			if peer.GetFrom(m) != nil || data.GetFrom(m) != nil {
+				continue
+			}
+			_, _ = relay.WriteTo(data, &net.UDPAddr{IP: peer.IP, Port: peer.Port})
+			continue
+		case stun.NewType(stun.MethodAllocate, stun.ClassRequest):
+			mux.Lock()
+			client = addr
+			mux.Unlock()
+			relayed, mapped := relay.LocalAddr().(*net.UDPAddr), addr.(*net.UDPAddr)
+			res = stun.MustBuild(id, stun.NewType(stun.MethodAllocate, stun.ClassSuccessResponse),
+				&turn.RelayedAddress{IP: relayed.IP, Port: relayed.Port},
+				&stun.XORMappedAddress{IP: mapped.IP, Port: mapped.Port},
+				&turn.Lifetime{Duration: time.Minute},
+				integrity, stun.Fingerprint,
+			)
+		case stun.NewType(stun.MethodRefresh, stun.ClassRequest):
+			var lifetime turn.Lifetime
+			if lifetime.GetFrom(m) == nil && lifetime.Duration == 0 {
+				select {
+				case released <- addr:
+				default:
+				}
+			}
+			res = stun.MustBuild(id, stun.NewType(stun.MethodRefresh, stun.ClassSuccessResponse),
+				integrity, stun.Fingerprint,
+			)
+		default:
+			res = stun.MustBuild(id, stun.NewType(m.Type.Method, stun.ClassSuccessResponse),
+				integrity, stun.Fingerprint,
+			)
+		}
+		_, _ = conn.WriteTo(res.Raw, addr)
+	}
+}
+
+// readMessage reads STUN message from conn, failing test on timeout.
+func readMessage(t *testing.T, conn net.PacketConn) (*stun.Message, net.Addr) {
+	t.Helper()
+	if err := conn.SetReadDeadline(time.Now().Add(time.Second * 5)); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, maxPacketSize)
+	n, addr, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &stun.Message{Raw: buf[:n]}
+	if err = m.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	return m, addr
+}
+
+func TestAgent_CandidatePolicyRelay(t *testing.T) {
+	server := listenLoopback(t)
+	defer mustClose(t, server)
+	relay := listenLoopback(t)
+	defer mustClose(t, relay)
+	released := make(chan net.Addr, 1)
+	go serveTURN(server, relay, released)
+	// Loopback addresses are not gathered, so host candidate is mocked.
+	hostConn := listenLoopback(t)
+	gatherer := &mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			local := hostConn.LocalAddr().(*net.UDPAddr)
+			addr := Addr{IP: local.IP, Port: local.Port, Proto: candidate.UDP}
+			c := Candidate{Base: addr, Addr: addr, Type: candidate.Host, ComponentID: 1}
+			c.Foundation = Foundation(&c, Addr{})
+			c.Priority = Priority(TypePreference(c.Type), singleIPAddrPreference, c.ComponentID)
+			return []*localUDPCandidate{{candidate: c, conn: hostConn}}, nil
+		},
+	}
+	a, err := NewAgent(
+		withGatherer(gatherer),
+		WithTURN("turn:"+server.LocalAddr().String(), "user", "secret"),
+		WithCandidatePolicy(CandidatePolicyRelay),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	a.SetLocalCredentials("local", "password")
+	a.SetRemoteCredentials("remote", "secret")
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	candidates, err := a.LocalCandidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 {
+		t.Fatalf("unexpected candidates: %v", candidates)
+	}
+	relayed := relay.LocalAddr().(*net.UDPAddr)
+	if c := candidates[0]; c.Type != candidate.Relayed || !c.Addr.IP.Equal(relayed.IP) ||
+		c.Addr.Port != relayed.Port || !c.Related.IP.Equal(net.IPv4zero) {
+		t.Fatalf("unexpected candidate %+v", c)
+	}
+	peer := listenLoopback(t)
+	defer mustClose(t, peer)
+	peerAddr := peer.LocalAddr().(*net.UDPAddr)
+	remote := Candidate{
+		Addr:        Addr{IP: peerAddr.IP, Port: peerAddr.Port, Proto: candidate.UDP},
+		Type:        candidate.Host,
+		ComponentID: 1,
+	}
+	remote.Foundation = Foundation(&remote, Addr{})
+	remote.Priority = Priority(TypePreference(remote.Type), singleIPAddrPreference, remote.ComponentID)
+	if err = a.AddRemoteCandidates([]Candidate{remote}); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.PrepareChecklistSet(); err != nil {
+		t.Fatal(err)
+	}
+	a.mux.Lock()
+	pairs := a.set[0].Pairs
+	a.mux.Unlock()
+	if len(pairs) != 1 || pairs[0].Local.Type != candidate.Relayed {
+		t.Fatalf("unexpected pairs: %v", pairs)
+	}
+	// Check is sent via TURN server from relayed address.
+	if err = a.startCheck(&pairs[0], time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	m, addr := readMessage(t, peer)
+	if m.Type != stun.BindingRequest || addr.String() != relayed.String() {
+		t.Fatalf("unexpected %s from %s", m, addr)
+	}
+	// Check from peer to relayed address is answered via TURN server.
+	req := stun.MustBuild(stun.TransactionID, stun.BindingRequest,
+		stun.NewUsername("local:remote"), stun.NewShortTermIntegrity("password"), stun.Fingerprint,
+	)
+	if _, err = peer.WriteTo(req.Raw, relayed); err != nil {
+		t.Fatal(err)
+	}
+	m, addr = readMessage(t, peer)
+	if m.Type != stun.BindingSuccess || m.TransactionID != req.TransactionID || addr.String() != relayed.String() {
+		t.Fatalf("unexpected %s from %s", m, addr)
+	}
+	// Allocation is deleted on close via socket of host candidate.
+	if err = a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case addr = <-released:
+		if addr.String() != hostConn.LocalAddr().String() {
+			t.Errorf("allocation of %s is released", addr)
+		}
+	case <-time.After(time.Second * 5):
+		t.Error("allocation is not released")
+	}
+}
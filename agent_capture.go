@@ -0,0 +1,82 @@
+package ice
+
+import (
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gortc.io/ice/internal/pcapng"
+)
+
+// captureConn is candidate connection that writes STUN and TURN packets
+// to capture file.
+type captureConn struct {
+	net.PacketConn
+	w     *pcapng.Writer
+	local *net.UDPAddr
+	log   *zap.Logger
+}
+
+// captured reports whether packet should be captured.
+func captured(p []byte) bool {
+	switch ClassifyPacket(p) {
+	case PacketSTUN, PacketTURNChannel:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *captureConn) write(src, dst net.Addr, p []byte) {
+	srcAddr, srcOK := src.(*net.UDPAddr)
+	dstAddr, dstOK := dst.(*net.UDPAddr)
+	if !srcOK || !dstOK || !captured(p) {
+		return
+	}
+	if err := c.w.WritePacket(time.Now(), srcAddr, dstAddr, p); err != nil {
+		c.log.Debug("failed to capture", zap.Error(err))
+	}
+}
+
+func (c *captureConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	n, addr, err := c.PacketConn.ReadFrom(p)
+	if err == nil {
+		c.write(addr, c.local, p[:n])
+	}
+	return n, addr, err
+}
+
+func (c *captureConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if err == nil {
+		c.write(c.local, addr, p[:n])
+	}
+	return n, err
+}
+
+// nominate implements addrNominator, passing nomination to underlying
+// connection.
+func (c *captureConn) nominate(addr net.Addr) {
+	if n, ok := c.PacketConn.(addrNominator); ok {
+		n.nominate(addr)
+	}
+}
+
+// captureCandidates wraps connections of gathered host candidates to write
+// traffic to capture file, if it is configured. Traffic of pipes, like the
+// ones of STUN and TURN clients, goes through the same connections.
+func (a *Agent) captureCandidates(candidates []*localUDPCandidate) {
+	if a.capture == nil {
+		return
+	}
+	for _, c := range candidates {
+		base := c.candidate.Base
+		c.conn = &captureConn{
+			PacketConn: c.conn,
+			w:          a.capture,
+			local:      &net.UDPAddr{IP: base.IP, Port: base.Port, Zone: base.Zone},
+			log:        a.log,
+		}
+	}
+}
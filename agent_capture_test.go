@@ -0,0 +1,111 @@
+package ice
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"go.uber.org/zap"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/ice/internal/pcapng"
+	"gortc.io/stun"
+)
+
+// receivingPacketConn is discardPacketConn that receives single packet.
+type receivingPacketConn struct {
+	discardPacketConn
+	p    []byte
+	from net.Addr
+}
+
+func (c *receivingPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	return copy(p, c.p), c.from, nil
+}
+
+func TestCaptureConn(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := pcapng.NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 2000}
+	m := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+	c := &captureConn{
+		PacketConn: &receivingPacketConn{p: m.Raw, from: remote},
+		w:          w,
+		local:      &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000},
+		log:        zap.NewNop(),
+	}
+	for _, tc := range []struct {
+		name     string
+		do       func() error
+		captured bool
+	}{
+		{
+			name: "WriteSTUN",
+			do: func() error {
+				_, err := c.WriteTo(m.Raw, remote)
+				return err
+			},
+			captured: true,
+		},
+		{
+			name: "WriteRTP",
+			do: func() error {
+				_, err := c.WriteTo([]byte{128, 0, 0, 1}, remote)
+				return err
+			},
+		},
+		{
+			name: "ReadSTUN",
+			do: func() error {
+				_, _, err := c.ReadFrom(make([]byte, 1024))
+				return err
+			},
+			captured: true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			n := buf.Len()
+			if err := tc.do(); err != nil {
+				t.Fatal(err)
+			}
+			if captured := buf.Len() > n; captured != tc.captured {
+				t.Errorf("captured: %v (got) != %v (expected)", captured, tc.captured)
+			}
+		})
+	}
+}
+
+func TestWithCapture(t *testing.T) {
+	buf := new(bytes.Buffer)
+	a, err := NewAgent(WithCapture(buf), withGatherer(&mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			addr := Addr{IP: net.IPv4(10, 0, 0, 1), Port: 1000, Proto: candidate.UDP}
+			return []*localUDPCandidate{{
+				candidate: Candidate{Addr: addr, Base: addr, Type: candidate.Host, ComponentID: 1},
+				conn:      mockPacketConn{},
+			}}, nil
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	if buf.Len() == 0 {
+		t.Error("pcapng header should be written")
+	}
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	a.mux.Lock()
+	c, ok := a.localCandidates[0][0].conn.(*captureConn)
+	a.mux.Unlock()
+	if !ok {
+		t.Fatal("candidate connection should be captured")
+	}
+	if c.local.Port != 1000 {
+		t.Errorf("unexpected local address %s", c.local)
+	}
+}
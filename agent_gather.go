@@ -8,6 +8,8 @@ import (
 
 	"go.uber.org/zap"
 
+	ct "gortc.io/ice/candidate"
+	"gortc.io/ice/gather"
 	"gortc.io/stun"
 	"gortc.io/turn"
 	"gortc.io/turnc"
@@ -23,19 +25,59 @@ func withGatherer(g candidateGatherer) AgentOption {
 type gathererOptions struct {
 	Components int
 	IPv4Only   bool
+	PortMin    int
+	PortMax    int    // any port if zero
+	Ports      []int  // explicit ports, overrides range
+	Username   string // local ufrag
+	LinkLocal  bool   // use IPv6 link-local addresses
+	Filter     *AddrFilter
+	Filtered   func(f FilteredAddr) // called for each filtered address
+	Policy     gather.PolicyTable   // overrides address precedence
 }
 
 type candidateGatherer interface {
 	gatherUDP(opt gathererOptions) ([]*localUDPCandidate, error)
 }
 
+// Close closes candidate socket. Sockets of reflexive candidates are shared
+// with host or relayed ones, so they are closed with them.
 func (c *localUDPCandidate) Close() error {
+	if c.candidate.Type != ct.Host && c.candidate.Type != ct.Relayed {
+		return nil
+	}
 	return c.conn.Close()
 }
 
+// closeCandidates closes sockets of candidates. Relayed candidates are closed
+// first, so their allocations are deleted via sockets of host candidates
+// before these are closed.
+func (a *Agent) closeCandidates(candidates []*localUDPCandidate) {
+	sorted := make([]*localUDPCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		if c.candidate.Type == ct.Relayed {
+			sorted = append(sorted, c)
+		}
+	}
+	for _, c := range candidates {
+		if c.candidate.Type != ct.Relayed {
+			sorted = append(sorted, c)
+		}
+	}
+	for _, c := range sorted {
+		if err := c.Close(); err != nil {
+			a.log.Debug("failed to close candidate", zap.Error(err))
+		}
+	}
+}
+
+// maxPacketSize is size of buffer for reading UDP datagrams, so packets
+// like DTLS flights or video RTP are not truncated.
+const maxPacketSize = 65535
+
 func (c *localUDPCandidate) readUntilClose(a *Agent) {
+	conn := statsConn{PacketConn: c.conn, agent: a, stream: c.stream, local: c.candidate.Addr}
+	buf := make([]byte, maxPacketSize)
 	for {
-		buf := make([]byte, 1024)
 		n, addr, err := c.conn.ReadFrom(buf)
 		if err != nil {
 			break
@@ -64,8 +106,24 @@ func (c *localUDPCandidate) readUntilClose(a *Agent) {
 				continue
 			}
 		}
+		p := append([]byte(nil), buf[:n]...)
+		if t := ClassifyPacket(p); t != PacketSTUN {
+			k := newPairKey(c.candidate.Addr, Addr{IP: udpAddr.IP, Port: udpAddr.Port})
+			counted := a.countData(c.stream, k, func(s *pairCounters) {
+				s.packetsReceived++
+				s.bytesReceived += uint64(n)
+			})
+			if !counted {
+				c.log.Debug("data from address without pair", zap.Stringer("addr", udpAddr))
+			}
+			if !a.handlePacket(t, p, udpAddr, conn) {
+				c.log.Debug("no handler for packet", zap.Stringer("type", t))
+			}
+			continue
+		}
 		go func() {
-			if err := a.processUDP(buf[:n], c, udpAddr); err != nil {
+			if err := a.packetStep(p, c, udpAddr); err != nil {
+				a.reportError(err)
 				c.log.Error("processUDP failed", zap.Error(err))
 			} else {
 				c.log.Debug("processed")
@@ -74,23 +132,102 @@ func (c *localUDPCandidate) readUntilClose(a *Agent) {
 	}
 }
 
+// gathererOptions returns options of host candidates gathering.
+func (a *Agent) gathererOptions() gathererOptions {
+	return gathererOptions{
+		Components: 1,
+		IPv4Only:   a.ipv4Only,
+		PortMin:    a.portMin,
+		PortMax:    a.portMax,
+		Ports:      a.ports,
+		Username:   a.localUsername,
+		LinkLocal:  a.linkLocal,
+		Filter:     a.filter,
+		Policy:     a.policy,
+	}
+}
+
+// startCandidates starts reading on sockets of gathered candidates.
+func (a *Agent) startCandidates(candidates []*localUDPCandidate) {
+	for i := range candidates {
+		candidates[i].log = a.log.Named("candidate").With(
+			zap.Stringer("addr", candidates[i].candidate.Addr),
+		)
+		if t := candidates[i].candidate.Type; t != ct.Host && t != ct.Relayed {
+			// Reflexive candidate shares socket with its base.
+			continue
+		}
+		go candidates[i].readUntilClose(a)
+	}
+}
+
 // GatherCandidatesForStream allows gathering candidates for multiple streams.
-// The streamID is integer that starts from zero.
+// The streamID is integer that starts from zero, streams can be gathered in
+// any order.
 func (a *Agent) GatherCandidatesForStream(streamID int) error {
-	if len(a.localCandidates) > streamID {
+	a.mux.Lock()
+	s, err := a.streamAt(streamID)
+	if err != nil {
+		a.mux.Unlock()
+		return err
+	}
+	if s.removed {
+		a.mux.Unlock()
+		return errStreamRemoved
+	}
+	if s.gathered || s.gathering {
+		a.mux.Unlock()
 		return errStreamAlreadyExist
 	}
-	candidates, err := a.gatherer.gatherUDP(gathererOptions{Components: 1, IPv4Only: a.ipv4Only})
+	// Marking stream, so concurrent call does not gather it again.
+	s.gathering = true
+	a.mux.Unlock()
+	a.trace(TraceEvent{Type: TraceGatherStart, Stream: streamID})
+	err = a.gatherCandidatesForStream(streamID, s)
+	a.mux.Lock()
+	s.gathering = false
+	count := len(a.localCandidates[streamID])
+	a.mux.Unlock()
+	a.trace(TraceEvent{Type: TraceGatherFinish, Stream: streamID, Candidates: count, Err: err})
+	if err != nil {
+		a.reportError(err)
+	}
+	return err
+}
+
+func (a *Agent) gatherCandidatesForStream(streamID int, s *stream) error {
+	var filtered []FilteredAddr
+	opt := a.gathererOptions()
+	opt.Filtered = func(f FilteredAddr) {
+		a.log.Debug("filtered host address", zap.Stringer("addr", f))
+		filtered = append(filtered, f)
+	}
+	start := a.clock()
+	candidates, err := a.gatherer.gatherUDP(opt)
 	if err != nil {
 		return err
 	}
-	a.localCandidates = append(a.localCandidates, candidates)
+	a.timeGathering(ct.Host, start)
+	a.captureCandidates(candidates)
+	a.mux.Lock()
+	a.filtered = filtered
+	a.mux.Unlock()
+	if a.nat != nil {
+		candidates = a.nat.apply(candidates)
+	}
+	if a.mdnsMode == MulticastDNSQueryAndGather {
+		if err = a.publishHostCandidates(candidates); err != nil {
+			return err
+		}
+	}
 	for i := range candidates {
-		candidates[i].log = a.log.Named("candidate").With(
-			zap.Stringer("addr", candidates[i].candidate.Addr),
-		)
-		go candidates[i].readUntilClose(a)
+		candidates[i].stream = streamID
 	}
+	a.mux.Lock()
+	s.gathered = true
+	a.localCandidates[streamID] = candidates
+	a.mux.Unlock()
+	a.startCandidates(candidates)
 	if len(a.stun) > 0 {
 		if err = a.gatherServerReflexiveCandidatesFor(streamID); err != nil {
 			return err
@@ -101,6 +238,12 @@ func (a *Agent) GatherCandidatesForStream(streamID int) error {
 			return err
 		}
 	}
+	if a.recorder != nil {
+		a.mux.Lock()
+		gathered := recordedCandidates(a.localCandidates[streamID])
+		a.mux.Unlock()
+		a.record(RecordEvent{Type: RecordLocalCandidates, Stream: streamID, Candidates: gathered})
+	}
 	return nil
 }
 
@@ -122,43 +265,72 @@ func resolveTURN(uri turn.URI) (*net.UDPAddr, error) {
 	return addr, err
 }
 
-func (a *Agent) gatherServerReflexiveCandidates(log *zap.Logger, c *localUDPCandidate, s stunServerOptions) error {
+// gatherServerReflexiveCandidate returns server reflexive candidate with c
+// as base, or nil if it was not gathered or is redundant to c.
+func (a *Agent) gatherServerReflexiveCandidate(log *zap.Logger, c *localUDPCandidate, s stunServerOptions) (*localUDPCandidate, error) {
+	defer a.timeGathering(ct.ServerReflexive, a.clock())
 	addr, err := resolveSTUN(s.uri)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	// TODO: Setup correct RTO.
 	client, err := stun.NewClient(c.Pipe(addr), stun.WithRTO(a.ta/2))
 	if err != nil {
-		return err
+		return nil, err
 	}
-	var bindErr error
+	var (
+		bindErr    error
+		mappedAddr stun.XORMappedAddress
+	)
 	if doErr := client.Do(stun.MustBuild(stun.TransactionID, stun.BindingRequest, stun.Fingerprint), func(event stun.Event) {
 		if event.Error != nil {
 			bindErr = event.Error
 			return
 		}
-		var mappedAddr stun.XORMappedAddress
-		if getErr := mappedAddr.GetFrom(event.Message); getErr != nil {
-			bindErr = getErr
-		}
-		log.Debug("got server reflexive candidate", zap.Stringer("addr", mappedAddr))
+		bindErr = mappedAddr.GetFrom(event.Message)
 	}); doErr != nil {
-		return doErr
+		return nil, doErr
 	}
 	if err = client.Close(); err != nil {
-		return err
+		return nil, err
 	}
 	if bindErr != nil {
 		log.Debug("binding error", zap.Error(bindErr))
+		return nil, nil
 	}
-	return nil
+	log.Debug("got server reflexive candidate", zap.Stringer("addr", mappedAddr))
+	mapped := Addr{IP: mappedAddr.IP, Port: mappedAddr.Port, Proto: ct.UDP}
+	if mapped.Equal(c.candidate.Addr) {
+		// Host is not behind NAT.
+		return nil, nil
+	}
+	r := Candidate{
+		Addr:            mapped,
+		Base:            c.candidate.Addr,
+		Related:         c.candidate.Addr,
+		Type:            ct.ServerReflexive,
+		ComponentID:     c.candidate.ComponentID,
+		LocalPreference: c.candidate.LocalPreference,
+		NetworkCost:     c.candidate.NetworkCost,
+	}
+	r.Foundation = Foundation(&r, Addr{IP: addr.IP, Port: addr.Port, Proto: ct.UDP})
+	r.Priority = Priority(TypePreference(r.Type), r.LocalPreference, r.ComponentID)
+	return &localUDPCandidate{
+		candidate: r,
+		conn:      c.conn,
+		stream:    c.stream,
+	}, nil
 }
 
+// gatherServerReflexiveCandidatesFor gathers server reflexive candidates
+// for IPv4 host candidates of data stream, skipping redundant ones.
 func (a *Agent) gatherServerReflexiveCandidatesFor(streamID int) error {
+	a.mux.Lock()
 	localCandidates := a.localCandidates[streamID]
+	a.mux.Unlock()
+	var gathered []*localUDPCandidate
 	for _, c := range localCandidates {
-		if c.candidate.Addr.IP.To4() == nil {
+		if c.candidate.Type != ct.Host || c.candidate.Addr.IP.To4() == nil {
 			continue
 		}
 		for _, s := range a.stun {
@@ -167,45 +339,110 @@ func (a *Agent) gatherServerReflexiveCandidatesFor(streamID int) error {
 				zap.Stringer("addr", c.candidate.Addr),
 			)
 			log.Debug("gathering server-reflexive candidates")
-			if err := a.gatherServerReflexiveCandidates(log, c, s); err != nil {
-				log.Error("failed to gather server reflexive candidates")
+			r, err := a.gatherServerReflexiveCandidate(log, c, s)
+			if err != nil {
+				log.Error("failed to gather server reflexive candidates", zap.Error(err))
+				continue
 			}
+			if r == nil || hasLocalCandidate(localCandidates, r.candidate) || hasLocalCandidate(gathered, r.candidate) {
+				continue
+			}
+			gathered = append(gathered, r)
 		}
 	}
+	if len(gathered) == 0 {
+		return nil
+	}
+	a.mux.Lock()
+	a.localCandidates[streamID] = append(a.localCandidates[streamID], gathered...)
+	a.mux.Unlock()
+	a.startCandidates(gathered)
 	return nil
 }
 
-func (a *Agent) gatherRelayedCandidates(log *zap.Logger, c *localUDPCandidate, s turnServerOptions) error {
+// hasLocalCandidate reports whether candidates contain candidate with same
+// address and base as c.
+func hasLocalCandidate(candidates []*localUDPCandidate, c Candidate) bool {
+	for _, l := range candidates {
+		if l.candidate.Addr.Equal(c.Addr) && l.candidate.Base.Equal(c.Base) {
+			return true
+		}
+	}
+	return false
+}
+
+// gatherRelayedCandidate returns relayed candidate that is allocated on
+// TURN server via socket of host candidate c, or nil if allocation failed.
+func (a *Agent) gatherRelayedCandidate(log *zap.Logger, c *localUDPCandidate, s turnServerOptions) (*localUDPCandidate, error) {
+	defer a.timeGathering(ct.Relayed, a.clock())
 	addr, err := resolveTURN(s.uri)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	conn := c.Pipe(addr)
 	client, err := turnc.New(turnc.Options{
-		Conn:     c.Pipe(addr),
+		Conn:     conn,
 		Username: s.username,
 		Password: s.password,
 		Log:      a.log.Named("turn").With(zap.Stringer("local", c.candidate.Addr)),
 		RTO:      a.ta / 2, // TODO: setup correct RTO
 	})
 	if err != nil {
-		return err
+		_ = conn.Close()
+		return nil, err
 	}
 	alloc, err := client.Allocate()
 	if err != nil {
 		log.Warn("failed to allocate", zap.Error(err))
-		return nil
+		_ = client.Close()
+		_ = conn.Close()
+		return nil, nil
 	}
-	c.mux.Lock()
-	c.alloc = alloc
-	c.mux.Unlock()
-	log.Debug("turn allocated")
-	return nil
+	relayed := alloc.Relayed()
+	r := Candidate{
+		Addr:            Addr{IP: relayed.IP, Port: relayed.Port, Proto: ct.UDP},
+		Type:            ct.Relayed,
+		ComponentID:     c.candidate.ComponentID,
+		LocalPreference: c.candidate.LocalPreference,
+		NetworkCost:     c.candidate.NetworkCost,
+	}
+	r.Base = r.Addr
+	r.Related = a.mappedAddr(c)
+	r.Foundation = Foundation(&r, Addr{IP: addr.IP, Port: addr.Port, Proto: ct.UDP})
+	r.Priority = Priority(TypePreference(r.Type), r.LocalPreference, r.ComponentID)
+	log.Debug("turn allocated", zap.Stringer("relayed", r.Addr))
+	release := func() error { return a.releaseAllocation(c, addr, s) }
+	return &localUDPCandidate{
+		candidate: r,
+		conn:      newRelayConn(conn, client, alloc, release, r.Addr, c.candidate.Addr),
+		stream:    c.stream,
+	}, nil
 }
 
+// mappedAddr returns address of server reflexive candidate with host
+// candidate c as base to be used as related address of relayed candidate,
+// or unspecified address if there is no such candidate, so host address is
+// not exposed.
+func (a *Agent) mappedAddr(c *localUDPCandidate) Addr {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	for _, l := range a.localCandidates[c.stream] {
+		if l.candidate.Type == ct.ServerReflexive && l.candidate.Base.Equal(c.candidate.Addr) {
+			return l.candidate.Addr
+		}
+	}
+	return Addr{IP: net.IPv4zero, Proto: ct.UDP}
+}
+
+// gatherRelayedCandidatesFor gathers relayed candidates for IPv4 host
+// candidates of data stream.
 func (a *Agent) gatherRelayedCandidatesFor(streamID int) error {
+	a.mux.Lock()
 	localCandidates := a.localCandidates[streamID]
+	a.mux.Unlock()
+	var gathered []*localUDPCandidate
 	for _, c := range localCandidates {
-		if c.candidate.Addr.IP.To4() == nil {
+		if c.candidate.Type != ct.Host || c.candidate.Addr.IP.To4() == nil {
 			continue
 		}
 		for _, s := range a.turn {
@@ -214,11 +451,24 @@ func (a *Agent) gatherRelayedCandidatesFor(streamID int) error {
 				zap.Stringer("addr", c.candidate.Addr),
 			)
 			log.Debug("gathering relayed candidates")
-			if err := a.gatherRelayedCandidates(log, c, s); err != nil {
-				log.Error("failed to gather relayed candidates")
+			r, err := a.gatherRelayedCandidate(log, c, s)
+			if err != nil {
+				log.Error("failed to gather relayed candidates", zap.Error(err))
+				continue
 			}
+			if r == nil {
+				continue
+			}
+			gathered = append(gathered, r)
 		}
 	}
+	if len(gathered) == 0 {
+		return nil
+	}
+	a.mux.Lock()
+	a.localCandidates[streamID] = append(a.localCandidates[streamID], gathered...)
+	a.mux.Unlock()
+	a.startCandidates(gathered)
 	return nil
 }
 
@@ -227,7 +477,6 @@ type localUDPCandidate struct {
 	candidate Candidate
 	conn      net.PacketConn
 	stream    int
-	alloc     *turnc.Allocation
 
 	pipes []localPipe
 	mux   sync.Mutex
@@ -243,8 +492,8 @@ func (c *localUDPCandidate) Pipe(addr *net.UDPAddr) net.Conn {
 	})
 	c.mux.Unlock()
 	go func() {
+		buf := make([]byte, maxPacketSize)
 		for {
-			buf := make([]byte, 1024)
 			n, readErr := rconn.Read(buf)
 			if readErr != nil {
 				break
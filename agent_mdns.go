@@ -0,0 +1,173 @@
+package ice
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"go.uber.org/zap"
+
+	ct "gortc.io/ice/candidate"
+)
+
+// MulticastDNSMode represents usage of mDNS for host candidates.
+//
+// See https://tools.ietf.org/html/draft-ietf-mmusic-mdns-ice-candidates.
+type MulticastDNSMode byte
+
+const (
+	// MulticastDNSDisabled disables mDNS, so remote candidates with ".local"
+	// host names are ignored.
+	MulticastDNSDisabled MulticastDNSMode = iota
+	// MulticastDNSQueryOnly enables resolving of remote candidates with
+	// ".local" host names.
+	MulticastDNSQueryOnly
+	// MulticastDNSQueryAndGather is MulticastDNSQueryOnly that also publishes
+	// local host candidates under random ".local" names, so host IP addresses
+	// are not exposed in LocalCandidates.
+	MulticastDNSQueryAndGather
+)
+
+var multicastDNSModeToStr = map[MulticastDNSMode]string{
+	MulticastDNSDisabled:       "disabled",
+	MulticastDNSQueryOnly:      "query-only",
+	MulticastDNSQueryAndGather: "query-and-gather",
+}
+
+func (m MulticastDNSMode) String() string {
+	if s, ok := multicastDNSModeToStr[m]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// MarshalText implements TextMarshaler.
+func (m MulticastDNSMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements TextUnmarshaler.
+func (m *MulticastDNSMode) UnmarshalText(text []byte) error {
+	for k, v := range multicastDNSModeToStr {
+		if string(text) == v {
+			*m = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown mDNS mode %q", text)
+}
+
+// multicastDNSConn is mDNS querier and responder, implemented by *mdns.Conn.
+type multicastDNSConn interface {
+	Publish(name string, ip net.IP)
+	Unpublish(name string)
+	Resolve(ctx context.Context, name string) ([]net.IP, error)
+	Close() error
+}
+
+func withMulticastDNSConn(c multicastDNSConn) AgentOption {
+	return func(a *Agent) error {
+		a.mdns = c
+		return nil
+	}
+}
+
+const multicastDNSSuffix = ".local"
+
+// isMulticastDNSName reports whether host is name in ".local" domain.
+func isMulticastDNSName(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return strings.HasSuffix(host, multicastDNSSuffix)
+}
+
+// randomMulticastDNSName returns random version 4 UUID in ".local" domain.
+func randomMulticastDNSName(r io.Reader) (string, error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant is RFC 4122
+	return fmt.Sprintf("%x-%x-%x-%x-%x%s",
+		b[0:4], b[4:6], b[6:8], b[8:10], b[10:], multicastDNSSuffix,
+	), nil
+}
+
+// publishHostCandidates publishes host candidates under random names, using
+// same name for candidates with same IP.
+func (a *Agent) publishHostCandidates(candidates []*localUDPCandidate) error {
+	names := make(map[string]string)
+	for _, c := range candidates {
+		if c.candidate.Type != ct.Host {
+			continue
+		}
+		ip := c.candidate.Addr.IP
+		name, ok := names[ip.String()]
+		if !ok {
+			var err error
+			if name, err = randomMulticastDNSName(a.rand); err != nil {
+				return err
+			}
+			names[ip.String()] = name
+			a.mdns.Publish(name, ip)
+			a.log.Debug("published host candidate",
+				zap.Stringer("ip", ip), zap.String("name", name),
+			)
+		}
+		c.candidate.Addr.Host = name
+		a.mux.Lock()
+		if a.published == nil {
+			a.published = make(map[string]int)
+		}
+		a.published[name]++
+		a.mux.Unlock()
+	}
+	return nil
+}
+
+// unpublishHostCandidates unpublishes names of removed host candidates that
+// are not used by other local candidates. Should be called with a.mux held.
+func (a *Agent) unpublishHostCandidates(candidates []*localUDPCandidate) {
+	for _, c := range candidates {
+		name := c.candidate.Addr.Host
+		if c.candidate.Type != ct.Host || a.published[name] == 0 {
+			continue
+		}
+		a.published[name]--
+		if a.published[name] > 0 {
+			continue
+		}
+		delete(a.published, name)
+		a.mdns.Unpublish(name)
+		a.log.Debug("unpublished host candidate", zap.String("name", name))
+	}
+}
+
+// hideHostAddr returns copy of local candidate that does not expose host IP
+// address if host candidates are published via mDNS. Host candidates are
+// left only with published name, and related address of other candidates
+// is replaced with unspecified one.
+func (a *Agent) hideHostAddr(c Candidate) Candidate {
+	if a.mdnsMode != MulticastDNSQueryAndGather {
+		return c
+	}
+	if c.Type == ct.Host {
+		if c.Addr.Host != "" {
+			c.Addr.IP = nil
+			c.Base = Addr{}
+		}
+		return c
+	}
+	c.Base = Addr{}
+	if len(c.Related.IP) == 0 {
+		return c
+	}
+	related := Addr{IP: net.IPv6unspecified, Proto: c.Related.Proto}
+	if c.Related.IP.To4() != nil {
+		related.IP = net.IPv4zero
+	}
+	c.Related = related
+	return c
+}
@@ -0,0 +1,324 @@
+package ice
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/ice/gather"
+	"gortc.io/ice/mdns"
+)
+
+// multicastDNSRegistry emulates mDNS, sharing published names between
+// connections.
+type multicastDNSRegistry struct {
+	mux   sync.Mutex
+	names map[string]net.IP
+}
+
+func (r *multicastDNSRegistry) Publish(name string, ip net.IP) {
+	r.mux.Lock()
+	r.names[strings.ToLower(name)] = ip
+	r.mux.Unlock()
+}
+
+func (r *multicastDNSRegistry) Unpublish(name string) {
+	r.mux.Lock()
+	delete(r.names, strings.ToLower(name))
+	r.mux.Unlock()
+}
+
+func (r *multicastDNSRegistry) Resolve(ctx context.Context, name string) ([]net.IP, error) {
+	r.mux.Lock()
+	ip, ok := r.names[strings.ToLower(name)]
+	r.mux.Unlock()
+	if !ok {
+		return nil, mdns.ErrClosed
+	}
+	return []net.IP{ip}, nil
+}
+
+func (r *multicastDNSRegistry) Close() error { return nil }
+
+func hostGatherer(ip net.IP, port int) *mockGatherer {
+	return &mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			a := Addr{
+				IP:    ip,
+				Port:  port,
+				Proto: candidate.UDP,
+			}
+			c := Candidate{
+				Base:        a,
+				Addr:        a,
+				Type:        candidate.Host,
+				ComponentID: 1,
+			}
+			c.Foundation = Foundation(&c, Addr{})
+			c.Priority = Priority(TypePreference(c.Type), singleIPAddrPreference, c.ComponentID)
+			return []*localUDPCandidate{{candidate: c, conn: mockPacketConn{}}}, nil
+		},
+	}
+}
+
+func TestAgent_MulticastDNS(t *testing.T) {
+	registry := &multicastDNSRegistry{names: make(map[string]net.IP)}
+	a, err := NewAgent(
+		withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)),
+		withMulticastDNSConn(registry),
+		WithMulticastDNS(MulticastDNSQueryAndGather),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	aCandidates, err := a.LocalCandidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range aCandidates {
+		if len(c.Addr.IP) != 0 || len(c.Base.IP) != 0 {
+			t.Errorf("host IP is exposed: %s", c.Addr)
+		}
+		if !isMulticastDNSName(c.Addr.Host) {
+			t.Errorf("unexpected host %q", c.Addr.Host)
+		}
+	}
+	t.Run("QueryOnly", func(t *testing.T) {
+		b, err := NewAgent(
+			withGatherer(hostGatherer(net.IPv4(10, 0, 0, 2), 2000)),
+			withMulticastDNSConn(registry),
+			WithMulticastDNS(MulticastDNSQueryOnly),
+			WithRole(Controlled),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mustClose(t, b)
+		if err = b.GatherCandidates(); err != nil {
+			t.Fatal(err)
+		}
+		if err = b.AddRemoteCandidates(aCandidates); err != nil {
+			t.Fatal(err)
+		}
+		if err = b.PrepareChecklistSet(); err != nil {
+			t.Fatal(err)
+		}
+		if len(b.set[0].Pairs) != 1 {
+			t.Fatalf("unexpected pairs count %d", len(b.set[0].Pairs))
+		}
+		remote := b.set[0].Pairs[0].Remote
+		if !remote.Addr.IP.Equal(net.IPv4(10, 0, 0, 1)) {
+			t.Errorf("unexpected remote %s", remote.Addr)
+		}
+		if !bytes.Equal(remote.Foundation, aCandidates[0].Foundation) {
+			t.Error("foundation mismatch")
+		}
+		bCandidates, err := b.LocalCandidates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(bCandidates[0].Addr.IP) == 0 {
+			t.Error("query-only agent should not hide host IP")
+		}
+	})
+	t.Run("Disabled", func(t *testing.T) {
+		b, err := NewAgent(withGatherer(hostGatherer(net.IPv4(10, 0, 0, 2), 2000)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mustClose(t, b)
+		if err = b.GatherCandidates(); err != nil {
+			t.Fatal(err)
+		}
+		if err = b.AddRemoteCandidates(aCandidates); err != nil {
+			t.Fatal(err)
+		}
+		if err = b.PrepareChecklistSet(); err != nil {
+			t.Fatal(err)
+		}
+		if len(b.set[0].Pairs) != 0 {
+			t.Errorf("unexpected pairs count %d", len(b.set[0].Pairs))
+		}
+	})
+}
+
+func (r *multicastDNSRegistry) count() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.names)
+}
+
+func TestAgent_MulticastDNSUnpublish(t *testing.T) {
+	newAgent := func(t *testing.T) (*Agent, *multicastDNSRegistry) {
+		registry := &multicastDNSRegistry{names: make(map[string]net.IP)}
+		a, err := NewAgent(
+			withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)),
+			withMulticastDNSConn(registry),
+			WithMulticastDNS(MulticastDNSQueryAndGather),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, mid := range []string{"audio", "video"} {
+			if _, err = a.AddStream(mid); err != nil {
+				t.Fatal(err)
+			}
+			if err = a.GatherCandidatesForMid(mid); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if registry.count() != 2 {
+			t.Fatalf("unexpected published count %d", registry.count())
+		}
+		return a, registry
+	}
+	t.Run("Close", func(t *testing.T) {
+		a, registry := newAgent(t)
+		mustClose(t, a)
+		if registry.count() != 0 {
+			t.Errorf("unexpected published count %d", registry.count())
+		}
+	})
+	t.Run("RemoveStream", func(t *testing.T) {
+		a, registry := newAgent(t)
+		defer mustClose(t, a)
+		if err := a.RemoveStream("audio"); err != nil {
+			t.Fatal(err)
+		}
+		if registry.count() != 1 {
+			t.Errorf("unexpected published count %d", registry.count())
+		}
+	})
+	t.Run("RemoveHostAddr", func(t *testing.T) {
+		a, registry := newAgent(t)
+		defer mustClose(t, a)
+		a.removeHostAddr(gather.Addr{IP: net.IPv4(10, 0, 0, 1)})
+		if registry.count() != 0 {
+			t.Errorf("unexpected published count %d", registry.count())
+		}
+	})
+}
+
+func TestAgent_hideHostAddr(t *testing.T) {
+	host := Addr{IP: net.IPv4(10, 0, 0, 1), Port: 1000, Host: "host.local", Proto: candidate.UDP}
+	for _, tc := range []struct {
+		Name    string
+		Mode    MulticastDNSMode
+		In, Out Candidate
+	}{
+		{
+			Name: "Host",
+			Mode: MulticastDNSQueryAndGather,
+			In:   Candidate{Type: candidate.Host, Addr: host, Base: host},
+			Out: Candidate{Type: candidate.Host, Addr: Addr{
+				Port: 1000, Host: "host.local", Proto: candidate.UDP,
+			}},
+		},
+		{
+			Name: "ServerReflexive",
+			Mode: MulticastDNSQueryAndGather,
+			In: Candidate{
+				Type:    candidate.ServerReflexive,
+				Addr:    Addr{IP: net.IPv4(1, 1, 1, 1), Port: 2000, Proto: candidate.UDP},
+				Base:    host,
+				Related: host,
+			},
+			Out: Candidate{
+				Type:    candidate.ServerReflexive,
+				Addr:    Addr{IP: net.IPv4(1, 1, 1, 1), Port: 2000, Proto: candidate.UDP},
+				Related: Addr{IP: net.IPv4zero, Proto: candidate.UDP},
+			},
+		},
+		{
+			Name: "ServerReflexiveIPv6",
+			Mode: MulticastDNSQueryAndGather,
+			In: Candidate{
+				Type:    candidate.ServerReflexive,
+				Related: Addr{IP: net.ParseIP("fe80::1"), Port: 1000},
+			},
+			Out: Candidate{
+				Type:    candidate.ServerReflexive,
+				Related: Addr{IP: net.IPv6unspecified},
+			},
+		},
+		{
+			Name: "QueryOnly",
+			Mode: MulticastDNSQueryOnly,
+			In: Candidate{
+				Type:    candidate.ServerReflexive,
+				Related: host,
+			},
+			Out: Candidate{
+				Type:    candidate.ServerReflexive,
+				Related: host,
+			},
+		},
+	} {
+		t.Run(tc.Name, func(t *testing.T) {
+			a := &Agent{mdnsMode: tc.Mode}
+			if got := a.hideHostAddr(tc.In); !got.Equal(&tc.Out) {
+				t.Errorf("%+v (got) != %+v (expected)", got, tc.Out)
+			}
+		})
+	}
+}
+
+// blockingMulticastDNSConn resolves names only when context is done.
+type blockingMulticastDNSConn struct {
+	multicastDNSRegistry
+}
+
+func (*blockingMulticastDNSConn) Resolve(ctx context.Context, name string) ([]net.IP, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestAgent_CloseResolving(t *testing.T) {
+	a, err := NewAgent(
+		withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)),
+		withMulticastDNSConn(&blockingMulticastDNSConn{}),
+		WithMulticastDNS(MulticastDNSQueryOnly),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	remote := Candidate{
+		Addr:        Addr{Host: "remote.local", Port: 2000, Proto: candidate.UDP},
+		Type:        candidate.Host,
+		ComponentID: 1,
+	}
+	if err = a.AddRemoteCandidates([]Candidate{remote}); err != nil {
+		t.Fatal(err)
+	}
+	// Close cancels resolving and waits for it.
+	mustClose(t, a)
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if len(a.remoteCandidates[0]) != 0 {
+		t.Error("unexpected remote candidates")
+	}
+}
+
+func TestRandomMulticastDNSName(t *testing.T) {
+	name, err := randomMulticastDNSName(bytes.NewReader(make([]byte, 16)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "00000000-0000-4000-8000-000000000000.local" {
+		t.Errorf("unexpected name %q", name)
+	}
+	if _, err = randomMulticastDNSName(bytes.NewReader(nil)); err == nil {
+		t.Error("should error")
+	}
+}
@@ -0,0 +1,155 @@
+package ice
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	ct "gortc.io/ice/candidate"
+)
+
+// NAT1To1Mode represents usage of 1:1 NAT mapping of host addresses to
+// public ones, e.g. on cloud instances with static public IP.
+type NAT1To1Mode byte
+
+const (
+	// NAT1To1Host replaces IP address of host candidates with the mapped
+	// public one, keeping the local one as base.
+	NAT1To1Host NAT1To1Mode = iota
+	// NAT1To1ServerReflexive keeps host candidates and adds server reflexive
+	// candidate with mapped public IP for each of them, like STUN server
+	// would do.
+	NAT1To1ServerReflexive
+)
+
+var nat1To1ModeToStr = map[NAT1To1Mode]string{
+	NAT1To1Host:            "host",
+	NAT1To1ServerReflexive: "srflx",
+}
+
+func (m NAT1To1Mode) String() string {
+	if s, ok := nat1To1ModeToStr[m]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+var (
+	errNATInvalidIP       = errors.New("invalid IP address in 1:1 NAT mapping")
+	errNATFamilyMismatch  = errors.New("public and local IP address families differ in 1:1 NAT mapping")
+	errNATAmbiguous       = errors.New("ambiguous 1:1 NAT mapping")
+	errNATMulticastDNS    = errors.New("1:1 NAT mapping of host candidates conflicts with mDNS gathering")
+	errNATUnsupportedMode = errors.New("unsupported 1:1 NAT mapping mode")
+)
+
+// natMapping maps local host IP addresses to public ones.
+type natMapping struct {
+	mode  NAT1To1Mode
+	ipv4  net.IP            // for any local IPv4 address
+	ipv6  net.IP            // for any local IPv6 address
+	local map[string]net.IP // by local IP
+}
+
+// parseNATMapping parses list of "public" or "public/local" IP addresses.
+//
+// Single public IP without local one is used for all host addresses of same
+// family, so it can't be mixed with explicit mappings of that family.
+func parseNATMapping(mode NAT1To1Mode, ips []string) (*natMapping, error) {
+	if _, ok := nat1To1ModeToStr[mode]; !ok {
+		return nil, errNATUnsupportedMode
+	}
+	m := &natMapping{
+		mode:  mode,
+		local: make(map[string]net.IP),
+	}
+	var explicitIPv4, explicitIPv6 bool
+	for _, s := range ips {
+		parts := strings.SplitN(s, "/", 2)
+		public := net.ParseIP(parts[0])
+		if public == nil {
+			return nil, errNATInvalidIP
+		}
+		isIPv4 := public.To4() != nil
+		if len(parts) == 1 {
+			sole := &m.ipv6
+			explicit := explicitIPv6
+			if isIPv4 {
+				sole, explicit = &m.ipv4, explicitIPv4
+			}
+			if *sole != nil || explicit {
+				return nil, errNATAmbiguous
+			}
+			*sole = public
+			continue
+		}
+		local := net.ParseIP(parts[1])
+		if local == nil {
+			return nil, errNATInvalidIP
+		}
+		if !sameFamily(public, local) {
+			return nil, errNATFamilyMismatch
+		}
+		if _, ok := m.local[local.String()]; ok {
+			return nil, errNATAmbiguous
+		}
+		if isIPv4 {
+			explicitIPv4 = true
+		} else {
+			explicitIPv6 = true
+		}
+		if (isIPv4 && m.ipv4 != nil) || (!isIPv4 && m.ipv6 != nil) {
+			return nil, errNATAmbiguous
+		}
+		m.local[local.String()] = public
+	}
+	return m, nil
+}
+
+// publicIP returns public IP address that is mapped to local one.
+func (m *natMapping) publicIP(local net.IP) (net.IP, bool) {
+	if ip, ok := m.local[local.String()]; ok {
+		return ip, true
+	}
+	if local.To4() != nil {
+		return m.ipv4, m.ipv4 != nil
+	}
+	return m.ipv6, m.ipv6 != nil
+}
+
+// apply maps gathered host candidates, returning resulting candidate list.
+func (m *natMapping) apply(candidates []*localUDPCandidate) []*localUDPCandidate {
+	result := make([]*localUDPCandidate, 0, len(candidates))
+	for _, c := range candidates {
+		result = append(result, c)
+		if c.candidate.Type != ct.Host {
+			continue
+		}
+		ip, ok := m.publicIP(c.candidate.Base.IP)
+		if !ok {
+			continue
+		}
+		addr := c.candidate.Addr
+		addr.IP = ip
+		switch m.mode {
+		case NAT1To1Host:
+			c.candidate.Addr = addr
+		case NAT1To1ServerReflexive:
+			s := Candidate{
+				Addr:            addr,
+				Base:            c.candidate.Base,
+				Related:         c.candidate.Base,
+				Type:            ct.ServerReflexive,
+				ComponentID:     c.candidate.ComponentID,
+				LocalPreference: c.candidate.LocalPreference,
+				NetworkCost:     c.candidate.NetworkCost,
+			}
+			s.Foundation = Foundation(&s, Addr{})
+			s.Priority = Priority(TypePreference(s.Type), s.LocalPreference, s.ComponentID)
+			result = append(result, &localUDPCandidate{
+				candidate: s,
+				conn:      c.conn,
+			})
+		}
+	}
+	return result
+}
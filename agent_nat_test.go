@@ -0,0 +1,187 @@
+package ice
+
+import (
+	"net"
+	"testing"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/ice/sdp"
+)
+
+func TestParseNATMapping(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ips  []string
+		err  error
+	}{
+		{name: "Sole", ips: []string{"1.2.3.4"}},
+		{name: "SoleDualStack", ips: []string{"1.2.3.4", "2001:db8::1"}},
+		{name: "Explicit", ips: []string{"1.2.3.4/10.0.0.1", "1.2.3.5/10.0.0.2"}},
+		{name: "SoleIPv4ExplicitIPv6", ips: []string{"1.2.3.4", "2001:db8::1/fd00::1"}},
+		{name: "InvalidPublic", ips: []string{"1.2.3"}, err: errNATInvalidIP},
+		{name: "InvalidLocal", ips: []string{"1.2.3.4/10.0.0"}, err: errNATInvalidIP},
+		{name: "FamilyMismatch", ips: []string{"1.2.3.4/fd00::1"}, err: errNATFamilyMismatch},
+		{name: "TwoSole", ips: []string{"1.2.3.4", "1.2.3.5"}, err: errNATAmbiguous},
+		{name: "SoleThenExplicit", ips: []string{"1.2.3.4", "1.2.3.5/10.0.0.1"}, err: errNATAmbiguous},
+		{name: "ExplicitThenSole", ips: []string{"1.2.3.5/10.0.0.1", "1.2.3.4"}, err: errNATAmbiguous},
+		{name: "DuplicateLocal", ips: []string{"1.2.3.4/10.0.0.1", "1.2.3.5/10.0.0.1"}, err: errNATAmbiguous},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := parseNATMapping(NAT1To1Host, tc.ips); err != tc.err {
+				t.Errorf("%v (got) != %v (expected)", err, tc.err)
+			}
+		})
+	}
+	t.Run("UnsupportedMode", func(t *testing.T) {
+		if _, err := parseNATMapping(NAT1To1Mode(100), nil); err != errNATUnsupportedMode {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+func TestAgent_NAT1To1(t *testing.T) {
+	gatherer := &mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			var candidates []*localUDPCandidate
+			for _, ip := range []net.IP{
+				net.IPv4(10, 0, 0, 1), net.IPv4(10, 0, 0, 2), net.ParseIP("fd00::1"),
+			} {
+				a := Addr{IP: ip, Port: 1000, Proto: candidate.UDP}
+				c := Candidate{Base: a, Addr: a, Type: candidate.Host, ComponentID: 1}
+				c.Foundation = Foundation(&c, Addr{})
+				c.Priority = Priority(TypePreference(c.Type), singleIPAddrPreference, c.ComponentID)
+				candidates = append(candidates, &localUDPCandidate{candidate: c, conn: mockPacketConn{}})
+			}
+			return candidates, nil
+		},
+	}
+	type expected struct {
+		t    candidate.Type
+		ip   string
+		base string
+	}
+	for _, tc := range []struct {
+		name     string
+		mode     NAT1To1Mode
+		ips      []string
+		expected []expected
+	}{
+		{
+			name: "Host",
+			mode: NAT1To1Host,
+			ips:  []string{"1.2.3.4/10.0.0.1", "2001:db8::1"},
+			expected: []expected{
+				{t: candidate.Host, ip: "1.2.3.4", base: "10.0.0.1"},
+				{t: candidate.Host, ip: "10.0.0.2", base: "10.0.0.2"},
+				{t: candidate.Host, ip: "2001:db8::1", base: "fd00::1"},
+			},
+		},
+		{
+			name: "ServerReflexive",
+			mode: NAT1To1ServerReflexive,
+			ips:  []string{"1.2.3.4"},
+			expected: []expected{
+				{t: candidate.Host, ip: "10.0.0.1", base: "10.0.0.1"},
+				{t: candidate.ServerReflexive, ip: "1.2.3.4", base: "10.0.0.1"},
+				{t: candidate.Host, ip: "10.0.0.2", base: "10.0.0.2"},
+				{t: candidate.ServerReflexive, ip: "1.2.3.4", base: "10.0.0.2"},
+				{t: candidate.Host, ip: "fd00::1", base: "fd00::1"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := NewAgent(withGatherer(gatherer), WithNAT1To1IPs(tc.mode, tc.ips...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mustClose(t, a)
+			if err = a.GatherCandidates(); err != nil {
+				t.Fatal(err)
+			}
+			candidates, err := a.LocalCandidates()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(candidates) != len(tc.expected) {
+				t.Fatalf("unexpected candidates: %v", candidates)
+			}
+			for i, e := range tc.expected {
+				c := candidates[i]
+				if c.Type != e.t || c.Addr.IP.String() != e.ip || c.Base.IP.String() != e.base {
+					t.Errorf("[%d] %s %s (base %s) (got) != %s %s (base %s) (expected)",
+						i, c.Type, c.Addr.IP, c.Base.IP, e.t, e.ip, e.base,
+					)
+				}
+				if c.Type == candidate.ServerReflexive && c.Priority >= candidates[i-1].Priority {
+					t.Errorf("[%d] server reflexive priority should be lower than host", i)
+				}
+			}
+		})
+	}
+	t.Run("StrictSDP", func(t *testing.T) {
+		for _, tc := range []struct {
+			name    string
+			opts    []AgentOption
+			related []string
+		}{
+			{
+				name:    "Plain",
+				related: []string{"10.0.0.1", "10.0.0.2"},
+			},
+			{
+				name: "MulticastDNS",
+				opts: []AgentOption{
+					withMulticastDNSConn(&multicastDNSRegistry{names: make(map[string]net.IP)}),
+					WithMulticastDNS(MulticastDNSQueryAndGather),
+				},
+				related: []string{"0.0.0.0", "0.0.0.0"},
+			},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				a, err := NewAgent(append(tc.opts,
+					withGatherer(gatherer), WithNAT1To1IPs(NAT1To1ServerReflexive, "1.2.3.4"),
+				)...)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer mustClose(t, a)
+				if err = a.GatherCandidates(); err != nil {
+					t.Fatal(err)
+				}
+				candidates, err := a.LocalCandidates()
+				if err != nil {
+					t.Fatal(err)
+				}
+				var related []string
+				for _, c := range candidates {
+					v := CandidateToSDP(c).String()
+					var s sdp.Candidate
+					if err = sdp.ParseAttributeStrict([]byte(v), &s); err != nil {
+						t.Fatalf("%s: %v", v, err)
+					}
+					parsed := CandidateFromSDP(&s)
+					if parsed.Type == candidate.ServerReflexive {
+						related = append(related, parsed.Related.IP.String())
+					}
+				}
+				if len(related) != len(tc.related) {
+					t.Fatalf("unexpected related addresses %v", related)
+				}
+				for i := range related {
+					if related[i] != tc.related[i] {
+						t.Errorf("[%d] %s (got) != %s (expected)", i, related[i], tc.related[i])
+					}
+				}
+			})
+		}
+	})
+	t.Run("MulticastDNS", func(t *testing.T) {
+		_, err := NewAgent(
+			WithMulticastDNS(MulticastDNSQueryAndGather),
+			WithNAT1To1IPs(NAT1To1Host, "1.2.3.4"),
+		)
+		if err != errNATMulticastDNS {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
@@ -2,11 +2,14 @@ package ice
 
 import (
 	"errors"
+	"io"
 	"strings"
 	"time"
 
 	"go.uber.org/zap"
 
+	"gortc.io/ice/gather"
+	"gortc.io/ice/internal/pcapng"
 	"gortc.io/stun"
 	"gortc.io/turn"
 )
@@ -30,9 +33,12 @@ func WithLogger(l *zap.Logger) AgentOption {
 	}
 }
 
-// WithServer configures ICE server or servers for Agent.
+// WithServer configures ICE server or servers for Agent. Server reflexive
+// candidates are gathered via STUN servers and relayed ones via TURN
+// servers, for IPv4 host candidates.
 func WithServer(servers ...Server) AgentOption {
 	return func(a *Agent) error {
+		a.servers = append(a.servers, servers...)
 		for _, s := range servers {
 			for _, uri := range s.URI {
 				if strings.HasPrefix(uri, stun.Scheme) {
@@ -62,7 +68,8 @@ func WithServer(servers ...Server) AgentOption {
 	}
 }
 
-// WithSTUN configures Agent to use STUN server.
+// WithSTUN configures Agent to use STUN server, gathering server reflexive
+// candidates for IPv4 host candidates that are behind NAT.
 //
 // Use WithServer to add STUN with credentials or multiple servers at once.
 func WithSTUN(uri string) AgentOption {
@@ -120,3 +127,201 @@ func WithMaxAttempts(n int) AgentOption {
 		return nil
 	}
 }
+
+// WithMulticastDNS sets mDNS mode for host candidates.
+//
+// Agent will use IPv4 mDNS group on default interface if mode is not
+// MulticastDNSDisabled.
+func WithMulticastDNS(mode MulticastDNSMode) AgentOption {
+	return func(a *Agent) error {
+		a.mdnsMode = mode
+		return nil
+	}
+}
+
+// WithResolver sets Resolver for remote candidates with host names,
+// net.DefaultResolver is used by default.
+func WithResolver(r Resolver) AgentOption {
+	return func(a *Agent) error {
+		a.resolver = r
+		return nil
+	}
+}
+
+var errInvalidPortRange = errors.New("port range should be within 1-65535 and min should not exceed max")
+
+// WithPortRange restricts ports of host candidates to [minPort, maxPort]
+// range. Ports in range are tried in order until available one is found, so
+// gathering fails with PortsExhaustedError if all ports are in use.
+func WithPortRange(minPort, maxPort int) AgentOption {
+	return func(a *Agent) error {
+		if minPort < 1 || maxPort > 65535 || minPort > maxPort {
+			return errInvalidPortRange
+		}
+		a.portMin = minPort
+		a.portMax = maxPort
+		return nil
+	}
+}
+
+var errInvalidPort = errors.New("port should be within 1-65535")
+
+// WithPorts sets explicit list of ports for host candidates, overriding
+// WithPortRange. First available port from list is used for each candidate,
+// so gathering fails with PortsExhaustedError if all ports are in use.
+func WithPorts(ports ...int) AgentOption {
+	return func(a *Agent) error {
+		for _, port := range ports {
+			if port < 1 || port > 65535 {
+				return errInvalidPort
+			}
+		}
+		a.ports = append(a.ports[:0], ports...)
+		return nil
+	}
+}
+
+// WithUDPMux configures Agent to gather host candidates on shared sockets of
+// UDPMux instead of binding new ones, so port options are not used. Address
+// filter, policy table and IPv6 link-local options select and order the
+// sockets.
+func WithUDPMux(m *UDPMux) AgentOption {
+	return func(a *Agent) error {
+		a.gatherer = m
+		return nil
+	}
+}
+
+var errSTUNHandler = errors.New("STUN packets are handled by agent")
+
+// WithPacketHandler registers handler for packets of provided type that are
+// received on candidate sockets, so DTLS, SRTP and other protocols can share
+// sockets with ICE. STUN packets are always handled by Agent.
+func WithPacketHandler(t PacketType, h PacketHandler) AgentOption {
+	return func(a *Agent) error {
+		if t == PacketSTUN {
+			return errSTUNHandler
+		}
+		if a.packetHandlers == nil {
+			a.packetHandlers = make(map[PacketType]PacketHandler)
+		}
+		a.packetHandlers[t] = h
+		return nil
+	}
+}
+
+// WithNAT1To1IPs configures 1:1 NAT mapping of host candidate IP addresses
+// to public ones, which is useful on hosts with static public IP, like cloud
+// instances, where no STUN server is needed to discover it.
+//
+// Each value is either "public" IP, which is used for all host addresses of
+// same family, or "public/local" pair for explicit mapping. The mode sets
+// whether host candidates are replaced or server reflexive ones are added.
+func WithNAT1To1IPs(mode NAT1To1Mode, ips ...string) AgentOption {
+	return func(a *Agent) error {
+		m, err := parseNATMapping(mode, ips)
+		if err != nil {
+			return err
+		}
+		a.nat = m
+		return nil
+	}
+}
+
+// WithAddrFilter sets policy for host addresses that are used in gathering.
+// Addresses of UDPMux sockets are not filtered.
+func WithAddrFilter(f AddrFilter) AgentOption {
+	return func(a *Agent) error {
+		if err := f.validate(); err != nil {
+			return err
+		}
+		a.filter = &f
+		return nil
+	}
+}
+
+// WithNetworkWatcher configures Agent to gather host candidates on addresses
+// that are added while it is running and to fail pairs on removed ones, so
+// connectivity can be restored on other interface. New candidates are passed
+// to CandidateHandler. Watcher is closed by Agent.Close.
+func WithNetworkWatcher(w gather.Watcher) AgentOption {
+	return func(a *Agent) error {
+		a.watcher = w
+		return nil
+	}
+}
+
+// WithCandidateHandler sets handler for local candidates that are gathered
+// while agent is running.
+func WithCandidateHandler(h CandidateHandler) AgentOption {
+	return func(a *Agent) error {
+		a.onCandidate = h
+		return nil
+	}
+}
+
+// WithIPv6LinkLocal enables host candidates on IPv6 link-local addresses,
+// which are not gathered by default, so hosts on same link without global
+// addresses can connect. Such candidates are paired only with link-local
+// remote candidates.
+var WithIPv6LinkLocal AgentOption = func(a *Agent) error {
+	a.linkLocal = true
+	return nil
+}
+
+// WithPolicyTable sets RFC 6724 policy table that is used to order host
+// addresses and candidate pairs with equal priority instead of the default
+// one, e.g. to prefer IPv4 over IPv6.
+func WithPolicyTable(t gather.PolicyTable) AgentOption {
+	return func(a *Agent) error {
+		a.policy = t
+		return nil
+	}
+}
+
+// WithCandidatePolicy sets policy that controls which local candidates are
+// advertised and paired, e.g. CandidatePolicyRelay to never expose host IP
+// addresses, advertising only candidates allocated on TURN servers. Relay
+// policy requires TURN server.
+func WithCandidatePolicy(p CandidatePolicy) AgentOption {
+	return func(a *Agent) error {
+		if _, ok := candidatePolicyToStr[p]; !ok {
+			return errCandidatePolicyUnsupported
+		}
+		a.candidatePolicy = p
+		return nil
+	}
+}
+
+// WithCapture configures agent to write STUN and TURN traffic of candidate
+// sockets, including the one of STUN and TURN clients, to w in pcapng
+// format with synthesized IP and UDP headers, so it can be opened in
+// Wireshark. Data packets are not captured.
+func WithCapture(w io.Writer) AgentOption {
+	return func(a *Agent) error {
+		c, err := pcapng.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		a.capture = c
+		return nil
+	}
+}
+
+// WithTracer sets tracer that receives typed agent events, like sent
+// checks, responses and pair state changes.
+func WithTracer(t Tracer) AgentOption {
+	return func(a *Agent) error {
+		a.tracer = t
+		return nil
+	}
+}
+
+// WithMetrics sets sink of aggregate agent metrics, like sent checks and
+// time to nomination. Sink can be shared between agents.
+func WithMetrics(m Metrics) AgentOption {
+	return func(a *Agent) error {
+		a.metrics = m
+		return nil
+	}
+}
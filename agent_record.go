@@ -0,0 +1,274 @@
+package ice
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	ct "gortc.io/ice/candidate"
+	"gortc.io/ice/gather"
+)
+
+// RecordEventType is type of recorded agent input.
+type RecordEventType byte
+
+// Recorded agent inputs.
+const (
+	// RecordAgent is first event with agent configuration.
+	RecordAgent RecordEventType = iota
+	// RecordRand is read from random source.
+	RecordRand
+	// RecordLocalCredentials is call of SetLocalCredentials.
+	RecordLocalCredentials
+	// RecordRemoteCredentials is call of SetRemoteCredentials or, for
+	// media-level credentials, SetRemoteCredentialsForMid.
+	RecordRemoteCredentials
+	// RecordLocalCandidates is gathering of local candidates for stream.
+	RecordLocalCandidates
+	// RecordAddedCandidates is gathering of local candidates for added
+	// host address.
+	RecordAddedCandidates
+	// RecordRemovedAddr is removal of host address.
+	RecordRemovedAddr
+	// RecordRemovedStream is call of RemoveStream.
+	RecordRemovedStream
+	// RecordRemoteCandidates is call of AddRemoteCandidatesForStream with
+	// remote candidates that have IP address. Candidates with host name
+	// are recorded by RecordResolvedCandidates when resolved.
+	RecordRemoteCandidates
+	// RecordTrickledCandidates is addition of remote candidates to data
+	// stream that can already have them, e.g. by AddRemoteCandidateInits.
+	RecordTrickledCandidates
+	// RecordResolvedCandidates is addition of remote candidates with
+	// resolved host name.
+	RecordResolvedCandidates
+	// RecordPrepare is call of PrepareChecklistSet.
+	RecordPrepare
+	// RecordPacket is STUN packet received on candidate socket.
+	RecordPacket
+	// RecordTick is tick of Ta timer during Conclude.
+	RecordTick
+)
+
+var recordEventTypeToStr = map[RecordEventType]string{
+	RecordAgent:              "agent",
+	RecordRand:               "rand",
+	RecordLocalCredentials:   "local_credentials",
+	RecordRemoteCredentials:  "remote_credentials",
+	RecordLocalCandidates:    "local_candidates",
+	RecordAddedCandidates:    "added_candidates",
+	RecordRemovedAddr:        "removed_addr",
+	RecordRemovedStream:      "removed_stream",
+	RecordRemoteCandidates:   "remote_candidates",
+	RecordTrickledCandidates: "trickled_candidates",
+	RecordResolvedCandidates: "resolved_candidates",
+	RecordPrepare:            "prepare",
+	RecordPacket:             "packet",
+	RecordTick:               "tick",
+}
+
+func (t RecordEventType) String() string {
+	if s, ok := recordEventTypeToStr[t]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// MarshalText implements TextMarshaler.
+func (t RecordEventType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements TextUnmarshaler.
+func (t *RecordEventType) UnmarshalText(text []byte) error {
+	for k, v := range recordEventTypeToStr {
+		if string(text) == v {
+			*t = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown record event type %q", text)
+}
+
+// RecordEvent is agent input in recording. Events that change checklists,
+// like ticks and packets, include resulting checklist set and error.
+type RecordEvent struct {
+	Type RecordEventType `json:"type"`
+	Time time.Time       `json:"time"`
+
+	// Agent configuration.
+	Role            Role               `json:"role,omitempty"`
+	MaxChecks       int                `json:"max_checks,omitempty"`
+	MaxAttempts     int                `json:"max_attempts,omitempty"`
+	Ta              time.Duration      `json:"ta,omitempty"`
+	CandidatePolicy CandidatePolicy    `json:"candidate_policy,omitempty"`
+	MulticastDNS    MulticastDNSMode   `json:"mdns,omitempty"`
+	IPv4Only        bool               `json:"ipv4_only,omitempty"`
+	LinkLocal       bool               `json:"link_local,omitempty"`
+	AddrFilter      *AddrFilter        `json:"addr_filter,omitempty"`
+	PolicyTable     gather.PolicyTable `json:"policy_table,omitempty"`
+
+	Stream     int          `json:"stream,omitempty"`
+	Media      bool         `json:"media,omitempty"` // media-level credentials
+	Username   string       `json:"username,omitempty"`
+	Password   string       `json:"password,omitempty"`
+	Candidates []Candidate  `json:"candidates,omitempty"`
+	Addr       *gather.Addr `json:"addr,omitempty"`
+	Local      *Addr        `json:"local,omitempty"`
+	Remote     *Addr        `json:"remote,omitempty"`
+	Data       []byte       `json:"data,omitempty"`
+
+	Set   ChecklistSet `json:"set,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// recorder writes agent inputs as JSON lines.
+type recorder struct {
+	step sync.Mutex    // serializes steps
+	mux  sync.Mutex    // guards enc
+	enc  *json.Encoder // nil if stopped
+}
+
+// WithRecorder configures agent to record every input, like candidates,
+// credentials, received STUN packets, ticks and random reads, with
+// resulting checklist set to w as JSON lines, so session can be replayed
+// by Replay. Recording contains credentials and stops when agent is closed.
+//
+// Checklist changing steps are serialized while recording, so evolution of
+// checklist set is deterministic.
+func WithRecorder(w io.Writer) AgentOption {
+	return func(a *Agent) error {
+		a.recorder = &recorder{enc: json.NewEncoder(w)}
+		return nil
+	}
+}
+
+// recordingReader records reads from random source.
+type recordingReader struct {
+	r     io.Reader
+	agent *Agent
+}
+
+func (r recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.agent.record(RecordEvent{Type: RecordRand, Data: append([]byte{}, p[:n]...)})
+	}
+	return n, err
+}
+
+// clock returns current time, which is virtual during replay.
+func (a *Agent) clock() time.Time {
+	if a.now == nil {
+		return time.Now()
+	}
+	return a.now()
+}
+
+// startRecording records agent configuration and starts recording random
+// reads.
+func (a *Agent) startRecording() {
+	if a.recorder == nil {
+		return
+	}
+	a.rand = recordingReader{r: a.rand, agent: a}
+	a.record(RecordEvent{
+		Type:            RecordAgent,
+		Role:            a.role,
+		MaxChecks:       a.maxChecks,
+		MaxAttempts:     a.maxAttempts,
+		Ta:              a.ta,
+		CandidatePolicy: a.candidatePolicy,
+		MulticastDNS:    a.mdnsMode,
+		IPv4Only:        a.ipv4Only,
+		LinkLocal:       a.linkLocal,
+		AddrFilter:      a.filter,
+		PolicyTable:     a.policy,
+	})
+}
+
+// stopRecording stops writing events, so writer can be used after agent is
+// closed.
+func (a *Agent) stopRecording() {
+	if a.recorder == nil {
+		return
+	}
+	a.recorder.mux.Lock()
+	a.recorder.enc = nil
+	a.recorder.mux.Unlock()
+}
+
+// record writes event if recording is enabled.
+func (a *Agent) record(e RecordEvent) {
+	if a.recorder == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = a.clock()
+	}
+	var err error
+	a.recorder.mux.Lock()
+	if a.recorder.enc != nil {
+		err = a.recorder.enc.Encode(e)
+	}
+	a.recorder.mux.Unlock()
+	if err != nil && a.log != nil {
+		a.log.Warn("failed to record", zap.Error(err))
+	}
+}
+
+// recordedCandidates returns candidates to record.
+func recordedCandidates(candidates []*localUDPCandidate) []Candidate {
+	recorded := make([]Candidate, 0, len(candidates))
+	for _, c := range candidates {
+		recorded = append(recorded, c.candidate)
+	}
+	return recorded
+}
+
+// step calls f, recording event with resulting checklist set and error.
+func (a *Agent) step(e RecordEvent, f func() error) error {
+	if a.recorder == nil {
+		return f()
+	}
+	a.recorder.step.Lock()
+	defer a.recorder.step.Unlock()
+	if e.Time.IsZero() {
+		e.Time = a.clock()
+	}
+	err := f()
+	if err != nil {
+		e.Error = err.Error()
+	}
+	a.mux.Lock()
+	e.Set = a.set
+	a.record(e)
+	a.mux.Unlock()
+	return err
+}
+
+// tickStep performs connectivity checks for tick of Ta timer.
+func (a *Agent) tickStep(t time.Time) error {
+	return a.step(RecordEvent{Type: RecordTick, Time: t}, func() error {
+		a.collect(t)
+		return a.tick(t, make(map[int]bool))
+	})
+}
+
+// packetStep processes STUN packet that is received on candidate socket.
+func (a *Agent) packetStep(p []byte, c *localUDPCandidate, addr *net.UDPAddr) error {
+	local := c.candidate.Addr
+	remote := Addr{IP: addr.IP, Port: addr.Port, Zone: addr.Zone, Proto: ct.UDP}
+	e := RecordEvent{Type: RecordPacket, Time: a.clock(), Stream: c.stream, Local: &local, Remote: &remote}
+	if a.recorder != nil {
+		e.Data = append([]byte{}, p...)
+	}
+	return a.step(e, func() error {
+		return a.processUDP(p, c, addr, e.Time)
+	})
+}
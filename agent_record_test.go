@@ -0,0 +1,261 @@
+package ice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/ice/gather"
+)
+
+func TestRecordEventType_MarshalText(t *testing.T) {
+	for v := range recordEventTypeToStr {
+		text, err := v.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got RecordEventType
+		if err = got.UnmarshalText(text); err != nil {
+			t.Fatal(err)
+		}
+		if got != v {
+			t.Errorf("%s: got %s", v, got)
+		}
+	}
+	var v RecordEventType
+	if err := v.UnmarshalText([]byte("bad")); err == nil {
+		t.Error("should error")
+	}
+}
+
+// recordedAgent returns agent with single host candidate on conn that is
+// recording to w.
+func recordedAgent(t *testing.T, addr *net.UDPAddr, conn net.PacketConn, w *bytes.Buffer, opts ...AgentOption) *Agent {
+	t.Helper()
+	opts = append(opts, WithRecorder(w), withGatherer(&mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			a := Addr{IP: addr.IP, Port: addr.Port, Proto: candidate.UDP}
+			return []*localUDPCandidate{{
+				candidate: Candidate{
+					Base:        a,
+					Addr:        a,
+					Type:        candidate.Host,
+					ComponentID: 1,
+					Priority:    Priority(TypePreference(candidate.Host), gather.Precedence(addr.IP), 1),
+				},
+				conn: conn,
+			}}, nil
+		},
+	}))
+	a, err := NewAgent(opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func recordSession(t *testing.T, opts ...AgentOption) (controlling, controlled *bytes.Buffer) {
+	t.Helper()
+	lAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+	rAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 2000}
+	connL, connR := packetPipe(lAddr, rAddr)
+	controlling, controlled = new(bytes.Buffer), new(bytes.Buffer)
+	a := recordedAgent(t, lAddr, connL, controlling, opts...)
+	b := recordedAgent(t, rAddr, connR, controlled, append(opts, WithRole(Controlled))...)
+	for _, agent := range []*Agent{a, b} {
+		if err := agent.GatherCandidates(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	aCandidates, err := a.LocalCandidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bCandidates, err := b.LocalCandidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetLocalCredentials("A", "passwordA")
+	a.SetRemoteCredentials("B", "passwordB")
+	b.SetLocalCredentials("B", "passwordB")
+	b.SetRemoteCredentials("A", "passwordA")
+	if err = a.AddRemoteCandidates(bCandidates); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.AddRemoteCandidates(aCandidates); err != nil {
+		t.Fatal(err)
+	}
+	for _, agent := range []*Agent{a, b} {
+		if err = agent.PrepareChecklistSet(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- b.Conclude(ctx)
+	}()
+	if err = a.Conclude(ctx); err != nil {
+		t.Fatalf("failed to conclude controlling: %v", err)
+	}
+	if err = <-done; err != nil {
+		t.Fatalf("failed to conclude controlled: %v", err)
+	}
+	mustClose(t, a)
+	mustClose(t, b)
+	return controlling, controlled
+}
+
+func TestReplay(t *testing.T) {
+	controlling, controlled := recordSession(t)
+	t.Run("Identical", func(t *testing.T) {
+		for name, recording := range map[string]*bytes.Buffer{
+			"Controlling": controlling,
+			"Controlled":  controlled,
+		} {
+			t.Run(name, func(t *testing.T) {
+				if err := Replay(bytes.NewReader(recording.Bytes())); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	})
+	t.Run("Tampered", func(t *testing.T) {
+		var (
+			buf bytes.Buffer
+			enc = json.NewEncoder(&buf)
+			dec = json.NewDecoder(bytes.NewReader(controlling.Bytes()))
+		)
+		for dec.More() {
+			var e RecordEvent
+			if err := dec.Decode(&e); err != nil {
+				t.Fatal(err)
+			}
+			if e.Type == RecordPrepare {
+				e.Set[0].Pairs[0].State = PairFailed
+			}
+			if err := enc.Encode(e); err != nil {
+				t.Fatal(err)
+			}
+		}
+		err := Replay(&buf)
+		mismatch, ok := err.(ReplayMismatchError)
+		if !ok {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if mismatch.Type != RecordPrepare {
+			t.Errorf("unexpected mismatch: %v", mismatch)
+		}
+	})
+	t.Run("MulticastDNS", func(t *testing.T) {
+		registry := &multicastDNSRegistry{names: make(map[string]net.IP)}
+		controlling, controlled := recordSession(t,
+			withMulticastDNSConn(registry),
+			WithMulticastDNS(MulticastDNSQueryAndGather),
+		)
+		for name, recording := range map[string]*bytes.Buffer{
+			"Controlling": controlling,
+			"Controlled":  controlled,
+		} {
+			t.Run(name, func(t *testing.T) {
+				var (
+					resolved int
+					dec      = json.NewDecoder(bytes.NewReader(recording.Bytes()))
+				)
+				for dec.More() {
+					var e RecordEvent
+					if err := dec.Decode(&e); err != nil {
+						t.Fatal(err)
+					}
+					switch e.Type {
+					case RecordAgent:
+						if e.MulticastDNS != MulticastDNSQueryAndGather {
+							t.Errorf("unexpected mDNS mode: %s", e.MulticastDNS)
+						}
+					case RecordRemoteCandidates, RecordResolvedCandidates:
+						for _, c := range e.Candidates {
+							if c.Addr.IP == nil {
+								t.Errorf("%s: unresolved candidate %s", e.Type, c.Addr)
+							}
+						}
+						if e.Type == RecordResolvedCandidates {
+							resolved += len(e.Candidates)
+						}
+					}
+				}
+				if resolved != 1 {
+					t.Errorf("unexpected resolved candidates count: %d", resolved)
+				}
+				// Replaying without mDNS registry, so names can't be resolved.
+				if err := Replay(bytes.NewReader(recording.Bytes())); err != nil {
+					t.Fatal(err)
+				}
+			})
+		}
+	})
+	t.Run("Configuration", func(t *testing.T) {
+		table := append(gather.PolicyTable{}, gather.DefaultPolicyTable...)
+		table[2].Precedence = 100
+		controlling, _ := recordSession(t,
+			WithPolicyTable(table),
+			WithIPv6LinkLocal,
+			WithAddrFilter(AddrFilter{ExcludeInterfaces: []string{"docker*"}}),
+		)
+		var e RecordEvent
+		if err := json.NewDecoder(bytes.NewReader(controlling.Bytes())).Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		if len(e.PolicyTable) != len(table) || e.PolicyTable[2].Precedence != 100 {
+			t.Errorf("unexpected policy table: %v", e.PolicyTable)
+		}
+		if !e.LinkLocal {
+			t.Error("link-local should be recorded")
+		}
+		if e.AddrFilter == nil || len(e.AddrFilter.ExcludeInterfaces) != 1 {
+			t.Errorf("unexpected address filter: %+v", e.AddrFilter)
+		}
+		if err := Replay(bytes.NewReader(controlling.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("RemovedStream", func(t *testing.T) {
+		var recording bytes.Buffer
+		a := recordedAgent(t, &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}, mockPacketConn{}, &recording)
+		remote := []Candidate{{
+			Addr:        Addr{IP: net.IPv4(10, 0, 0, 2), Port: 2000, Proto: candidate.UDP},
+			Type:        candidate.Host,
+			ComponentID: 1,
+			Foundation:  []byte{1, 2, 3, 4},
+		}}
+		for _, mid := range []string{"audio", "video"} {
+			if _, err := a.AddStream(mid); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.GatherCandidatesForMid(mid); err != nil {
+				t.Fatal(err)
+			}
+			if err := a.AddRemoteCandidatesForMid(mid, remote); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := a.PrepareChecklistSet(); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.RemoveStream("audio"); err != nil {
+			t.Fatal(err)
+		}
+		mustClose(t, a)
+		if err := Replay(bytes.NewReader(recording.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("No agent event", func(t *testing.T) {
+		if err := Replay(bytes.NewReader(nil)); err != errReplayNoAgent {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
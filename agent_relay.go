@@ -0,0 +1,215 @@
+package ice
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"gortc.io/stun"
+	"gortc.io/turn"
+	"gortc.io/turnc"
+)
+
+// relayQueueSize is count of received packets that are queued for reading
+// from relayed candidate connection.
+const relayQueueSize = 64
+
+var errRelayDeadline = errors.New("deadlines are not supported by relayed candidate")
+
+// relayConn is net.PacketConn of relayed candidate that sends and receives
+// packets via TURN allocation made from socket of host candidate, creating
+// permissions for remote addresses on first write.
+type relayConn struct {
+	conn    net.Conn // pipe to TURN server via host candidate socket
+	client  *turnc.Client
+	alloc   *turnc.Allocation
+	release func() error // deletes allocation on TURN server
+	addr    *net.UDPAddr // relayed address
+	host    Addr         // address of host candidate
+	packets chan muxPacket
+	closed  chan struct{}
+
+	closeOnce sync.Once
+	mux       sync.Mutex
+	perms     map[string]*turnc.Permission
+}
+
+func newRelayConn(conn net.Conn, client *turnc.Client, alloc *turnc.Allocation, release func() error, addr Addr, host Addr) *relayConn {
+	return &relayConn{
+		conn:    conn,
+		client:  client,
+		alloc:   alloc,
+		release: release,
+		addr:    &net.UDPAddr{IP: addr.IP, Port: addr.Port},
+		host:    host,
+		packets: make(chan muxPacket, relayQueueSize),
+		closed:  make(chan struct{}),
+		perms:   make(map[string]*turnc.Permission),
+	}
+}
+
+// permission returns permission for addr, creating it if needed.
+func (c *relayConn) permission(addr net.Addr) (*turnc.Permission, error) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if p, ok := c.perms[addr.String()]; ok {
+		return p, nil
+	}
+	p, err := c.alloc.Create(addr)
+	if err != nil {
+		return nil, err
+	}
+	c.perms[addr.String()] = p
+	go c.readPermission(p, addr)
+	return p, nil
+}
+
+// readPermission passes packets received via permission to ReadFrom until
+// permission or c is closed.
+func (c *relayConn) readPermission(p *turnc.Permission, addr net.Addr) {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, err := p.Read(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case c.packets <- muxPacket{addr: addr, buf: append([]byte(nil), buf[:n]...)}:
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// ReadFrom returns next packet that was received from any of peers.
+func (c *relayConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	select {
+	case packet := <-c.packets:
+		return copy(p, packet.buf), packet.addr, nil
+	case <-c.closed:
+		return 0, nil, errClosedConn
+	}
+}
+
+// WriteTo writes packet to addr via TURN server.
+func (c *relayConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	select {
+	case <-c.closed:
+		return 0, errClosedConn
+	default:
+	}
+	perm, err := c.permission(addr)
+	if err != nil {
+		return 0, err
+	}
+	return perm.Write(p)
+}
+
+// Close closes permissions, TURN client and its pipe to TURN server, then
+// deletes allocation, so it does not stay on server until expiration. Socket
+// of host candidate is left open, and should be closed after relayed
+// candidate, because allocation is deleted via it.
+func (c *relayConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.mux.Lock()
+		for _, p := range c.perms {
+			_ = p.Close()
+		}
+		c.mux.Unlock()
+		err = c.client.Close()
+		if connErr := c.conn.Close(); err == nil {
+			err = connErr
+		}
+		if releaseErr := c.release(); err == nil {
+			err = releaseErr
+		}
+	})
+	return err
+}
+
+func (c *relayConn) LocalAddr() net.Addr { return c.addr }
+
+func (c *relayConn) SetDeadline(t time.Time) error { return errRelayDeadline }
+
+func (c *relayConn) SetReadDeadline(t time.Time) error { return errRelayDeadline }
+
+func (c *relayConn) SetWriteDeadline(t time.Time) error { return errRelayDeadline }
+
+// relayedOn reports whether c is relayed candidate allocated from socket of
+// one of host candidates.
+func relayedOn(c *localUDPCandidate, hosts []Addr) bool {
+	r, ok := c.conn.(*relayConn)
+	if !ok {
+		return false
+	}
+	for _, h := range hosts {
+		if r.host.Equal(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseAllocation deletes allocation that was made via socket of host
+// candidate c on TURN server addr by Refresh request with zero lifetime, see
+// RFC 5766 Section 7. Request is authenticated with realm and nonce from
+// error response to unauthenticated one.
+func (a *Agent) releaseAllocation(c *localUDPCandidate, addr *net.UDPAddr, s turnServerOptions) error {
+	// TODO: Setup correct RTO.
+	client, err := stun.NewClient(c.Pipe(addr), stun.WithRTO(a.ta/2))
+	if err != nil {
+		return err
+	}
+	refresh := func(setters ...stun.Setter) (*stun.Message, error) {
+		setters = append([]stun.Setter{
+			stun.TransactionID, stun.NewType(stun.MethodRefresh, stun.ClassRequest), &turn.Lifetime{},
+		}, setters...)
+		var (
+			res    *stun.Message
+			resErr error
+		)
+		if doErr := client.Do(stun.MustBuild(setters...), func(e stun.Event) {
+			if e.Error != nil {
+				resErr = e.Error
+				return
+			}
+			res = new(stun.Message)
+			resErr = e.Message.CopyTo(res)
+		}); doErr != nil {
+			return nil, doErr
+		}
+		return res, resErr
+	}
+	res, err := refresh(stun.Fingerprint)
+	if err == nil && res.Type.Class == stun.ClassErrorResponse {
+		var (
+			code  stun.ErrorCodeAttribute
+			realm stun.Realm
+			nonce stun.Nonce
+		)
+		if err = code.GetFrom(res); err == nil && code.Code != stun.CodeUnauthorized {
+			err = unrecoverableErrorCodeErr{Code: code.Code}
+		}
+		if err == nil {
+			err = realm.GetFrom(res)
+		}
+		if err == nil {
+			err = nonce.GetFrom(res)
+		}
+		if err == nil {
+			res, err = refresh(stun.NewUsername(s.username), realm, nonce,
+				stun.NewLongTermIntegrity(s.username, realm.String(), s.password), stun.Fingerprint,
+			)
+		}
+	}
+	if err == nil && res.Type.Class != stun.ClassSuccessResponse {
+		err = unexpectedResponseTypeErr{Type: res.Type}
+	}
+	if closeErr := client.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
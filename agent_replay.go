@@ -0,0 +1,275 @@
+package ice
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// ReplayMismatchError occurs when checklist evolution during replay
+// diverges from recording.
+type ReplayMismatchError struct {
+	Event    int // index of event in recording
+	Type     RecordEventType
+	Expected string
+	Got      string
+}
+
+func (e ReplayMismatchError) Error() string {
+	return fmt.Sprintf("replay: %s event %d mismatch: expected %s, got %s",
+		e.Type, e.Event, e.Expected, e.Got,
+	)
+}
+
+var (
+	errReplayNoAgent     = errors.New("replay: recording does not start with agent event")
+	errReplayNoCandidate = errors.New("replay: local candidate not found")
+	errReplayNoStream    = errors.New("replay: data stream not found")
+)
+
+// replayConn is candidate connection during replay, that discards writes
+// and blocks reads until closed, because received packets are fed from
+// recording.
+type replayConn struct {
+	addr   Addr
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newReplayConn(addr Addr) *replayConn {
+	return &replayConn{addr: addr, closed: make(chan struct{})}
+}
+
+func (c *replayConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	<-c.closed
+	return 0, nil, io.EOF
+}
+
+func (c *replayConn) WriteTo(p []byte, addr net.Addr) (n int, err error) { return len(p), nil }
+
+func (c *replayConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *replayConn) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: c.addr.IP, Port: c.addr.Port, Zone: c.addr.Zone}
+}
+
+func (c *replayConn) SetDeadline(t time.Time) error      { return nil }
+func (c *replayConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *replayConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// replayCandidates returns local candidates with replay connections.
+func replayCandidates(recorded []Candidate) []*localUDPCandidate {
+	candidates := make([]*localUDPCandidate, 0, len(recorded))
+	for _, c := range recorded {
+		candidates = append(candidates, &localUDPCandidate{
+			candidate: c,
+			conn:      newReplayConn(c.Addr),
+		})
+	}
+	return candidates
+}
+
+// replayGatherer returns recorded local candidates.
+type replayGatherer struct {
+	candidates []Candidate
+}
+
+func (g *replayGatherer) gatherUDP(opt gathererOptions) ([]*localUDPCandidate, error) {
+	return replayCandidates(g.candidates), nil
+}
+
+// replayMulticastDNS is mDNS connection during replay, that ignores
+// published names and does not resolve, because resolved remote candidates
+// are fed from recording.
+type replayMulticastDNS struct{}
+
+var errReplayResolve = errors.New("replay: resolving is not supported")
+
+func (replayMulticastDNS) Publish(name string, ip net.IP) {}
+func (replayMulticastDNS) Unpublish(name string)          {}
+func (replayMulticastDNS) Close() error                   { return nil }
+
+func (replayMulticastDNS) Resolve(ctx context.Context, name string) ([]net.IP, error) {
+	return nil, errReplayResolve
+}
+
+// replayRand returns recorded random reads.
+type replayRand struct {
+	buf bytes.Buffer
+}
+
+func (r *replayRand) Read(p []byte) (int, error) {
+	if r.buf.Len() == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return r.buf.Read(p)
+}
+
+// Replay feeds recording of agent session that is written by WithRecorder
+// into fresh agent on virtual clock, returning ReplayMismatchError if
+// checklist set or error after any recorded step is not identical to the
+// recorded one. Options are applied to replaying agent, e.g. for logging.
+//
+// Recorded agent configuration, including mDNS mode, address filter and
+// policy table, is restored, while local candidates are replayed as
+// gathered, after NAT mapping, and remote candidates with host names as
+// resolved, so no network access is made.
+func Replay(r io.Reader, opts ...AgentOption) error {
+	var events []RecordEvent
+	d := json.NewDecoder(r)
+	for {
+		var e RecordEvent
+		if err := d.Decode(&e); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		events = append(events, e)
+	}
+	if len(events) == 0 || events[0].Type != RecordAgent {
+		return errReplayNoAgent
+	}
+	var (
+		rnd   = new(replayRand)
+		g     = new(replayGatherer)
+		now   = events[0].Time
+		first = events[0]
+	)
+	for _, e := range events {
+		if e.Type == RecordRand {
+			rnd.buf.Write(e.Data)
+		}
+	}
+	opts = append(opts, withGatherer(g), func(a *Agent) error {
+		a.rand = rnd
+		a.now = func() time.Time { return now }
+		a.role = first.Role
+		a.maxChecks = first.MaxChecks
+		a.maxAttempts = first.MaxAttempts
+		a.ta = first.Ta
+		a.candidatePolicy = first.CandidatePolicy
+		a.ipv4Only = first.IPv4Only
+		a.linkLocal = first.LinkLocal
+		a.filter = first.AddrFilter
+		a.policy = first.PolicyTable
+		a.nat = nil
+		a.mdnsMode = first.MulticastDNS
+		if a.mdnsMode != MulticastDNSDisabled {
+			a.mdns = replayMulticastDNS{}
+		}
+		return nil
+	})
+	a, err := NewAgent(opts...)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = a.Close() }()
+	for i, e := range events[1:] {
+		now = e.Time
+		var stepErr error
+		switch e.Type {
+		case RecordLocalCredentials:
+			a.SetLocalCredentials(e.Username, e.Password)
+		case RecordRemoteCredentials:
+			if !e.Media {
+				a.SetRemoteCredentials(e.Username, e.Password)
+				break
+			}
+			a.mux.Lock()
+			if e.Stream >= len(a.streams) {
+				a.mux.Unlock()
+				return errReplayNoStream
+			}
+			a.streams[e.Stream].remoteUsername = e.Username
+			a.streams[e.Stream].remotePassword = e.Password
+			a.mux.Unlock()
+		case RecordLocalCandidates:
+			g.candidates = e.Candidates
+			if err = a.GatherCandidatesForStream(e.Stream); err != nil {
+				return err
+			}
+		case RecordRemoteCandidates:
+			if err = a.AddRemoteCandidatesForStream(e.Stream, e.Candidates); err != nil {
+				return err
+			}
+			a.resolving.Wait()
+		case RecordTrickledCandidates:
+			stepErr = a.addRemoteCandidates(e.Stream, e.Candidates)
+		case RecordResolvedCandidates:
+			a.addResolvedCandidates(e.Stream, e.Candidates)
+		case RecordAddedCandidates:
+			a.addCandidates(e.Stream, replayCandidates(e.Candidates))
+		case RecordRemovedAddr:
+			a.removeAddr(*e.Addr)
+		case RecordRemovedStream:
+			stepErr = a.removeStream(e.Stream)
+		case RecordPrepare:
+			stepErr = a.prepareChecklistSet()
+		case RecordTick:
+			a.collect(e.Time)
+			stepErr = a.tick(e.Time, make(map[int]bool))
+		case RecordPacket:
+			a.mux.Lock()
+			c, ok := a.localCandidate(e.Stream, *e.Local)
+			a.mux.Unlock()
+			if !ok {
+				return errReplayNoCandidate
+			}
+			stepErr = a.processUDP(e.Data, c, &net.UDPAddr{
+				IP: e.Remote.IP, Port: e.Remote.Port, Zone: e.Remote.Zone,
+			}, e.Time)
+		}
+		if !isStep(e.Type) {
+			continue
+		}
+		if err = compareStep(i+1, e, a, stepErr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isStep reports whether event is recorded with resulting checklist set.
+func isStep(t RecordEventType) bool {
+	switch t {
+	case RecordAddedCandidates, RecordRemovedAddr, RecordRemovedStream, RecordTrickledCandidates,
+		RecordResolvedCandidates, RecordPrepare, RecordTick, RecordPacket:
+		return true
+	default:
+		return false
+	}
+}
+
+// compareStep compares recorded step result with replayed one.
+func compareStep(i int, e RecordEvent, a *Agent, err error) error {
+	var got string
+	if err != nil {
+		got = err.Error()
+	}
+	if got != e.Error {
+		return ReplayMismatchError{Event: i, Type: e.Type, Expected: e.Error, Got: got}
+	}
+	a.mux.Lock()
+	gotSet, err := json.Marshal(a.set)
+	a.mux.Unlock()
+	if err != nil {
+		return err
+	}
+	expectedSet, err := json.Marshal(e.Set)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(gotSet, expectedSet) {
+		return ReplayMismatchError{Event: i, Type: e.Type, Expected: string(expectedSet), Got: string(gotSet)}
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package ice
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Resolver resolves host names of remote candidates. The *net.Resolver
+// implements Resolver.
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Maximum duration of resolving single remote candidate host name.
+const defaultResolveTimeout = time.Second * 5
+
+var errMulticastDNSDisabled = errors.New("mDNS is disabled")
+
+// lookupHost resolves host via mDNS or Resolver.
+func (a *Agent) lookupHost(ctx context.Context, host string) ([]net.IP, error) {
+	if isMulticastDNSName(host) {
+		if a.mdns == nil {
+			return nil, errMulticastDNSDisabled
+		}
+		return a.mdns.Resolve(ctx, host)
+	}
+	addrs, err := a.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+	return ips, nil
+}
+
+// resolveRemoteCandidate resolves remote candidate host name, adding
+// candidate for each resolved IP to the stream. IPv6 addresses are skipped
+// in IPv4-only mode.
+func (a *Agent) resolveRemoteCandidate(streamID int, c Candidate) {
+	defer a.resolving.Done()
+	log := a.log.With(zap.String("host", c.Addr.Host))
+	ctx, cancel := context.WithTimeout(a.closing, defaultResolveTimeout)
+	defer cancel()
+	ips, err := a.lookupHost(ctx, c.Addr.Host)
+	if err != nil {
+		log.Warn("failed to resolve remote candidate", zap.Error(err))
+		return
+	}
+	var resolved []Candidate
+	for _, ip := range ips {
+		if a.ipv4Only && ip.To4() == nil {
+			log.Debug("skipping IPv6 address", zap.Stringer("ip", ip))
+			continue
+		}
+		r := c
+		r.Addr.IP = ip
+		resolved = append(resolved, r)
+		log.Debug("resolved remote candidate", zap.Stringer("ip", ip))
+	}
+	if len(resolved) == 0 {
+		return
+	}
+	e := RecordEvent{Type: RecordResolvedCandidates, Stream: streamID, Candidates: resolved}
+	_ = a.step(e, func() error {
+		a.addResolvedCandidates(streamID, resolved)
+		return nil
+	})
+}
+
+// addResolvedCandidates adds resolved remote candidates to data stream
+// unless it is removed.
+func (a *Agent) addResolvedCandidates(streamID int, resolved []Candidate) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if a.streamRemoved(streamID) {
+		a.log.Debug("stream is removed", zap.Int("stream", streamID))
+		return
+	}
+	a.appendRemoteCandidates(streamID, resolved)
+}
@@ -0,0 +1,98 @@
+package ice
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"gortc.io/ice/candidate"
+)
+
+type resolverMock struct {
+	lookup func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+func (r resolverMock) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return r.lookup(ctx, host)
+}
+
+func TestAgent_resolveRemoteCandidate(t *testing.T) {
+	r := resolverMock{
+		lookup: func(ctx context.Context, host string) ([]net.IPAddr, error) {
+			if host != "example.org" {
+				return nil, errors.New("not found")
+			}
+			return []net.IPAddr{
+				{IP: net.IPv4(10, 0, 0, 2)},
+				{IP: net.ParseIP("2001:db8::2")},
+			}, nil
+		},
+	}
+	remote := []Candidate{
+		{
+			Addr: Addr{
+				Host:  "example.org",
+				Port:  2000,
+				Proto: candidate.UDP,
+			},
+			Type:        candidate.Host,
+			ComponentID: 1,
+		},
+		{
+			Addr: Addr{
+				Host:  "unknown.example.org",
+				Port:  2000,
+				Proto: candidate.UDP,
+			},
+			Type:        candidate.Host,
+			ComponentID: 1,
+		},
+		{
+			Addr: Addr{
+				Host:  "unknown.local",
+				Port:  2000,
+				Proto: candidate.UDP,
+			},
+			Type:        candidate.Host,
+			ComponentID: 1,
+		},
+	}
+	for _, tc := range []struct {
+		name    string
+		options []AgentOption
+		count   int
+	}{
+		{name: "DualStack", count: 2},
+		{name: "IPv4Only", options: []AgentOption{WithIPv4Only}, count: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a, err := NewAgent(append(tc.options,
+				withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)),
+				WithResolver(r),
+			)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mustClose(t, a)
+			if err = a.GatherCandidates(); err != nil {
+				t.Fatal(err)
+			}
+			if err = a.AddRemoteCandidates(remote); err != nil {
+				t.Fatal(err)
+			}
+			if err = a.PrepareChecklistSet(); err != nil {
+				t.Fatal(err)
+			}
+			if len(a.remoteCandidates[0]) != tc.count {
+				t.Fatalf("unexpected remote candidates count %d", len(a.remoteCandidates[0]))
+			}
+			if len(a.set[0].Pairs) != 1 {
+				t.Fatalf("unexpected pairs count %d", len(a.set[0].Pairs))
+			}
+			if !a.set[0].Pairs[0].Remote.Addr.IP.Equal(net.IPv4(10, 0, 0, 2)) {
+				t.Errorf("unexpected remote address %s", a.set[0].Pairs[0].Remote.Addr)
+			}
+		})
+	}
+}
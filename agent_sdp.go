@@ -0,0 +1,153 @@
+package ice
+
+import (
+	"errors"
+	"sort"
+
+	"go.uber.org/zap"
+
+	"gortc.io/ice/sdp"
+)
+
+// SetStreamMids sets media stream identification tags for data streams that
+// are used in sdp.CandidateInit, where index of mid is stream ID. Mids
+// beyond maximum count of data streams are ignored. Returns errMidExist and
+// sets no mids if mid is duplicated or used by other data stream.
+func (a *Agent) SetStreamMids(mids ...string) error {
+	set := make(map[string]bool, len(mids))
+	for _, mid := range mids {
+		if set[mid] {
+			return errMidExist
+		}
+		set[mid] = true
+	}
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	for streamID, s := range a.streams {
+		if streamID >= len(mids) && !s.removed && set[s.mid] {
+			return errMidExist
+		}
+	}
+	for streamID, mid := range mids {
+		s, err := a.streamAt(streamID)
+		if err != nil {
+			a.log.Warn("ignoring mids", zap.Int("count", len(mids)-streamID))
+			return nil
+		}
+		s.mid = mid
+	}
+	return nil
+}
+
+// StreamID returns data stream ID for candidate, using sdpMid if it is known
+// and sdpMLineIndex otherwise. The sdpMLineIndex should refer to existing
+// data stream that is not removed, so peer can't allocate streams.
+func (a *Agent) StreamID(i sdp.CandidateInit) (int, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if i.SDPMid != nil {
+		if streamID, ok := a.streamByMid(*i.SDPMid); ok {
+			return streamID, nil
+		}
+	}
+	if i.SDPMLineIndex == nil {
+		if i.SDPMid == nil {
+			return 0, sdp.ErrMissingMid
+		}
+		return 0, errNoMidFound
+	}
+	streamID := int(*i.SDPMLineIndex)
+	if streamID >= len(a.streams) || a.streams[streamID].removed {
+		return 0, errNoMidFound
+	}
+	return streamID, nil
+}
+
+// streamMid returns mid of data stream or blank string if not set.
+func (a *Agent) streamMid(streamID int) string {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if streamID < len(a.streams) {
+		return a.streams[streamID].mid
+	}
+	return ""
+}
+
+// LocalCandidateInits returns local candidates of all gathered data streams
+// in sdp.CandidateInit representation, ending each stream with end of
+// candidates.
+func (a *Agent) LocalCandidateInits() ([]sdp.CandidateInit, error) {
+	var (
+		inits   []sdp.CandidateInit
+		streams []int
+	)
+	a.mux.Lock()
+	for streamID, s := range a.streams {
+		if s.gathered && !s.removed {
+			streams = append(streams, streamID)
+		}
+	}
+	username := a.localUsername
+	a.mux.Unlock()
+	for _, streamID := range streams {
+		candidates, err := a.LocalCandidatesForStream(streamID)
+		if err != nil {
+			return nil, err
+		}
+		mid, index := a.streamMid(streamID), uint16(streamID)
+		for _, c := range candidates {
+			i := sdp.NewCandidateInit(CandidateToSDP(c), mid, index)
+			u := username
+			i.UsernameFragment = &u
+			inits = append(inits, i)
+		}
+		inits = append(inits, sdp.EndOfCandidatesInit(mid, index))
+	}
+	return inits, nil
+}
+
+var errUsernameFragmentMismatch = errors.New("username fragment does not match remote credentials")
+
+// AddRemoteCandidateInits adds remote candidates from sdp.CandidateInit list,
+// associating them with data streams by StreamID. End of candidates values
+// are skipped.
+//
+// Can be called multiple times as candidates are trickled, even after
+// PrepareChecklistSet, so new candidates are paired with local ones.
+func (a *Agent) AddRemoteCandidateInits(inits []sdp.CandidateInit) error {
+	streams := make(map[int][]Candidate)
+	for _, i := range inits {
+		streamID, err := a.StreamID(i)
+		if err != nil {
+			return err
+		}
+		if _, ok := streams[streamID]; !ok {
+			streams[streamID] = nil
+		}
+		if i.EndOfCandidates() {
+			continue
+		}
+		a.mux.Lock()
+		username, _ := a.remoteCredentials(streamID)
+		a.mux.Unlock()
+		if i.UsernameFragment != nil && username != "" && *i.UsernameFragment != username {
+			return errUsernameFragmentMismatch
+		}
+		var s sdp.Candidate
+		if err = i.Parse(&s); err != nil {
+			return err
+		}
+		streams[streamID] = append(streams[streamID], CandidateFromSDP(&s))
+	}
+	ids := make([]int, 0, len(streams))
+	for streamID := range streams {
+		ids = append(ids, streamID)
+	}
+	sort.Ints(ids)
+	for _, streamID := range ids {
+		if err := a.trickleRemoteCandidates(streamID, streams[streamID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package ice
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/ice/sdp"
+)
+
+func TestAgent_StreamID(t *testing.T) {
+	a, err := NewAgent(withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	if err = a.SetStreamMids("audio", "video"); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.RemoveStream("audio"); err != nil {
+		t.Fatal(err)
+	}
+	mid := func(s string) *string { return &s }
+	index := func(i uint16) *uint16 { return &i }
+	for _, tc := range []struct {
+		name string
+		in   sdp.CandidateInit
+		id   int
+		err  error
+	}{
+		{name: "Mid", in: sdp.CandidateInit{SDPMid: mid("video")}, id: 1},
+		{name: "MidPrecedence", in: sdp.CandidateInit{SDPMid: mid("video"), SDPMLineIndex: index(0)}, id: 1},
+		{name: "Index", in: sdp.CandidateInit{SDPMid: mid("data"), SDPMLineIndex: index(1)}, id: 1},
+		{name: "UnknownIndex", in: sdp.CandidateInit{SDPMLineIndex: index(2)}, err: errNoMidFound},
+		{name: "RemovedIndex", in: sdp.CandidateInit{SDPMLineIndex: index(0)}, err: errNoMidFound},
+		{name: "UnknownMid", in: sdp.CandidateInit{SDPMid: mid("data")}, err: errNoMidFound},
+		{name: "Missing", in: sdp.CandidateInit{}, err: sdp.ErrMissingMid},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			id, err := a.StreamID(tc.in)
+			if err != tc.err {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if id != tc.id {
+				t.Errorf("unexpected stream id %d", id)
+			}
+		})
+	}
+}
+
+func TestAgent_CandidateInits(t *testing.T) {
+	local, err := NewAgent(withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, local)
+	local.SetLocalCredentials("ufrag", "password")
+	if err = local.SetStreamMids("audio", "video"); err != nil {
+		t.Fatal(err)
+	}
+	for streamID := 0; streamID < 2; streamID++ {
+		if err = local.GatherCandidatesForStream(streamID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	inits, err := local.LocalCandidateInits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inits) != 4 {
+		t.Fatalf("unexpected count %d", len(inits))
+	}
+	if !inits[3].EndOfCandidates() || *inits[3].SDPMid != "video" {
+		t.Error("stream should be ended by end of candidates")
+	}
+	// Inits should not change on ICE restart.
+	local.SetLocalCredentials("restarted", "password")
+	if *inits[0].UsernameFragment != "ufrag" {
+		t.Errorf("unexpected username fragment %s", *inits[0].UsernameFragment)
+	}
+	local.SetLocalCredentials("ufrag", "password")
+	// Simulating signaling with reversed order of candidates.
+	for i, j := 0, len(inits)-1; i < j; i, j = i+1, j-1 {
+		inits[i], inits[j] = inits[j], inits[i]
+	}
+	b, err := json.Marshal(inits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received []sdp.CandidateInit
+	if err = json.Unmarshal(b, &received); err != nil {
+		t.Fatal(err)
+	}
+	remote, err := NewAgent(withGatherer(hostGatherer(net.IPv4(10, 0, 0, 2), 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, remote)
+	if err = remote.SetStreamMids("audio", "video"); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("UsernameFragmentMismatch", func(t *testing.T) {
+		remote.SetRemoteCredentials("other", "password")
+		if err := remote.AddRemoteCandidateInits(received); err != errUsernameFragmentMismatch {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	remote.SetRemoteCredentials("ufrag", "password")
+	if err = remote.AddRemoteCandidateInits(received); err != nil {
+		t.Fatal(err)
+	}
+	if len(remote.remoteCandidates) != 2 {
+		t.Fatalf("unexpected stream count %d", len(remote.remoteCandidates))
+	}
+	for streamID, candidates := range remote.remoteCandidates {
+		if len(candidates) != 1 {
+			t.Fatalf("unexpected candidates count %d", len(candidates))
+		}
+		expected := local.localCandidates[streamID][0].candidate
+		if !candidates[0].Addr.Equal(expected.Addr) {
+			t.Errorf("unexpected address %s", candidates[0].Addr)
+		}
+	}
+}
+
+func TestAgent_TrickleCandidateInits(t *testing.T) {
+	a, err := NewAgent(withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	if err = a.SetStreamMids("audio"); err != nil {
+		t.Fatal(err)
+	}
+	a.SetRemoteCredentials("ufrag", "password")
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	newInit := func(ip net.IP) sdp.CandidateInit {
+		c := Candidate{
+			Addr:        Addr{IP: ip, Port: 2000, Proto: candidate.UDP},
+			Type:        candidate.Host,
+			ComponentID: 1,
+			Foundation:  []byte{1, 2, 3, 4},
+		}
+		return sdp.NewCandidateInit(CandidateToSDP(c), "audio", 0)
+	}
+	if err = a.AddRemoteCandidateInits([]sdp.CandidateInit{newInit(net.IPv4(10, 0, 0, 2))}); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.PrepareChecklistSet(); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.set[0].Pairs) != 1 {
+		t.Fatalf("unexpected pairs count %d", len(a.set[0].Pairs))
+	}
+	trickled := []sdp.CandidateInit{
+		newInit(net.IPv4(10, 0, 0, 3)),
+		sdp.EndOfCandidatesInit("audio", 0),
+	}
+	if err = a.AddRemoteCandidateInits(trickled); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.remoteCandidates[0]) != 2 {
+		t.Fatalf("unexpected remote candidates count %d", len(a.remoteCandidates[0]))
+	}
+	if len(a.set[0].Pairs) != 2 {
+		t.Fatalf("unexpected pairs count %d", len(a.set[0].Pairs))
+	}
+	for _, p := range a.set[0].Pairs {
+		if p.State != PairFrozen && p.State != PairWaiting {
+			t.Errorf("unexpected pair state %s", p.State)
+		}
+	}
+}
+
+func TestAgent_SetStreamMids(t *testing.T) {
+	a, err := NewAgent(withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	if err = a.SetStreamMids("audio", "audio"); err != errMidExist {
+		t.Errorf("unexpected duplicate error %v", err)
+	}
+	if len(a.streams) != 0 {
+		t.Errorf("unexpected streams count %d", len(a.streams))
+	}
+	if err = a.SetStreamMids("audio", "video", "data"); err != nil {
+		t.Fatal(err)
+	}
+	// Mid of stream 2 is used.
+	if err = a.SetStreamMids("audio", "data"); err != errMidExist {
+		t.Errorf("unexpected used mid error %v", err)
+	}
+	if err = a.RemoveStream("data"); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.SetStreamMids("audio", "data"); err != nil {
+		t.Error(err)
+	}
+	if streamID, err := a.midStream("data"); err != nil || streamID != 1 {
+		t.Errorf("unexpected stream %d for mid: %v", streamID, err)
+	}
+}
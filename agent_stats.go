@@ -0,0 +1,268 @@
+package ice
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+// ConsentState represents consent of remote peer to receive data on pair as
+// defined by RFC 7675.
+//
+// Consent is derived only from time of last response to connectivity check
+// on pair. Agent does not send consent freshness checks after conclusion,
+// so consent of selected pair expires consentTimeout after last check.
+type ConsentState byte
+
+const (
+	// ConsentPending means that no check for pair succeeded yet.
+	ConsentPending ConsentState = iota
+	// ConsentGranted means that check for pair succeeded recently.
+	ConsentGranted
+	// ConsentExpired means that no check for pair succeeded during
+	// consentTimeout.
+	ConsentExpired
+)
+
+var consentStateToStr = map[ConsentState]string{
+	ConsentPending: "pending",
+	ConsentGranted: "granted",
+	ConsentExpired: "expired",
+}
+
+func (s ConsentState) String() string { return consentStateToStr[s] }
+
+// MarshalText implements TextMarshaler.
+func (s ConsentState) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements TextUnmarshaler.
+func (s *ConsentState) UnmarshalText(text []byte) error {
+	for k, v := range consentStateToStr {
+		if string(text) == v {
+			*s = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown consent state %q", text)
+}
+
+// consentTimeout is duration after last successful check when consent
+// expires, see RFC 7675 Section 5.1.
+const consentTimeout = time.Second * 30
+
+// CandidateStats represents statistics of candidate, modeled on
+// RTCIceCandidateStats.
+type CandidateStats struct {
+	ID       string `json:"id"`
+	StreamID int    `json:"stream_id"`
+	Candidate
+}
+
+// CandidatePairStats represents statistics of candidate pair, modeled on
+// RTCIceCandidatePairStats. Round trip times are measured only for checks
+// that were not retransmitted, because response to retransmitted request is
+// ambiguous.
+type CandidatePairStats struct {
+	ID                    string        `json:"id"`
+	StreamID              int           `json:"stream_id"`
+	ComponentID           int           `json:"component_id"`
+	LocalCandidateID      string        `json:"local_candidate_id"`
+	RemoteCandidateID     string        `json:"remote_candidate_id"`
+	State                 PairState     `json:"state"`
+	Nominated             bool          `json:"nominated"`
+	Priority              int64         `json:"priority"`
+	Consent               ConsentState  `json:"consent"`
+	RequestsSent          uint64        `json:"requests_sent"`
+	RequestsReceived      uint64        `json:"requests_received"`
+	ResponsesSent         uint64        `json:"responses_sent"`
+	ResponsesReceived     uint64        `json:"responses_received"`
+	Retransmissions       uint64        `json:"retransmissions"`
+	CurrentRoundTripTime  time.Duration `json:"current_rtt"`
+	TotalRoundTripTime    time.Duration `json:"total_rtt"`
+	SmoothedRoundTripTime time.Duration `json:"srtt"`
+	RoundTripTimeVariance time.Duration `json:"rttvar"`
+	PacketsSent           uint64        `json:"packets_sent"`
+	PacketsReceived       uint64        `json:"packets_received"`
+	BytesSent             uint64        `json:"bytes_sent"`
+	BytesReceived         uint64        `json:"bytes_received"`
+	LastResponseReceived  time.Time     `json:"last_response_received"`
+}
+
+// Stats represents statistics of Agent.
+type Stats struct {
+	Timestamp        time.Time            `json:"timestamp"`
+	LocalCandidates  []CandidateStats     `json:"local_candidates"`
+	RemoteCandidates []CandidateStats     `json:"remote_candidates"`
+	Pairs            []CandidatePairStats `json:"pairs"`
+}
+
+// pairCounters are statistics counters of candidate pair.
+type pairCounters struct {
+	requestsSent      uint64
+	requestsReceived  uint64
+	responsesSent     uint64
+	responsesReceived uint64
+	retransmissions   uint64
+	currentRTT        time.Duration
+	totalRTT          time.Duration
+	rtt               rttEstimator
+	packetsSent       uint64
+	packetsReceived   uint64
+	bytesSent         uint64
+	bytesReceived     uint64
+	lastResponse      time.Time
+}
+
+// count calls f with counters of pair with provided key.
+func (a *Agent) count(k pairKey, f func(c *pairCounters)) {
+	a.statsMux.Lock()
+	if a.stats == nil {
+		a.stats = make(map[pairKey]*pairCounters)
+	}
+	c, ok := a.stats[k]
+	if !ok {
+		c = new(pairCounters)
+		a.stats[k] = c
+	}
+	f(c)
+	a.statsMux.Unlock()
+}
+
+// countData calls f with counters of pair with provided key if the pair is
+// in checklist of data stream, reporting whether it is. Data from addresses
+// without pair is not counted, so it can't grow statistics without bound.
+func (a *Agent) countData(streamID int, k pairKey, f func(c *pairCounters)) bool {
+	a.mux.Lock()
+	found := false
+	if streamID < len(a.set) {
+		for i := range a.set[streamID].Pairs {
+			if k.Equal(&a.set[streamID].Pairs[i]) {
+				found = true
+				break
+			}
+		}
+	}
+	a.mux.Unlock()
+	if !found {
+		return false
+	}
+	a.count(k, f)
+	return true
+}
+
+// countResponse records successful response to check of transaction,
+// sampling round trip time if request was not retransmitted.
+func (a *Agent) countResponse(t *agentTransaction, now time.Time) {
+	a.count(t.pair, func(c *pairCounters) {
+		c.responsesReceived++
+		c.lastResponse = now
+		if t.attempt > 1 {
+			// Karn's algorithm: response can be to any of requests.
+			return
+		}
+		c.currentRTT = now.Sub(t.start)
+		c.totalRTT += c.currentRTT
+		c.rtt.update(c.currentRTT)
+	})
+}
+
+func localCandidateID(c Candidate) string  { return "L" + c.Addr.String() }
+func remoteCandidateID(c Candidate) string { return "R" + c.Addr.String() }
+
+// Stats returns current statistics of candidates and candidate pairs.
+func (a *Agent) Stats() Stats {
+	now := a.clock()
+	s := Stats{Timestamp: now}
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	for streamID := range a.localCandidates {
+		for _, c := range a.allowedCandidates(a.localCandidates[streamID]) {
+			s.LocalCandidates = append(s.LocalCandidates, CandidateStats{
+				ID:        localCandidateID(c),
+				StreamID:  streamID,
+				Candidate: c,
+			})
+		}
+	}
+	for streamID := range a.remoteCandidates {
+		for _, c := range a.remoteCandidates[streamID] {
+			s.RemoteCandidates = append(s.RemoteCandidates, CandidateStats{
+				ID:        remoteCandidateID(c),
+				StreamID:  streamID,
+				Candidate: c,
+			})
+		}
+	}
+	a.statsMux.Lock()
+	defer a.statsMux.Unlock()
+	for streamID, list := range a.set {
+		for i := range list.Pairs {
+			p := &list.Pairs[i]
+			ps := CandidatePairStats{
+				StreamID:          streamID,
+				ComponentID:       p.ComponentID,
+				LocalCandidateID:  localCandidateID(p.Local),
+				RemoteCandidateID: remoteCandidateID(p.Remote),
+				State:             p.State,
+				Nominated:         p.Nominated,
+				Priority:          p.Priority,
+			}
+			ps.ID = ps.LocalCandidateID + "-" + ps.RemoteCandidateID
+			for j := range list.Valid {
+				if samePair(&list.Valid[j], p) && list.Valid[j].Nominated {
+					ps.Nominated = true
+				}
+			}
+			if c, ok := a.stats[getPairKey(p)]; ok {
+				ps.RequestsSent = c.requestsSent
+				ps.RequestsReceived = c.requestsReceived
+				ps.ResponsesSent = c.responsesSent
+				ps.ResponsesReceived = c.responsesReceived
+				ps.Retransmissions = c.retransmissions
+				ps.CurrentRoundTripTime = c.currentRTT
+				ps.TotalRoundTripTime = c.totalRTT
+				ps.SmoothedRoundTripTime = c.rtt.srtt
+				ps.RoundTripTimeVariance = c.rtt.rttvar
+				ps.PacketsSent = c.packetsSent
+				ps.PacketsReceived = c.packetsReceived
+				ps.BytesSent = c.bytesSent
+				ps.BytesReceived = c.bytesReceived
+				ps.LastResponseReceived = c.lastResponse
+				if !c.lastResponse.IsZero() {
+					ps.Consent = ConsentGranted
+					if now.Sub(c.lastResponse) > consentTimeout {
+						ps.Consent = ConsentExpired
+					}
+				}
+			}
+			s.Pairs = append(s.Pairs, ps)
+		}
+	}
+	return s
+}
+
+// statsConn is candidate connection that counts data sent by packet handlers
+// to pairs of its data stream.
+type statsConn struct {
+	net.PacketConn
+	agent  *Agent
+	stream int
+	local  Addr
+}
+
+func (c statsConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	n, err := c.PacketConn.WriteTo(p, addr)
+	if err != nil {
+		return n, err
+	}
+	if udpAddr, ok := addr.(*net.UDPAddr); ok {
+		k := newPairKey(c.local, Addr{IP: udpAddr.IP, Port: udpAddr.Port})
+		c.agent.countData(c.stream, k, func(s *pairCounters) {
+			s.packetsSent++
+			s.bytesSent += uint64(n)
+		})
+	}
+	return n, err
+}
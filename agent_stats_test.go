@@ -0,0 +1,199 @@
+package ice
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"gortc.io/ice/candidate"
+)
+
+// discardPacketConn is mockPacketConn that discards written packets.
+type discardPacketConn struct{ mockPacketConn }
+
+func (discardPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) { return len(p), nil }
+
+func TestAgent_Stats(t *testing.T) {
+	local := Candidate{
+		Addr:        Addr{IP: net.IPv4(10, 0, 0, 1), Port: 1000, Proto: candidate.UDP},
+		Type:        candidate.Host,
+		ComponentID: 1,
+	}
+	local.Base = local.Addr
+	remote := Candidate{
+		Addr:        Addr{IP: net.ParseIP("10.0.0.2").To4(), Port: 2000, Proto: candidate.UDP},
+		Type:        candidate.Host,
+		ComponentID: 1,
+	}
+	gatherer := &mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			return []*localUDPCandidate{{candidate: local, conn: mockPacketConn{}}}, nil
+		},
+	}
+	a, err := NewAgent(withGatherer(gatherer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.AddRemoteCandidates([]Candidate{remote}); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.PrepareChecklistSet(); err != nil {
+		t.Fatal(err)
+	}
+	a.mux.Lock()
+	a.set[0].Valid = append(a.set[0].Valid, a.set[0].Pairs[0])
+	a.set[0].Valid[0].Nominated = true
+	a.mux.Unlock()
+
+	k := newPairKey(local.Addr, remote.Addr)
+	now := time.Now()
+	a.count(k, func(s *pairCounters) { s.requestsSent++ })
+	a.count(k, func(s *pairCounters) { s.retransmissions++ })
+	a.countResponse(&agentTransaction{pair: k, attempt: 1, start: now.Add(-time.Millisecond * 30)}, now)
+	a.countResponse(&agentTransaction{pair: k, attempt: 1, start: now.Add(-time.Millisecond * 10)}, now)
+	a.countResponse(&agentTransaction{pair: k, attempt: 2, start: now.Add(-time.Second)}, now)
+	conn := statsConn{PacketConn: discardPacketConn{}, agent: a, local: local.Addr}
+	if _, err = conn.WriteTo(make([]byte, 100), &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 2000}); err != nil {
+		t.Fatal(err)
+	}
+
+	s := a.Stats()
+	if len(s.LocalCandidates) != 1 || len(s.RemoteCandidates) != 1 || len(s.Pairs) != 1 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	p := s.Pairs[0]
+	if p.LocalCandidateID != s.LocalCandidates[0].ID || p.RemoteCandidateID != s.RemoteCandidates[0].ID {
+		t.Error("unexpected candidate ids")
+	}
+	for _, tc := range []struct {
+		name          string
+		got, expected interface{}
+	}{
+		{name: "RequestsSent", got: p.RequestsSent, expected: uint64(1)},
+		{name: "Retransmissions", got: p.Retransmissions, expected: uint64(1)},
+		{name: "ResponsesReceived", got: p.ResponsesReceived, expected: uint64(3)},
+		{name: "CurrentRTT", got: p.CurrentRoundTripTime, expected: time.Millisecond * 10},
+		{name: "TotalRTT", got: p.TotalRoundTripTime, expected: time.Millisecond * 40},
+		{name: "SmoothedRTT", got: p.SmoothedRoundTripTime, expected: time.Millisecond*30 - time.Millisecond*20/8},
+		{name: "PacketsSent", got: p.PacketsSent, expected: uint64(1)},
+		{name: "BytesSent", got: p.BytesSent, expected: uint64(100)},
+		{name: "Consent", got: p.Consent, expected: ConsentGranted},
+		{name: "Nominated", got: p.Nominated, expected: true},
+	} {
+		if tc.got != tc.expected {
+			t.Errorf("%s: %v (got) != %v (expected)", tc.name, tc.got, tc.expected)
+		}
+	}
+	t.Run("ConsentExpired", func(t *testing.T) {
+		past := now.Add(-consentTimeout * 2)
+		a.countResponse(&agentTransaction{pair: k, attempt: 1, start: past}, past)
+		if c := a.Stats().Pairs[0].Consent; c != ConsentExpired {
+			t.Errorf("unexpected consent state %s", c)
+		}
+	})
+	t.Run("Session", func(t *testing.T) {
+		for _, agent := range concludeSession(t, nil, nil) {
+			for _, p := range agent.Stats().Pairs {
+				if p.RequestsSent == 0 || p.ResponsesReceived == 0 || p.Consent != ConsentGranted {
+					t.Errorf("unexpected stats: %+v", p)
+				}
+			}
+		}
+	})
+	t.Run("JSON", func(t *testing.T) {
+		b, err := json.Marshal(a.Stats())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v struct {
+			Pairs []struct {
+				Consent string `json:"consent"`
+				State   string `json:"state"`
+			} `json:"pairs"`
+			LocalCandidates []struct {
+				Type string `json:"type"`
+			} `json:"local_candidates"`
+		}
+		if err = json.Unmarshal(b, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Pairs[0].Consent != "expired" || v.LocalCandidates[0].Type != "Host" {
+			t.Errorf("unexpected JSON: %s", b)
+		}
+	})
+}
+
+func TestAgent_StatsData(t *testing.T) {
+	lAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+	rAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 2000}
+	connL, connR := packetPipe(lAddr, rAddr)
+	defer mustClose(t, connR)
+	received := make(chan struct{}, 1)
+	a, err := NewAgent(
+		withGatherer(&mockGatherer{
+			udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+				addr := Addr{IP: lAddr.IP, Port: lAddr.Port, Proto: candidate.UDP}
+				return []*localUDPCandidate{{
+					candidate: Candidate{Addr: addr, Base: addr, Type: candidate.Host, ComponentID: 1},
+					conn:      connL,
+				}}, nil
+			},
+		}),
+		WithPacketHandler(PacketRTP, func(p []byte, from net.Addr, conn net.PacketConn) {
+			received <- struct{}{}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	receive := func() {
+		t.Helper()
+		if _, err = connR.WriteTo([]byte{128, 111, 0, 1}, lAddr); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatal("packet is not handled")
+		}
+	}
+	t.Run("UnknownAddr", func(t *testing.T) {
+		receive()
+		if pairs := a.Stats().Pairs; len(pairs) != 0 {
+			t.Errorf("unexpected pairs: %+v", pairs)
+		}
+		a.statsMux.Lock()
+		count := len(a.stats)
+		a.statsMux.Unlock()
+		if count != 0 {
+			t.Errorf("unexpected counters count %d", count)
+		}
+	})
+	t.Run("Pair", func(t *testing.T) {
+		remote := Candidate{
+			Addr:        Addr{IP: rAddr.IP, Port: rAddr.Port, Proto: candidate.UDP},
+			Type:        candidate.Host,
+			ComponentID: 1,
+		}
+		if err = a.AddRemoteCandidates([]Candidate{remote}); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.PrepareChecklistSet(); err != nil {
+			t.Fatal(err)
+		}
+		receive()
+		pairs := a.Stats().Pairs
+		if len(pairs) != 1 || pairs[0].PacketsReceived != 1 || pairs[0].BytesReceived != 4 {
+			t.Errorf("unexpected pairs: %+v", pairs)
+		}
+	})
+}
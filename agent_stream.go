@@ -0,0 +1,211 @@
+package ice
+
+import (
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// stream is state of data stream, which is media stream in SDP.
+//
+// Data streams are identified by integer ID that is index in agent
+// candidate lists and checklist set, and optionally by mid. Removed streams
+// keep their ID, so IDs of other streams are stable.
+type stream struct {
+	mid       string
+	removed   bool
+	gathering bool // local candidates are being gathered
+	gathered  bool // local candidates are gathered
+	remote    bool // remote candidates are added
+
+	// Media-level credentials, the session-level ones are used if blank.
+	remoteUsername string
+	remotePassword string
+}
+
+var (
+	errStreamRemoved = errors.New("data stream with provided id is removed")
+	errMidExist      = errors.New("data stream with provided mid exists")
+	errNoMidFound    = errors.New("data stream with provided mid not found")
+	errBadStreamID   = errors.New("data stream id is out of range")
+)
+
+// maxStreams is maximum count of data streams, limiting allocation of
+// streams up to provided id.
+const maxStreams = 1024
+
+// streamAt returns data stream with provided id, allocating streams up to
+// the id if needed. Should be called with a.mux held.
+func (a *Agent) streamAt(streamID int) (*stream, error) {
+	if streamID < 0 || streamID >= maxStreams {
+		return nil, errBadStreamID
+	}
+	for len(a.streams) <= streamID {
+		a.streams = append(a.streams, &stream{})
+		a.localCandidates = append(a.localCandidates, nil)
+		a.remoteCandidates = append(a.remoteCandidates, nil)
+	}
+	return a.streams[streamID], nil
+}
+
+// streamByMid returns id of data stream with provided mid that is not
+// removed. Should be called with a.mux held.
+func (a *Agent) streamByMid(mid string) (int, bool) {
+	for id, s := range a.streams {
+		if s.mid == mid && !s.removed {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// streamRemoved reports whether data stream is removed. Should be called
+// with a.mux held.
+func (a *Agent) streamRemoved(streamID int) bool {
+	return streamID < len(a.streams) && a.streams[streamID].removed
+}
+
+// remoteCredentials returns remote ufrag and password for data stream,
+// falling back to the session-level ones. Should be called with a.mux held.
+func (a *Agent) remoteCredentials(streamID int) (username, password string) {
+	if streamID < len(a.streams) && a.streams[streamID].remoteUsername != "" {
+		s := a.streams[streamID]
+		return s.remoteUsername, s.remotePassword
+	}
+	return a.remoteUsername, a.remotePassword
+}
+
+// AddStream adds new data stream identified by mid, returning its id. The
+// stream can be added while agent is running, checklist for it is created
+// by next PrepareChecklistSet call.
+func (a *Agent) AddStream(mid string) (int, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if _, ok := a.streamByMid(mid); ok {
+		return 0, errMidExist
+	}
+	streamID := len(a.streams)
+	s, err := a.streamAt(streamID)
+	if err != nil {
+		return 0, err
+	}
+	s.mid = mid
+	return streamID, nil
+}
+
+// midStream returns id of data stream with provided mid.
+func (a *Agent) midStream(mid string) (int, error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	streamID, ok := a.streamByMid(mid)
+	if !ok {
+		return 0, errNoMidFound
+	}
+	return streamID, nil
+}
+
+// GatherCandidatesForMid gathers local candidates for data stream with
+// provided mid.
+func (a *Agent) GatherCandidatesForMid(mid string) error {
+	streamID, err := a.midStream(mid)
+	if err != nil {
+		return err
+	}
+	return a.GatherCandidatesForStream(streamID)
+}
+
+// LocalCandidatesForMid returns list of local candidates for data stream
+// with provided mid.
+func (a *Agent) LocalCandidatesForMid(mid string) ([]Candidate, error) {
+	streamID, err := a.midStream(mid)
+	if err != nil {
+		return nil, err
+	}
+	return a.LocalCandidatesForStream(streamID)
+}
+
+// AddRemoteCandidatesForMid adds remote candidate list to data stream with
+// provided mid.
+func (a *Agent) AddRemoteCandidatesForMid(mid string, c []Candidate) error {
+	streamID, err := a.midStream(mid)
+	if err != nil {
+		return err
+	}
+	return a.AddRemoteCandidatesForStream(streamID, c)
+}
+
+// SetRemoteCredentialsForMid sets media-level remote ufrag and password for
+// data stream with provided mid, overriding the ones that are set by
+// SetRemoteCredentials.
+func (a *Agent) SetRemoteCredentialsForMid(mid, username, password string) error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	streamID, ok := a.streamByMid(mid)
+	if !ok {
+		return errNoMidFound
+	}
+	s := a.streams[streamID]
+	s.remoteUsername = username
+	s.remotePassword = password
+	a.record(RecordEvent{
+		Type:     RecordRemoteCredentials,
+		Stream:   streamID,
+		Media:    true,
+		Username: username,
+		Password: password,
+	})
+	return nil
+}
+
+// RemoveStream stops connectivity checks for data stream with provided mid
+// and closes its local candidates. The stream can be removed while agent is
+// running.
+func (a *Agent) RemoveStream(mid string) error {
+	streamID, err := a.midStream(mid)
+	if err != nil {
+		return err
+	}
+	err = a.step(RecordEvent{Type: RecordRemovedStream, Stream: streamID}, func() error {
+		return a.removeStream(streamID)
+	})
+	if err != nil {
+		return err
+	}
+	a.log.Debug("removed stream", zap.String("mid", mid), zap.Int("stream", streamID))
+	return nil
+}
+
+// removeStream marks data stream as removed, failing its checklist, and
+// closes its local candidates.
+func (a *Agent) removeStream(streamID int) error {
+	a.mux.Lock()
+	if streamID < 0 || streamID >= len(a.streams) {
+		a.mux.Unlock()
+		return errNoStreamFound
+	}
+	if a.streams[streamID].removed {
+		a.mux.Unlock()
+		return errStreamRemoved
+	}
+	a.streams[streamID].removed = true
+	localCandidates := a.localCandidates[streamID]
+	a.localCandidates[streamID] = nil
+	a.remoteCandidates[streamID] = nil
+	a.unpublishHostCandidates(localCandidates)
+	if streamID < len(a.set) {
+		a.set[streamID] = Checklist{State: ChecklistFailed}
+		a.updateState()
+	}
+	a.mux.Unlock()
+
+	a.tMux.Lock()
+	for id, t := range a.t {
+		if t.checklist == streamID {
+			delete(a.t, id)
+		}
+	}
+	a.tMux.Unlock()
+
+	a.closeCandidates(localCandidates)
+	return nil
+}
@@ -0,0 +1,253 @@
+package ice
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/stun"
+)
+
+func TestAgent_Streams(t *testing.T) {
+	a, err := NewAgent(withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	remote := []Candidate{
+		{
+			Addr: Addr{
+				IP:    net.IPv4(10, 0, 0, 2),
+				Port:  2000,
+				Proto: candidate.UDP,
+			},
+			Type:        candidate.Host,
+			ComponentID: 1,
+			Foundation:  []byte{1, 2, 3, 4},
+		},
+	}
+	for _, mid := range []string{"audio", "video"} {
+		if _, err = a.AddStream(mid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err = a.AddStream("audio"); err != errMidExist {
+		t.Errorf("unexpected error %v", err)
+	}
+	// Streams can be gathered in any order.
+	for _, mid := range []string{"video", "audio"} {
+		if err = a.GatherCandidatesForMid(mid); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.AddRemoteCandidatesForMid(mid, remote); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = a.GatherCandidatesForMid("video"); err != errStreamAlreadyExist {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err = a.GatherCandidatesForMid("data"); err != errNoMidFound {
+		t.Errorf("unexpected error %v", err)
+	}
+	a.SetRemoteCredentials("session", "session-password")
+	if err = a.SetRemoteCredentialsForMid("video", "media", "media-password"); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.PrepareChecklistSet(); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.set) != 2 {
+		t.Fatalf("unexpected checklist count %d", len(a.set))
+	}
+	t.Run("Credentials", func(t *testing.T) {
+		for _, tc := range []struct {
+			streamID int
+			username string
+			password string
+		}{
+			{streamID: 0, username: "session", password: "session-password"},
+			{streamID: 1, username: "media", password: "media-password"},
+		} {
+			username, password := a.remoteCredentials(tc.streamID)
+			if username != tc.username || password != tc.password {
+				t.Errorf("stream %d: unexpected credentials %s:%s", tc.streamID, username, password)
+			}
+		}
+	})
+	t.Run("Remove", func(t *testing.T) {
+		if err := a.RemoveStream("audio"); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.RemoveStream("audio"); err != errNoMidFound {
+			t.Errorf("unexpected error %v", err)
+		}
+		if _, err := a.LocalCandidatesForStream(0); err != errStreamRemoved {
+			t.Errorf("unexpected error %v", err)
+		}
+		if len(a.set[0].Pairs) != 0 {
+			t.Error("pairs of removed stream should be dropped")
+		}
+		if _, id := a.nextChecklist(); id != 1 {
+			t.Errorf("unexpected next checklist %d", id)
+		}
+		if _, err := a.LocalCandidatesForMid("video"); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("AddRunning", func(t *testing.T) {
+		a.set[1].Pairs[0].State = PairInProgress
+		streamID, err := a.AddStream("audio")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if streamID != 2 {
+			t.Errorf("unexpected stream id %d", streamID)
+		}
+		if err = a.PrepareChecklistSet(); err != errStreamCountMismatch {
+			t.Errorf("unexpected error %v", err)
+		}
+		if err = a.GatherCandidatesForMid("audio"); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.AddRemoteCandidatesForMid("audio", remote); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.PrepareChecklistSet(); err != nil {
+			t.Fatal(err)
+		}
+		if len(a.set) != 3 {
+			t.Fatalf("unexpected checklist count %d", len(a.set))
+		}
+		if a.set[1].Pairs[0].State != PairInProgress {
+			t.Error("state of running checklist should not be changed")
+		}
+		if len(a.set[2].Pairs) != 1 {
+			t.Errorf("unexpected pairs count %d", len(a.set[2].Pairs))
+		}
+	})
+	t.Run("RemoveAll", func(t *testing.T) {
+		for _, mid := range []string{"video", "audio"} {
+			if err := a.RemoveStream(mid); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if a.state != Failed {
+			t.Errorf("unexpected state %s", a.state)
+		}
+	})
+}
+
+func TestAgent_StreamIDRange(t *testing.T) {
+	a, err := NewAgent(withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	for _, streamID := range []int{-1, maxStreams, 1 << 30} {
+		if err = a.GatherCandidatesForStream(streamID); err != errBadStreamID {
+			t.Errorf("%d: unexpected gather error %v", streamID, err)
+		}
+		if err = a.AddRemoteCandidatesForStream(streamID, nil); err != errBadStreamID {
+			t.Errorf("%d: unexpected add error %v", streamID, err)
+		}
+		if _, err = a.LocalCandidatesForStream(streamID); err != errNoStreamFound {
+			t.Errorf("%d: unexpected local candidates error %v", streamID, err)
+		}
+	}
+	if len(a.streams) != 0 {
+		t.Errorf("unexpected streams count %d", len(a.streams))
+	}
+}
+
+func TestAgent_GatherCandidatesForStreamConcurrent(t *testing.T) {
+	host := hostGatherer(net.IPv4(10, 0, 0, 1), 1000)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fail := true
+	a, err := NewAgent(withGatherer(&mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			started <- struct{}{}
+			<-release
+			if fail {
+				return nil, errors.New("failed")
+			}
+			return host.gatherUDP(opt)
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	gather := func() <-chan error {
+		errs := make(chan error, 1)
+		go func() { errs <- a.GatherCandidatesForStream(0) }()
+		<-started
+		return errs
+	}
+	errs := gather()
+	if err = a.GatherCandidatesForStream(0); err != errStreamAlreadyExist {
+		t.Errorf("unexpected concurrent gather error %v", err)
+	}
+	release <- struct{}{}
+	if err = <-errs; err == nil {
+		t.Fatal("should fail")
+	}
+	// Failed gathering should not mark stream.
+	fail = false
+	errs = gather()
+	release <- struct{}{}
+	if err = <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if err = a.GatherCandidatesForStream(0); err != errStreamAlreadyExist {
+		t.Errorf("unexpected repeated gather error %v", err)
+	}
+	if len(a.localCandidates[0]) != 1 {
+		t.Errorf("unexpected candidates count %d", len(a.localCandidates[0]))
+	}
+}
+
+func TestAgent_StreamSharedAddr(t *testing.T) {
+	// Streams share address of local candidate as with UDPMux.
+	a, err := NewAgent(withGatherer(hostGatherer(net.IPv4(10, 0, 0, 1), 1000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	a.SetRemoteCredentials("RFRAG", "RPASS")
+	for _, mid := range []string{"audio", "video"} {
+		if _, err = a.AddStream(mid); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.GatherCandidatesForMid(mid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = a.SetRemoteCredentialsForMid("video", "VFRAG", "VPASS"); err != nil {
+		t.Fatal(err)
+	}
+	local := Addr{IP: net.IPv4(10, 0, 0, 1), Port: 1000, Proto: candidate.UDP}
+	for streamID := 0; streamID < 2; streamID++ {
+		a.mux.Lock()
+		c, ok := a.localCandidate(streamID, local)
+		a.mux.Unlock()
+		if !ok || c.stream != streamID {
+			t.Errorf("%d: unexpected candidate %+v", streamID, c)
+		}
+	}
+	pair := &Pair{
+		Local:  Candidate{Addr: local},
+		Remote: Candidate{Addr: Addr{IP: net.IPv4(10, 0, 0, 2), Port: 2000, Proto: candidate.UDP}},
+	}
+	res := stun.MustBuild(stun.TransactionID, stun.BindingSuccess,
+		&stun.XORMappedAddress{IP: local.IP, Port: local.Port},
+		stun.NewShortTermIntegrity("VPASS"), stun.Fingerprint,
+	)
+	if err = a.processBindingResponse(&agentTransaction{checklist: 1}, pair, res, pair.Remote.Addr); err != nil {
+		t.Errorf("unexpected video error %v", err)
+	}
+	if err = a.processBindingResponse(&agentTransaction{checklist: 0}, pair, res, pair.Remote.Addr); err != stun.ErrIntegrityMismatch {
+		t.Errorf("unexpected audio error %v", err)
+	}
+}
@@ -101,13 +101,13 @@ func TestAgent_processUDP(t *testing.T) {
 		}
 		mustInit(t, a)
 		t.Run("Not STUN", func(t *testing.T) {
-			if err := a.processUDP([]byte{1, 2}, &localUDPCandidate{}, &net.UDPAddr{}); err != errNotSTUNMessage {
+			if err := a.processUDP([]byte{1, 2}, &localUDPCandidate{}, &net.UDPAddr{}, time.Now()); err != errNotSTUNMessage {
 				t.Errorf("should be notStun, got %v", err)
 			}
 		})
 		t.Run("No transaction", func(t *testing.T) {
 			m := stun.MustBuild(stun.TransactionID, stun.BindingSuccess)
-			if err := a.processUDP(m.Raw, &localUDPCandidate{}, &net.UDPAddr{}); err != nil {
+			if err := a.processUDP(m.Raw, &localUDPCandidate{}, &net.UDPAddr{}, time.Now()); err != nil {
 				t.Error(err)
 			}
 		})
@@ -115,7 +115,7 @@ func TestAgent_processUDP(t *testing.T) {
 			m := stun.MustBuild(stun.TransactionID, stun.BindingSuccess, stun.XORMappedAddress{
 				IP: net.IPv4(1, 2, 3, 4),
 			}, stun.Fingerprint)
-			if err := a.processUDP(m.Raw[:len(m.Raw)-2], &localUDPCandidate{}, &net.UDPAddr{}); err == nil {
+			if err := a.processUDP(m.Raw[:len(m.Raw)-2], &localUDPCandidate{}, &net.UDPAddr{}, time.Now()); err == nil {
 				t.Error("should error")
 			} else {
 				if err == errNotSTUNMessage {
@@ -184,7 +184,7 @@ func TestAgent_handleBindingResponse(t *testing.T) {
 		stun.NewUsername("RFRAG:LFRAG"), &xorAddr,
 		integrity, stun.Fingerprint,
 	)
-	if err := a.handleBindingResponse(at, pair, msg, pair.Remote.Addr); err != nil {
+	if err := a.handleBindingResponse(at, pair, msg, pair.Remote.Addr, time.Now()); err != nil {
 		t.Fatal(err)
 	}
 	if len(a.set[0].Valid) == 0 {
@@ -275,7 +275,7 @@ func TestAgent_check(t *testing.T) {
 				t.Fatal("failed to startCheck", err)
 			}
 			resp := stun.MustBuild(stun.NewTransactionIDSetter(tid), stun.BindingSuccess, xorAddr, integrity, stun.Fingerprint)
-			if err := a.processBindingResponse(nil, pair, resp, pair.Remote.Addr); err != nil {
+			if err := a.processBindingResponse(&agentTransaction{}, pair, resp, pair.Remote.Addr); err != nil {
 				t.Error(err)
 			}
 		})
@@ -304,7 +304,7 @@ func TestAgent_check(t *testing.T) {
 				t.Fatal("failed to startCheck", err)
 			}
 			resp := stun.MustBuild(stun.NewTransactionIDSetter(tid), stun.BindingSuccess, xorAddr, integrity, stun.Fingerprint)
-			if err := a.processBindingResponse(nil, pair, resp, pair.Remote.Addr); err != nil {
+			if err := a.processBindingResponse(&agentTransaction{}, pair, resp, pair.Remote.Addr); err != nil {
 				t.Error(err)
 			}
 		})
@@ -330,7 +330,7 @@ func TestAgent_check(t *testing.T) {
 			t.Fatal(err)
 		}
 		resp := stun.MustBuild(stun.NewTransactionIDSetter(tid), stun.BindingError, stun.CodeBadRequest, integrity, stun.Fingerprint)
-		if err := a.processBindingResponse(nil, pair, resp, pair.Remote.Addr); err != codeErr {
+		if err := a.processBindingResponse(&agentTransaction{}, pair, resp, pair.Remote.Addr); err != codeErr {
 			t.Fatalf("unexpected error %v", err)
 		}
 	})
@@ -344,7 +344,7 @@ func TestAgent_check(t *testing.T) {
 			t.Fatal(err)
 		}
 		resp := stun.MustBuild(tid, stun.BindingError, integrity, stun.Fingerprint)
-		if err := a.processBindingResponse(nil, pair, resp, pair.Remote.Addr); err == nil {
+		if err := a.processBindingResponse(&agentTransaction{}, pair, resp, pair.Remote.Addr); err == nil {
 			t.Fatal("unexpected success")
 		}
 	})
@@ -358,7 +358,7 @@ func TestAgent_check(t *testing.T) {
 		if err := a.startCheck(pair, now); err != nil {
 			t.Fatal(err)
 		}
-		if err := a.processBindingResponse(nil, pair, resp, pair.Remote.Addr); err != errRoleConflict {
+		if err := a.processBindingResponse(&agentTransaction{}, pair, resp, pair.Remote.Addr); err != errRoleConflict {
 			t.Fatalf("unexpected error: %v", err)
 		}
 	})
@@ -373,7 +373,7 @@ func TestAgent_check(t *testing.T) {
 		}
 		i := stun.NewShortTermIntegrity("RPASS+BAD")
 		resp := stun.MustBuild(tid, stun.BindingSuccess, i, xorAddr, stun.Fingerprint)
-		if err := a.processBindingResponse(nil, pair, resp, pair.Remote.Addr); err != stun.ErrIntegrityMismatch {
+		if err := a.processBindingResponse(&agentTransaction{}, pair, resp, pair.Remote.Addr); err != stun.ErrIntegrityMismatch {
 			t.Fatalf("unexpected error: %v", err)
 		}
 	})
@@ -387,7 +387,7 @@ func TestAgent_check(t *testing.T) {
 			t.Fatal(err)
 		}
 		resp := stun.MustBuild(tid, stun.BindingSuccess, integrity)
-		if err := a.processBindingResponse(nil, pair, resp, pair.Remote.Addr); err != errFingerprintNotFound {
+		if err := a.processBindingResponse(&agentTransaction{}, pair, resp, pair.Remote.Addr); err != errFingerprintNotFound {
 			t.Fatalf("unexpected error: %v", err)
 		}
 	})
@@ -402,7 +402,7 @@ func TestAgent_check(t *testing.T) {
 		}
 		badFP := stun.RawAttribute{Type: stun.AttrFingerprint, Value: []byte{'b', 'a', 'd', 0}}
 		resp := stun.MustBuild(tid, stun.BindingSuccess, integrity, badFP)
-		if err := a.processBindingResponse(nil, pair, resp, pair.Remote.Addr); err != stun.ErrFingerprintMismatch {
+		if err := a.processBindingResponse(&agentTransaction{}, pair, resp, pair.Remote.Addr); err != stun.ErrFingerprintMismatch {
 			t.Fatalf("unexpected error: %v", err)
 		}
 		t.Run("Should be done before integrity startCheck", func(t *testing.T) {
@@ -417,7 +417,7 @@ func TestAgent_check(t *testing.T) {
 			i := stun.NewShortTermIntegrity("RPASS+BAD")
 			badFP := stun.RawAttribute{Type: stun.AttrFingerprint, Value: []byte{'b', 'a', 'd', 0}}
 			resp := stun.MustBuild(tid, stun.BindingSuccess, i, badFP)
-			if err := a.processBindingResponse(nil, pair, resp, pair.Remote.Addr); err != stun.ErrFingerprintMismatch {
+			if err := a.processBindingResponse(&agentTransaction{}, pair, resp, pair.Remote.Addr); err != stun.ErrFingerprintMismatch {
 				t.Fatalf("unexpected error: %v", err)
 			}
 		})
@@ -433,7 +433,7 @@ func TestAgent_check(t *testing.T) {
 			t.Fatal(err)
 		}
 		resp := stun.MustBuild(tid, stun.BindingRequest, stun.CodeBadRequest, integrity, stun.Fingerprint)
-		if err := a.processBindingResponse(nil, pair, resp, pair.Remote.Addr); err != typeErr {
+		if err := a.processBindingResponse(&agentTransaction{}, pair, resp, pair.Remote.Addr); err != typeErr {
 			t.Fatalf("unexpected success")
 		}
 	})
@@ -1497,3 +1497,41 @@ func TestWithServer(t *testing.T) {
 		})
 	})
 }
+
+func TestAgent_gatherServerReflexive(t *testing.T) {
+	server := listenLoopback(t)
+	defer mustClose(t, server)
+	mapped := net.IPv4(203, 0, 113, 1)
+	go serveSTUN(server, mapped)
+	// Loopback addresses are not gathered, so host candidate is mocked.
+	hostConn := listenLoopback(t)
+	local := hostConn.LocalAddr().(*net.UDPAddr)
+	host := Addr{IP: local.IP, Port: local.Port, Proto: candidate.UDP}
+	gatherer := &mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			c := Candidate{Base: host, Addr: host, Type: candidate.Host, ComponentID: 1}
+			c.Foundation = Foundation(&c, Addr{})
+			c.Priority = Priority(TypePreference(c.Type), singleIPAddrPreference, c.ComponentID)
+			return []*localUDPCandidate{{candidate: c, conn: hostConn}}, nil
+		},
+	}
+	a, err := NewAgent(withGatherer(gatherer), WithSTUN("stun:"+server.LocalAddr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	candidates, err := a.LocalCandidates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("unexpected candidates: %v", candidates)
+	}
+	if c := candidates[1]; c.Type != candidate.ServerReflexive || !c.Addr.IP.Equal(mapped) ||
+		c.Addr.Port != host.Port || !c.Base.Equal(host) || !c.Related.Equal(host) {
+		t.Errorf("unexpected candidate %+v", c)
+	}
+}
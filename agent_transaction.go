@@ -2,7 +2,6 @@ package ice
 
 import (
 	"errors"
-	"net"
 	"time"
 
 	"go.uber.org/zap"
@@ -14,6 +13,7 @@ type transactionID [stun.TransactionIDSize]byte
 
 func (t transactionID) AddTo(m *stun.Message) error {
 	m.TransactionID = t
+	m.WriteTransactionID()
 	return nil
 }
 
@@ -32,6 +32,7 @@ type agentTransaction struct {
 	raw         []byte
 	attempt     int
 	maxAttempts int
+	span        CheckSpan // nil if not tracing
 }
 
 func (t *agentTransaction) setDeadline(now time.Time) {
@@ -40,7 +41,8 @@ func (t *agentTransaction) setDeadline(now time.Time) {
 
 // handleTimeout handles maximum attempts reached state for transaction,
 // updating the pair states to failed.
-func (a *Agent) handleTimeout(t *agentTransaction) error {
+func (a *Agent) handleTimeout(t *agentTransaction, now time.Time) error {
+	t.traceCheck(TraceTimeout, now, nil)
 	a.mux.Lock()
 	p, ok := a.getPair(t.checklist, t.pair)
 	if !ok {
@@ -56,6 +58,7 @@ func (a *Agent) handleTimeout(t *agentTransaction) error {
 	for i := range cl.Pairs {
 		if samePair(&cl.Pairs[i], p) {
 			cl.Pairs[i].State = PairFailed
+			a.tracePair(TracePairState, t.checklist, &cl.Pairs[i])
 		}
 	}
 	a.mux.Unlock()
@@ -63,27 +66,28 @@ func (a *Agent) handleTimeout(t *agentTransaction) error {
 }
 
 // retry re-sends same binding request to associated candidate.
-func (a *Agent) retry(t *agentTransaction) {
+func (a *Agent) retry(t *agentTransaction, now time.Time) {
 	a.mux.Lock()
 	p, ok := a.getPair(t.checklist, t.pair)
-	a.mux.Unlock()
 	if !ok {
+		a.mux.Unlock()
 		a.log.Warn("failed to pick pair for retry")
 		return
 	}
-	c, ok := a.localCandidateByAddr(p.Local.Addr)
+	c, ok := a.localCandidate(t.checklist, p.Local.Addr)
+	a.mux.Unlock()
 	if !ok {
 		a.log.Warn("failed to pick local candidate for retry")
 		return
 	}
-	udpAddr := &net.UDPAddr{
-		IP:   p.Remote.Addr.IP,
-		Port: p.Remote.Addr.Port,
-	}
-	_, err := c.conn.WriteTo(t.raw, udpAddr)
+	_, err := c.conn.WriteTo(t.raw, p.remoteUDPAddr())
 	if err != nil {
 		a.log.Error("failed to write", zap.Error(err))
+		return
 	}
+	a.inc(CounterRetransmits)
+	a.count(t.pair, func(s *pairCounters) { s.retransmissions++ })
+	t.traceCheck(TraceRetransmit, now, nil)
 }
 
 const defaultTransactionCap = 30
@@ -118,7 +122,8 @@ func (a *Agent) collect(now time.Time) {
 			toRetry = append(toRetry, t)
 			continue
 		}
-		if err := a.handleTimeout(t); err != nil {
+		a.inc(CounterTimeouts)
+		if err := a.handleTimeout(t, now); err != nil {
 			a.log.Error("failed to handle timeout", zap.Error(err))
 		}
 	}
@@ -130,6 +135,6 @@ func (a *Agent) collect(now time.Time) {
 	a.tMux.Unlock()
 
 	for _, t := range toRetry {
-		a.retry(t)
+		a.retry(t, now)
 	}
 }
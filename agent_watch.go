@@ -0,0 +1,270 @@
+package ice
+
+import (
+	"go.uber.org/zap"
+
+	ct "gortc.io/ice/candidate"
+	"gortc.io/ice/gather"
+)
+
+// CandidateHandler is called for local candidates that are gathered while
+// agent is running, e.g. on network changes, so they can be sent to remote
+// agent via trickle ICE.
+type CandidateHandler func(streamID int, c Candidate)
+
+// addrGatherer gathers host candidates on single address, which is used for
+// addresses that are added after gathering.
+type addrGatherer interface {
+	gatherAddrUDP(addr HostAddr, opt gathererOptions) ([]*localUDPCandidate, error)
+}
+
+// watch handles host address changes until watcher is closed.
+func (a *Agent) watch(w gather.Watcher) {
+	defer a.watching.Done()
+	for e := range w.Events() {
+		a.log.Debug("host address changed",
+			zap.Stringer("event", e.Type), zap.Stringer("addr", e.Addr),
+		)
+		switch e.Type {
+		case gather.AddrAdded:
+			a.addHostAddr(e.Addr)
+		case gather.AddrRemoved:
+			a.removeHostAddr(e.Addr)
+		}
+	}
+}
+
+// addHostAddr gathers host candidates on added address for all gathered
+// data streams.
+func (a *Agent) addHostAddr(addr gather.Addr) {
+	log := a.log.With(zap.Stringer("addr", addr))
+	g, ok := a.gatherer.(addrGatherer)
+	if !ok {
+		log.Debug("gatherer does not support added addresses")
+		return
+	}
+	if a.ipv4Only && addr.IP.To4() == nil {
+		return
+	}
+	allowed, filtered := a.filter.Filter([]gather.Addr{addr})
+	for _, f := range filtered {
+		log.Debug("filtered host address", zap.Stringer("addr", f))
+		a.mux.Lock()
+		a.filtered = append(a.filtered, f)
+		a.mux.Unlock()
+	}
+	hostAddrs, err := hostAddresses(allowed, a.linkLocal)
+	if err != nil || len(hostAddrs) == 0 {
+		return
+	}
+	var streams []int
+	a.mux.Lock()
+	for streamID, s := range a.streams {
+		if s.gathered && !s.removed {
+			streams = append(streams, streamID)
+		}
+	}
+	a.mux.Unlock()
+	for _, streamID := range streams {
+		candidates, gatherErr := g.gatherAddrUDP(hostAddrs[0], a.gathererOptions())
+		if gatherErr != nil {
+			log.Warn("failed to gather", zap.Int("stream", streamID), zap.Error(gatherErr))
+			continue
+		}
+		a.captureCandidates(candidates)
+		if a.nat != nil {
+			candidates = a.nat.apply(candidates)
+		}
+		a.addLocalCandidates(streamID, candidates)
+	}
+}
+
+// addLocalCandidates adds candidates to running data stream, pairing them
+// with remote candidates if checklist is prepared.
+func (a *Agent) addLocalCandidates(streamID int, candidates []*localUDPCandidate) {
+	e := RecordEvent{Type: RecordAddedCandidates, Stream: streamID}
+	if a.recorder != nil {
+		e.Candidates = recordedCandidates(candidates)
+	}
+	_ = a.step(e, func() error {
+		a.addCandidates(streamID, candidates)
+		return nil
+	})
+}
+
+// addCandidates publishes host candidates via mDNS if enabled and adds
+// candidates to data stream. Publishing is done here, so random names are
+// read during recorded step and replayed deterministically.
+func (a *Agent) addCandidates(streamID int, candidates []*localUDPCandidate) {
+	if a.mdnsMode == MulticastDNSQueryAndGather {
+		if err := a.publishHostCandidates(candidates); err != nil {
+			a.log.Warn("failed to publish", zap.Error(err))
+		}
+	}
+	a.mux.Lock()
+	if a.streams[streamID].removed {
+		a.unpublishHostCandidates(candidates)
+		a.mux.Unlock()
+		a.closeCandidates(candidates)
+		return
+	}
+	for _, c := range candidates {
+		c.stream = streamID
+	}
+	local := a.allowedCandidates(candidates)
+	a.localCandidates[streamID] = append(a.localCandidates[streamID], candidates...)
+	if streamID < len(a.set) {
+		a.addPairs(streamID, local, a.remoteCandidates[streamID])
+	}
+	a.mux.Unlock()
+	a.startCandidates(candidates)
+	if a.onCandidate == nil {
+		return
+	}
+	for _, c := range local {
+		a.onCandidate(streamID, a.hideHostAddr(c))
+	}
+}
+
+// addPairs pairs new local or remote candidates in checklist of data
+// stream. Existing pairs are preferred over redundant new ones, and only
+// frozen pairs are removed to fit maxChecks, so checks in progress and
+// their results are kept. Should be called with a.mux held.
+func (a *Agent) addPairs(streamID int, local, remote []Candidate) {
+	pairs := NewPairs(local, remote)
+	if len(pairs) == 0 {
+		return
+	}
+	c := a.set[streamID]
+	added := Checklist{Pairs: pairs}
+	added.ComputePriorities(a.role)
+	added.SortPolicy(a.policy)
+	c.Pairs = append(c.Pairs, added.Pairs...)
+	c.Prune()
+	c.SortPolicy(a.policy)
+	limitFrozen(&c, a.maxChecks)
+	if c.State == ChecklistFailed {
+		c.State = ChecklistRunning
+	}
+	a.set[streamID] = c
+	a.updateState()
+}
+
+// limitFrozen removes frozen pairs with least priority while count of pairs
+// exceeds max.
+func limitFrozen(c *Checklist, max int) {
+	for i := len(c.Pairs) - 1; i >= 0 && len(c.Pairs) > max; i-- {
+		if c.Pairs[i].State == PairFrozen {
+			c.Pairs = append(c.Pairs[:i], c.Pairs[i+1:]...)
+		}
+	}
+}
+
+// removeHostAddr removes local candidates on removed address, failing their
+// pairs, so other pairs can be checked and nominated.
+func (a *Agent) removeHostAddr(addr gather.Addr) {
+	_ = a.step(RecordEvent{Type: RecordRemovedAddr, Addr: &addr}, func() error {
+		a.removeAddr(addr)
+		return nil
+	})
+}
+
+func (a *Agent) removeAddr(addr gather.Addr) {
+	var closed []*localUDPCandidate
+	a.mux.Lock()
+	for streamID, candidates := range a.localCandidates {
+		var removed []Addr
+		for _, c := range candidates {
+			if c.candidate.Type == ct.Host && c.candidate.Base.IP.Equal(addr.IP) {
+				removed = append(removed, c.candidate.Addr)
+			}
+		}
+		if len(removed) == 0 {
+			continue
+		}
+		kept := make([]*localUDPCandidate, 0, len(candidates))
+		for _, c := range candidates {
+			if !onRemovedBase(c.candidate, addr, removed) && !relayedOn(c, removed) {
+				kept = append(kept, c)
+				continue
+			}
+			closed = append(closed, c)
+			if c.candidate.Type != ct.Host {
+				removed = append(removed, c.candidate.Addr)
+			}
+		}
+		a.localCandidates[streamID] = kept
+		if streamID < len(a.set) && !a.streamRemoved(streamID) {
+			a.failPairs(streamID, removed)
+		}
+	}
+	a.unpublishHostCandidates(closed)
+	a.updateState()
+	a.mux.Unlock()
+	for _, c := range closed {
+		a.log.Debug("removed local candidate", zap.Stringer("addr", c.candidate.Addr))
+	}
+	a.closeCandidates(closed)
+}
+
+// onRemovedBase reports whether local candidate is host candidate on
+// removed address or reflexive candidate of such host candidate.
+func onRemovedBase(c Candidate, addr gather.Addr, hosts []Addr) bool {
+	if c.Base.IP.Equal(addr.IP) {
+		return true
+	}
+	for _, h := range hosts {
+		if c.Base.Equal(h) {
+			return true
+		}
+	}
+	return false
+}
+
+// failPairs sets state of pairs with provided local addresses to failed,
+// removing them from valid list and triggered check queue. Should be called
+// with a.mux held.
+func (a *Agent) failPairs(streamID int, local []Addr) {
+	removed := func(p *Pair) bool {
+		for _, addr := range local {
+			if p.Local.Addr.Equal(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	c := a.set[streamID]
+	allFailed := true
+	for i := range c.Pairs {
+		if removed(&c.Pairs[i]) && c.Pairs[i].State != PairFailed {
+			c.Pairs[i].State = PairFailed
+			a.tracePair(TracePairState, streamID, &c.Pairs[i])
+		}
+		if c.Pairs[i].State != PairFailed {
+			allFailed = false
+		}
+	}
+	valid := make(Pairs, 0, len(c.Valid))
+	for i := range c.Valid {
+		if !removed(&c.Valid[i]) {
+			valid = append(valid, c.Valid[i])
+		}
+	}
+	validRemoved := len(valid) < len(c.Valid)
+	c.Valid = valid
+	triggered := make(Pairs, 0, len(c.Triggered))
+	for i := range c.Triggered {
+		if !removed(&c.Triggered[i]) {
+			triggered = append(triggered, c.Triggered[i])
+		}
+	}
+	c.Triggered = triggered
+	switch {
+	case allFailed && len(c.Valid) == 0:
+		c.State = ChecklistFailed
+	case validRemoved && c.State == ChecklistCompleted:
+		// Checklist is completed again by updateState if still concluded.
+		c.State = ChecklistRunning
+	}
+	a.set[streamID] = c
+}
@@ -0,0 +1,175 @@
+package ice
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/ice/gather"
+)
+
+func TestAgent_NetworkWatcher(t *testing.T) {
+	var (
+		w        = gather.NewFakeWatcher()
+		l        = &portListener{busy: make(map[int]bool)}
+		gathered = make(chan Candidate, 10)
+	)
+	a, err := NewAgent(
+		withGatherer(systemCandidateGatherer{
+			addr:   staticGatherer{{IP: net.IPv4(10, 0, 0, 1), Interface: "eth0"}},
+			listen: l.listen,
+		}),
+		WithAddrFilter(AddrFilter{ExcludeInterfaces: []string{"docker*"}}),
+		WithNetworkWatcher(w),
+		WithCandidateHandler(func(streamID int, c Candidate) {
+			if streamID != defaultStreamID {
+				t.Errorf("unexpected stream %d", streamID)
+			}
+			gathered <- c
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	remote := Addr{IP: net.IPv4(10, 0, 0, 100), Port: 3000, Proto: candidate.UDP}
+	if err = a.AddRemoteCandidates([]Candidate{{
+		Addr: remote, Base: remote, Type: candidate.Host, ComponentID: 1, Priority: 1000,
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.PrepareChecklistSet(); err != nil {
+		t.Fatal(err)
+	}
+	// addAddr adds address and waits for candidate to be gathered on it.
+	addAddr := func(t *testing.T, ip net.IP) {
+		t.Helper()
+		w.Add(gather.Addr{IP: ip, Interface: "eth1"})
+		select {
+		case c := <-gathered:
+			if !c.Addr.IP.Equal(ip) || c.Type != candidate.Host {
+				t.Errorf("unexpected candidate %s", c.Addr)
+			}
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out")
+		}
+	}
+	pairStates := func() map[string]PairState {
+		a.mux.Lock()
+		defer a.mux.Unlock()
+		states := make(map[string]PairState)
+		for _, p := range a.set[defaultStreamID].Pairs {
+			states[p.Local.Addr.IP.String()] = p.State
+		}
+		return states
+	}
+	t.Run("Added", func(t *testing.T) {
+		w.Add(gather.Addr{IP: net.IPv4(172, 17, 0, 1), Interface: "docker0"})
+		addAddr(t, net.IPv4(10, 0, 0, 2))
+		candidates, err := a.LocalCandidates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) != 2 {
+			t.Errorf("unexpected candidates: %v", candidates)
+		}
+		if len(pairStates()) != 2 {
+			t.Errorf("unexpected pairs: %v", pairStates())
+		}
+		if filtered := a.FilteredAddrs(); len(filtered) != 1 || filtered[0].Addr.Interface != "docker0" {
+			t.Errorf("unexpected filtered addresses: %v", filtered)
+		}
+	})
+	t.Run("Removed", func(t *testing.T) {
+		w.Remove(gather.Addr{IP: net.IPv4(10, 0, 0, 1)})
+		// Events are handled sequentially.
+		addAddr(t, net.IPv4(10, 0, 0, 3))
+		candidates, err := a.LocalCandidates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, c := range candidates {
+			if c.Addr.IP.Equal(net.IPv4(10, 0, 0, 1)) {
+				t.Error("candidate on removed address is not removed")
+			}
+		}
+		states := pairStates()
+		if states["10.0.0.1"] != PairFailed {
+			t.Errorf("pair on removed address is %s", states["10.0.0.1"])
+		}
+		if states["10.0.0.2"] == PairFailed || states["10.0.0.3"] == PairFailed {
+			t.Errorf("unexpected states: %v", states)
+		}
+	})
+	t.Run("Failover", func(t *testing.T) {
+		w.Remove(gather.Addr{IP: net.IPv4(10, 0, 0, 2)})
+		w.Remove(gather.Addr{IP: net.IPv4(10, 0, 0, 3)})
+		w.Add(gather.Addr{IP: net.IPv4(172, 17, 0, 2), Interface: "docker0"})
+		a.mux.Lock()
+		state, checklistState := a.state, a.set[defaultStreamID].State
+		a.mux.Unlock()
+		if state != Failed || checklistState != ChecklistFailed {
+			t.Errorf("unexpected states %s, %s", state, checklistState)
+		}
+		addAddr(t, net.IPv4(10, 0, 0, 4))
+		a.mux.Lock()
+		state, checklistState = a.state, a.set[defaultStreamID].State
+		a.mux.Unlock()
+		if state != Running || checklistState != ChecklistRunning {
+			t.Errorf("unexpected states %s, %s", state, checklistState)
+		}
+	})
+}
+
+func TestAgent_addPairs(t *testing.T) {
+	newCandidate := func(ip net.IP, priority int) Candidate {
+		addr := Addr{IP: ip, Port: 1000, Proto: candidate.UDP}
+		return Candidate{
+			Addr: addr, Base: addr, Type: candidate.Host, ComponentID: 1, Priority: priority,
+		}
+	}
+	remote := newCandidate(net.IPv4(10, 0, 0, 100), 100)
+	existing := func(ip net.IP, state PairState) Pair {
+		return Pair{
+			Local: newCandidate(ip, 1), Remote: remote, ComponentID: 1, Priority: 1, State: state,
+		}
+	}
+	a := &Agent{
+		log:       zap.NewNop(),
+		maxChecks: 3,
+		set: ChecklistSet{{Pairs: Pairs{
+			existing(net.IPv4(10, 0, 0, 1), PairInProgress),
+			existing(net.IPv4(10, 0, 0, 2), PairSucceeded),
+		}}},
+		remoteCandidates: [][]Candidate{{remote}},
+	}
+	a.addPairs(0, []Candidate{
+		newCandidate(net.IPv4(10, 0, 0, 3), 2000),
+		newCandidate(net.IPv4(10, 0, 0, 4), 1000),
+		// Redundant to in-progress pair.
+		newCandidate(net.IPv4(10, 0, 0, 1), 3000),
+	}, []Candidate{remote})
+	states := make(map[string]PairState)
+	for _, p := range a.set[0].Pairs {
+		states[p.Local.Addr.IP.String()] = p.State
+	}
+	expected := map[string]PairState{
+		"10.0.0.1": PairInProgress,
+		"10.0.0.2": PairSucceeded,
+		"10.0.0.3": PairFrozen,
+	}
+	if len(states) != len(expected) || len(a.set[0].Pairs) != len(expected) {
+		t.Fatalf("unexpected pairs: %v", states)
+	}
+	for ip, state := range expected {
+		if states[ip] != state {
+			t.Errorf("%s: %s (got) != %s (expected)", ip, states[ip], state)
+		}
+	}
+}
@@ -5,19 +5,31 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"net"
+	"strings"
 
 	ct "gortc.io/ice/candidate"
 )
 
 // Addr represents transport address, the combination of an IP address
 // and the transport protocol (such as UDP or TCP) port.
+//
+// The Host is set for addresses that are represented by host name, like
+// mDNS host candidates. The IP can be blank if Host is not resolved yet.
+//
+// The Zone is IPv6 scoped addressing zone, which is set for link-local
+// addresses of local candidates and packet sources.
 type Addr struct {
 	IP    net.IP      `json:"ip,omitempty"`
+	Zone  string      `json:"zone,omitempty"`
+	Host  string      `json:"host,omitempty"`
 	Port  int         `json:"port,omitempty"`
 	Proto ct.Protocol `json:"proto,omitempty"`
 }
 
 // Equal returns true of b equals to a.
+//
+// Host names are compared only if both addresses are not resolved. Zones are
+// compared only if both are set, as remote candidates have no zone.
 func (a Addr) Equal(b Addr) bool {
 	if a.Proto != b.Proto {
 		return false
@@ -25,10 +37,22 @@ func (a Addr) Equal(b Addr) bool {
 	if a.Port != b.Port {
 		return false
 	}
+	if a.Zone != "" && b.Zone != "" && a.Zone != b.Zone {
+		return false
+	}
+	if len(a.IP) == 0 && len(b.IP) == 0 {
+		return strings.EqualFold(a.Host, b.Host)
+	}
 	return a.IP.Equal(b.IP)
 }
 
 func (a Addr) String() string {
+	if len(a.IP) == 0 && a.Host != "" {
+		return fmt.Sprintf("%s:%d/%s", a.Host, a.Port, a.Proto)
+	}
+	if a.Zone != "" {
+		return fmt.Sprintf("%s%%%s:%d/%s", a.IP, a.Zone, a.Port, a.Proto)
+	}
 	return fmt.Sprintf("%s:%d/%s", a.IP, a.Port, a.Proto)
 }
 
@@ -51,6 +75,7 @@ type Candidate struct {
 	Related         Addr    `json:"related,omitempty"`
 	ComponentID     int     `json:"component_id"`
 	LocalPreference int     `json:"local_preference"`
+	NetworkCost     int     `json:"network_cost,omitempty"`
 }
 
 // Equal reports whether c equals to b.
@@ -0,0 +1,80 @@
+package ice
+
+import (
+	"encoding/binary"
+	"net"
+
+	ct "gortc.io/ice/candidate"
+	"gortc.io/ice/sdp"
+)
+
+// sdpAddress returns SDP representation of host part of a.
+func sdpAddress(a Addr) sdp.Address {
+	switch {
+	case len(a.IP) == 0 && a.Host != "":
+		return sdp.Address{Type: sdp.AddressFQDN, Host: []byte(a.Host)}
+	case a.IP.To4() == nil:
+		return sdp.Address{Type: sdp.AddressIPv6, IP: a.IP}
+	default:
+		return sdp.Address{Type: sdp.AddressIPv4, IP: a.IP}
+	}
+}
+
+// addrFromSDP returns Addr from SDP address and port, copying IP.
+func addrFromSDP(a sdp.Address, port int, proto ct.Protocol) Addr {
+	addr := Addr{
+		Port:  port,
+		Proto: proto,
+	}
+	if a.Type == sdp.AddressFQDN {
+		addr.Host = string(a.Host)
+		return addr
+	}
+	if len(a.IP) > 0 {
+		addr.IP = make(net.IP, len(a.IP))
+		copy(addr.IP, a.IP)
+	}
+	return addr
+}
+
+// CandidateToSDP returns SDP representation of candidate.
+//
+// Only first 4 bytes of foundation are used, as SDP foundation is represented
+// as integer.
+func CandidateToSDP(c Candidate) sdp.Candidate {
+	s := sdp.Candidate{
+		ConnectionAddress: sdpAddress(c.Addr),
+		Port:              c.Addr.Port,
+		ComponentID:       c.ComponentID,
+		Priority:          c.Priority,
+		NetworkCost:       c.NetworkCost,
+		Transport:         c.Addr.Proto,
+		Type:              c.Type,
+	}
+	if len(c.Foundation) >= 4 {
+		s.Foundation = int(binary.BigEndian.Uint32(c.Foundation))
+	}
+	if len(c.Related.IP) > 0 || c.Related.Host != "" {
+		s.RelatedAddress = sdpAddress(c.Related)
+		s.RelatedPort = c.Related.Port
+	}
+	return s
+}
+
+// CandidateFromSDP returns candidate from SDP representation. Candidates
+// with FQDN connection address have Addr.Host set and blank Addr.IP.
+func CandidateFromSDP(s *sdp.Candidate) Candidate {
+	c := Candidate{
+		Addr:        addrFromSDP(s.ConnectionAddress, s.Port, s.Transport),
+		Type:        s.Type,
+		Priority:    s.Priority,
+		ComponentID: s.ComponentID,
+		NetworkCost: s.NetworkCost,
+		Foundation:  make([]byte, 4),
+	}
+	binary.BigEndian.PutUint32(c.Foundation, uint32(s.Foundation))
+	if len(s.RelatedAddress.IP) > 0 || len(s.RelatedAddress.Host) > 0 {
+		c.Related = addrFromSDP(s.RelatedAddress, s.RelatedPort, s.Transport)
+	}
+	return c
+}
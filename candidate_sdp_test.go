@@ -0,0 +1,76 @@
+package ice
+
+import (
+	"net"
+	"testing"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/ice/sdp"
+)
+
+func TestCandidateToSDP(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   Candidate
+	}{
+		{
+			name: "Host",
+			in: Candidate{
+				Addr: Addr{
+					IP:    net.IPv4(10, 0, 0, 1),
+					Port:  5000,
+					Proto: candidate.UDP,
+				},
+				Type:        candidate.Host,
+				Priority:    2130706431,
+				Foundation:  []byte{1, 2, 3, 4},
+				ComponentID: 1,
+			},
+		},
+		{
+			name: "ServerReflexive",
+			in: Candidate{
+				Addr: Addr{
+					IP:    net.ParseIP("2001:db8::1"),
+					Port:  5001,
+					Proto: candidate.UDP,
+				},
+				Related: Addr{
+					IP:    net.ParseIP("fd00::1"),
+					Port:  5000,
+					Proto: candidate.UDP,
+				},
+				Type:        candidate.ServerReflexive,
+				Priority:    1694498815,
+				Foundation:  []byte{5, 6, 7, 8},
+				ComponentID: 2,
+				NetworkCost: 900,
+			},
+		},
+		{
+			name: "MulticastDNS",
+			in: Candidate{
+				Addr: Addr{
+					Host:  "1e5a7f0a-6b52-4e43-9c4f-4b3b0c1d8a9e.local",
+					Port:  5000,
+					Proto: candidate.UDP,
+				},
+				Type:        candidate.Host,
+				Priority:    2130706431,
+				Foundation:  []byte{1, 2, 3, 4},
+				ComponentID: 1,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var s sdp.Candidate
+			if err := sdp.ParseAttribute([]byte(CandidateToSDP(tc.in).String()), &s); err != nil {
+				t.Fatal(err)
+			}
+			out := CandidateFromSDP(&s)
+			if !out.Equal(&tc.in) || out.NetworkCost != tc.in.NetworkCost {
+				t.Errorf("%+v (got) != %+v (expected)", out, tc.in)
+			}
+		})
+	}
+}
@@ -154,6 +154,14 @@ func TestAddr_String(t *testing.T) {
 				Port: 10,
 			},
 		},
+		{
+			String: "fe80::1%eth0:10/UDP",
+			Addr: Addr{
+				IP:   net.ParseIP("fe80::1"),
+				Zone: "eth0",
+				Port: 10,
+			},
+		},
 	} {
 		if v := tc.Addr.String(); v != tc.String {
 			t.Errorf("string(%+v): %s (got) != %s (expected)",
@@ -191,6 +199,28 @@ func TestAddr_Equal(t *testing.T) {
 				IP: net.IPv4(1, 1, 1, 1),
 			},
 		},
+		{
+			Name: "zone",
+			A: Addr{
+				IP:   net.ParseIP("fe80::1"),
+				Zone: "eth0",
+			},
+			B: Addr{
+				IP:   net.ParseIP("fe80::1"),
+				Zone: "eth1",
+			},
+		},
+		{
+			Name: "blank zone",
+			A: Addr{
+				IP:   net.ParseIP("fe80::1"),
+				Zone: "eth0",
+			},
+			B: Addr{
+				IP: net.ParseIP("fe80::1"),
+			},
+			Equal: true,
+		},
 	} {
 		if v := tc.A.Equal(tc.B); v != tc.Equal {
 			t.Errorf("equal(%s, %s): %v (got) != %v (expected)",
@@ -0,0 +1,93 @@
+package ice
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// pairStateColor is DOT color of pair edge by state.
+var pairStateColor = map[PairState]string{
+	PairFrozen:     "gray",
+	PairWaiting:    "blue",
+	PairInProgress: "orange",
+	PairSucceeded:  "green",
+	PairFailed:     "red",
+}
+
+// WriteDOT writes checklist as Graphviz DOT graph, where local and remote
+// candidates are nodes and pairs are edges, coloured by pair state. The
+// nominated pairs are drawn bold.
+func (c Checklist) WriteDOT(w io.Writer) error {
+	b := new(bytes.Buffer)
+	b.WriteString("digraph checklist {\n")
+	writeDOTHeader(b)
+	c.writeDOT(b, "", "\t")
+	b.WriteString("}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// WriteDOT writes checklist set as Graphviz DOT graph with cluster per
+// checklist, see Checklist.WriteDOT.
+func (s ChecklistSet) WriteDOT(w io.Writer) error {
+	b := new(bytes.Buffer)
+	b.WriteString("digraph checklists {\n")
+	writeDOTHeader(b)
+	for i, c := range s {
+		fmt.Fprintf(b, "\tsubgraph cluster_%d {\n", i)
+		fmt.Fprintf(b, "\t\tlabel=%s;\n", strconv.Quote(fmt.Sprintf("checklist %d (%s)", i, c.State)))
+		c.writeDOT(b, strconv.Itoa(i)+"/", "\t\t")
+		b.WriteString("\t}\n")
+	}
+	b.WriteString("}\n")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func writeDOTHeader(b *bytes.Buffer) {
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	b.WriteString("\tedge [fontname=\"monospace\"];\n")
+}
+
+// dotCandidateLabel returns label of candidate node.
+func dotCandidateLabel(c *Candidate) string {
+	return fmt.Sprintf("%s\n%s\ncomponent %d, priority %d",
+		c.Type, c.Addr, c.ComponentID, c.Priority,
+	)
+}
+
+// writeDOT writes nodes and edges of checklist, prefixing node IDs.
+func (c Checklist) writeDOT(b *bytes.Buffer, prefix, indent string) {
+	nominated := make(map[pairKey]bool)
+	for i := range c.Valid {
+		if c.Valid[i].Nominated {
+			nominated[getPairKey(&c.Valid[i])] = true
+		}
+	}
+	var (
+		nodes = make(map[string]bool)
+		ids   = func(side string, cand *Candidate) string {
+			return strconv.Quote(prefix + side + cand.Addr.String())
+		}
+		node = func(side string, cand *Candidate) string {
+			id := ids(side, cand)
+			if !nodes[id] {
+				nodes[id] = true
+				fmt.Fprintf(b, "%s%s [label=%s];\n", indent, id, strconv.Quote(dotCandidateLabel(cand)))
+			}
+			return id
+		}
+	)
+	for i := range c.Pairs {
+		p := &c.Pairs[i]
+		local, remote := node("L", &p.Local), node("R", &p.Remote)
+		attrs := fmt.Sprintf("color=%s, label=%s", pairStateColor[p.State], strconv.Quote(p.State.String()))
+		if p.Nominated || nominated[getPairKey(p)] {
+			attrs += ", style=bold, penwidth=3"
+		}
+		fmt.Fprintf(b, "%s%s -> %s [%s];\n", indent, local, remote, attrs)
+	}
+}
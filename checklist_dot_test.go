@@ -0,0 +1,57 @@
+package ice
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestChecklist_WriteDOT(t *testing.T) {
+	var c Checklist
+	loadGoldenJSON(t, &c, "checklist.json")
+	c.Pairs[0].State = PairSucceeded
+	c.Valid = Pairs{c.Pairs[0]}
+	c.Valid[0].Nominated = true
+	buf := new(bytes.Buffer)
+	if err := c.WriteDOT(buf); err != nil {
+		t.Fatal(err)
+	}
+	if *writeGolden {
+		f, closeF := createGolden(t, "checklist.dot")
+		defer closeF()
+		if _, err := f.Write(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, closeF := readGolden(t, "checklist.dot")
+	defer closeF()
+	expected, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("unexpected DOT output:\n%s", buf)
+	}
+	if strings.Count(buf.String(), "penwidth=3") != 1 {
+		t.Error("nominated pair should be highlighted once")
+	}
+}
+
+func TestChecklistSet_WriteDOT(t *testing.T) {
+	var c Checklist
+	loadGoldenJSON(t, &c, "checklist.json")
+	buf := new(bytes.Buffer)
+	if err := (ChecklistSet{c, c}).WriteDOT(buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{"subgraph cluster_0", "subgraph cluster_1", `"0/L`, `"1/R`} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%q not found", s)
+		}
+	}
+	if strings.Count(out, "->") != 2*len(c.Pairs) {
+		t.Error("unexpected edge count")
+	}
+}
@@ -0,0 +1,74 @@
+package ice
+
+import (
+	"html/template"
+	"io"
+)
+
+// htmlPair is pair row of checklist HTML page.
+type htmlPair struct {
+	Pair
+	Color     string
+	Nominated bool
+}
+
+// htmlChecklist is checklist section of HTML page.
+type htmlChecklist struct {
+	ID    int
+	State ChecklistState
+	Pairs []htmlPair
+}
+
+// WriteHTML writes checklist as HTML page with table of pairs, coloured by
+// pair state like in WriteDOT. The nominated pairs are bold.
+func (c Checklist) WriteHTML(w io.Writer) error {
+	return ChecklistSet{c}.WriteHTML(w)
+}
+
+// WriteHTML writes checklist set as HTML page with table of pairs per
+// checklist, see Checklist.WriteHTML.
+func (s ChecklistSet) WriteHTML(w io.Writer) error {
+	checklists := make([]htmlChecklist, 0, len(s))
+	for i, c := range s {
+		nominated := make(map[pairKey]bool)
+		for j := range c.Valid {
+			if c.Valid[j].Nominated {
+				nominated[getPairKey(&c.Valid[j])] = true
+			}
+		}
+		h := htmlChecklist{ID: i, State: c.State}
+		for j := range c.Pairs {
+			p := c.Pairs[j]
+			h.Pairs = append(h.Pairs, htmlPair{
+				Pair:      p,
+				Color:     pairStateColor[p.State],
+				Nominated: p.Nominated || nominated[getPairKey(&p)],
+			})
+		}
+		checklists = append(checklists, h)
+	}
+	return checklistTemplate.Execute(w, checklists)
+}
+
+var checklistTemplate = template.Must(template.New("checklist").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ICE checklists</title>
+<style>
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; font-family: monospace; }
+tr.nominated { font-weight: bold; }
+</style>
+</head>
+<body>
+{{range .}}
+<h1>Checklist {{.ID}} ({{.State}})</h1>
+<table>
+<tr><th>Local</th><th>Remote</th><th>Component</th><th>State</th><th>Priority</th><th>Foundation</th></tr>
+{{range .Pairs}}<tr{{if .Nominated}} class="nominated"{{end}} style="color: {{.Color}}"><td>{{.Local.Type}} {{.Local.Addr}}</td><td>{{.Remote.Type}} {{.Remote.Addr}}</td><td>{{.ComponentID}}</td><td>{{.State}}</td><td>{{.Priority}}</td><td>{{printf "%x" .Foundation}}</td></tr>
+{{end}}</table>
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,33 @@
+package ice
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestChecklistSet_WriteHTML(t *testing.T) {
+	var c Checklist
+	loadGoldenJSON(t, &c, "checklist.json")
+	c.Pairs[0].State = PairSucceeded
+	c.Valid = Pairs{c.Pairs[0]}
+	c.Valid[0].Nominated = true
+	buf := new(bytes.Buffer)
+	if err := (ChecklistSet{c, c}).WriteHTML(buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, s := range []string{
+		"<h1>Checklist 0", "<h1>Checklist 1", "color: green", c.Pairs[0].Local.Addr.String(),
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("%q not found", s)
+		}
+	}
+	if strings.Count(out, `class="nominated"`) != 2 {
+		t.Error("nominated pair should be highlighted in each checklist")
+	}
+	if strings.Count(out, "<tr") != 2*(len(c.Pairs)+1) {
+		t.Error("unexpected row count")
+	}
+}
@@ -0,0 +1,81 @@
+// Command reads checklist or checklist set JSON and writes it as Graphviz
+// DOT graph, e.g. to render SVG:
+//
+//	ice-dot checklist.json | dot -Tsvg > checklist.svg
+//
+// or as HTML page with table of pairs:
+//
+//	ice-dot -html -o checklist.html checklist.json
+//
+// Input is read from standard input if no file is provided.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"gortc.io/ice"
+)
+
+var (
+	output = flag.String("o", "", "output file (standard output if empty)")
+	html   = flag.Bool("html", false, "write HTML page instead of DOT graph")
+)
+
+func main() {
+	flag.Parse()
+	var (
+		data []byte
+		err  error
+	)
+	if name := flag.Arg(0); name != "" {
+		data, err = ioutil.ReadFile(name)
+	} else {
+		data, err = ioutil.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		log.Fatal("failed to read: ", err)
+	}
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, createErr := os.Create(*output)
+		if createErr != nil {
+			log.Fatal("failed to create: ", createErr)
+		}
+		defer func() {
+			if closeErr := f.Close(); closeErr != nil {
+				log.Fatal("failed to close: ", closeErr)
+			}
+		}()
+		w = f
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		var set ice.ChecklistSet
+		if err = json.Unmarshal(data, &set); err != nil {
+			log.Fatal("failed to decode checklist set: ", err)
+		}
+		if *html {
+			err = set.WriteHTML(w)
+		} else {
+			err = set.WriteDOT(w)
+		}
+	} else {
+		var c ice.Checklist
+		if err = json.Unmarshal(data, &c); err != nil {
+			log.Fatal("failed to decode checklist: ", err)
+		}
+		if *html {
+			err = c.WriteHTML(w)
+		} else {
+			err = c.WriteDOT(w)
+		}
+	}
+	if err != nil {
+		log.Fatal("failed to write: ", err)
+	}
+}
@@ -21,6 +21,9 @@ func main() {
 			continue
 		}
 		fmt.Printf("%s\n", a)
+		fmt.Printf("    %s #%d mtu %d %s (cost %d)\n",
+			a.Interface, a.Index, a.MTU, a.Network, a.Network.Cost(),
+		)
 		laddr, err := net.ResolveUDPAddr("udp",
 			a.ZeroPortAddr(),
 		)
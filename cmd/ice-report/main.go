@@ -0,0 +1,116 @@
+// Command pretty-prints agent session report or diffs two reports:
+//
+//	ice-report report.json
+//	ice-report old.json new.json
+//
+// Diff lists JSON paths with values that differ, prefixed with "-" for the
+// first report and "+" for the second one, and exits with status 1 if
+// reports differ.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+
+	"gortc.io/ice"
+)
+
+func readReport(name string) ice.Report {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		log.Fatal("failed to read: ", err)
+	}
+	var r ice.Report
+	if err = json.Unmarshal(data, &r); err != nil {
+		log.Fatalf("failed to decode %s: %v", name, err)
+	}
+	return r
+}
+
+// flatten returns JSON values of report leaves by path.
+func flatten(r ice.Report) map[string]string {
+	data, err := json.Marshal(r)
+	if err != nil {
+		log.Fatal("failed to encode: ", err)
+	}
+	var v interface{}
+	if err = json.Unmarshal(data, &v); err != nil {
+		log.Fatal("failed to decode: ", err)
+	}
+	values := make(map[string]string)
+	var walk func(path string, v interface{})
+	walk = func(path string, v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, e := range v {
+				walk(path+"."+k, e)
+			}
+		case []interface{}:
+			for i, e := range v {
+				walk(path+"["+strconv.Itoa(i)+"]", e)
+			}
+		default:
+			leaf, _ := json.Marshal(v)
+			values[path] = string(leaf)
+		}
+	}
+	walk("", v)
+	return values
+}
+
+func diff(a, b ice.Report) bool {
+	va, vb := flatten(a), flatten(b)
+	paths := make(map[string]bool)
+	for p := range va {
+		paths[p] = true
+	}
+	for p := range vb {
+		paths[p] = true
+	}
+	sorted := make([]string, 0, len(paths))
+	for p := range paths {
+		sorted = append(sorted, p)
+	}
+	sort.Strings(sorted)
+	differ := false
+	for _, p := range sorted {
+		x, inA := va[p]
+		y, inB := vb[p]
+		if inA && inB && x == y {
+			continue
+		}
+		differ = true
+		if inA {
+			fmt.Printf("- %s = %s\n", p, x)
+		}
+		if inB {
+			fmt.Printf("+ %s = %s\n", p, y)
+		}
+	}
+	return differ
+}
+
+func main() {
+	flag.Parse()
+	switch flag.NArg() {
+	case 1:
+		data, err := json.MarshalIndent(readReport(flag.Arg(0)), "", "  ")
+		if err != nil {
+			log.Fatal("failed to encode: ", err)
+		}
+		fmt.Println(string(data))
+	case 2:
+		if diff(readReport(flag.Arg(0)), readReport(flag.Arg(1))) {
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, "usage: ice-report report.json [other.json]")
+		os.Exit(2)
+	}
+}
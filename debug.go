@@ -0,0 +1,268 @@
+package ice
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DebugHandler is http.Handler that renders internals of registered agents,
+// like checklists, candidates and pending transactions, for troubleshooting
+// of failed connections. Passwords are rendered as fingerprints.
+//
+// Response is JSON if "format" query parameter is "json" or request accepts
+// "application/json", and HTML otherwise. The "agent" query parameter limits
+// response to agent with provided name.
+type DebugHandler struct {
+	mux    sync.Mutex
+	agents map[string]*Agent
+}
+
+// NewDebugHandler returns new DebugHandler without agents.
+func NewDebugHandler() *DebugHandler {
+	return &DebugHandler{agents: make(map[string]*Agent)}
+}
+
+// Register adds agent with provided name, replacing existing one.
+func (h *DebugHandler) Register(name string, a *Agent) {
+	h.mux.Lock()
+	h.agents[name] = a
+	h.mux.Unlock()
+}
+
+// Unregister removes agent with provided name.
+func (h *DebugHandler) Unregister(name string) {
+	h.mux.Lock()
+	delete(h.agents, name)
+	h.mux.Unlock()
+}
+
+type debugTransaction struct {
+	ID          string        `json:"id"`
+	Checklist   int           `json:"checklist"`
+	Local       string        `json:"local"`
+	Remote      string        `json:"remote"`
+	Priority    int           `json:"priority"`
+	Nominate    bool          `json:"nominate"`
+	Attempt     int           `json:"attempt"`
+	MaxAttempts int           `json:"max_attempts"`
+	Start       time.Time     `json:"start"`
+	Deadline    time.Time     `json:"deadline"`
+	RTO         time.Duration `json:"rto"`
+}
+
+type debugStream struct {
+	ID                  int         `json:"id"`
+	Mid                 string      `json:"mid,omitempty"`
+	Removed             bool        `json:"removed"`
+	Gathered            bool        `json:"gathered"`
+	Remote              bool        `json:"remote"`
+	RemoteUsername      string      `json:"remote_username"`
+	RemotePassword      string      `json:"remote_password_fingerprint"`
+	LocalCandidates     []Candidate `json:"local_candidates"`
+	RemoteCandidates    []Candidate `json:"remote_candidates"`
+	Checklist           *Checklist  `json:"checklist,omitempty"`
+	ChecklistInProgress bool        `json:"checklist_in_progress"`
+}
+
+type debugAgent struct {
+	Name          string             `json:"name"`
+	State         State              `json:"state"`
+	Role          Role               `json:"role"`
+	Tiebreaker    uint64             `json:"tiebreaker"`
+	LocalUsername string             `json:"local_username"`
+	LocalPassword string             `json:"local_password_fingerprint"`
+	Streams       []debugStream      `json:"streams"`
+	Transactions  []debugTransaction `json:"transactions"`
+}
+
+// fingerprint returns short SHA-256 fingerprint of secret, so it can be
+// compared with the one of peer without exposing it.
+func fingerprint(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:8])
+}
+
+// debug returns snapshot of agent internals.
+func (a *Agent) debug(name string) debugAgent {
+	a.mux.Lock()
+	d := debugAgent{
+		Name:          name,
+		State:         a.state,
+		Role:          a.role,
+		Tiebreaker:    a.tiebreaker,
+		LocalUsername: a.localUsername,
+		LocalPassword: fingerprint(a.localPassword),
+	}
+	for id, s := range a.streams {
+		remoteUsername, remotePassword := a.remoteCredentials(id)
+		ds := debugStream{
+			ID:                  id,
+			Mid:                 s.mid,
+			Removed:             s.removed,
+			Gathered:            s.gathered,
+			Remote:              s.remote,
+			RemoteUsername:      remoteUsername,
+			RemotePassword:      fingerprint(remotePassword),
+			ChecklistInProgress: id == a.checklist,
+		}
+		if id < len(a.localCandidates) {
+			for _, c := range a.localCandidates[id] {
+				ds.LocalCandidates = append(ds.LocalCandidates, c.candidate)
+			}
+		}
+		if id < len(a.remoteCandidates) {
+			ds.RemoteCandidates = append(ds.RemoteCandidates, a.remoteCandidates[id]...)
+		}
+		if id < len(a.set) {
+			// Pairs are modified in place, so copying them under lock.
+			c := a.set[id]
+			ds.Checklist = &Checklist{
+				Pairs:     append(Pairs(nil), c.Pairs...),
+				Valid:     append(Pairs(nil), c.Valid...),
+				Triggered: append(Pairs(nil), c.Triggered...),
+				State:     c.State,
+			}
+		}
+		d.Streams = append(d.Streams, ds)
+	}
+	a.mux.Unlock()
+	a.tMux.Lock()
+	for _, t := range a.t {
+		d.Transactions = append(d.Transactions, debugTransaction{
+			ID:          hex.EncodeToString(t.id[:]),
+			Checklist:   t.checklist,
+			Local:       (&net.UDPAddr{IP: t.pair.LocalIP[:], Port: t.pair.LocalPort}).String(),
+			Remote:      (&net.UDPAddr{IP: t.pair.RemoteIP[:], Port: t.pair.RemotePort}).String(),
+			Priority:    t.priority,
+			Nominate:    t.nominate,
+			Attempt:     t.attempt,
+			MaxAttempts: t.maxAttempts,
+			Start:       t.start,
+			Deadline:    t.deadline,
+			RTO:         t.rto,
+		})
+	}
+	a.tMux.Unlock()
+	sort.Slice(d.Transactions, func(i, j int) bool {
+		return d.Transactions[i].Start.Before(d.Transactions[j].Start)
+	})
+	return d
+}
+
+// wantsJSON reports whether JSON response is requested.
+func wantsJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func (h *DebugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("agent")
+	h.mux.Lock()
+	names := make([]string, 0, len(h.agents))
+	agents := make(map[string]*Agent, len(h.agents))
+	for n, a := range h.agents {
+		if name != "" && n != name {
+			continue
+		}
+		names = append(names, n)
+		agents[n] = a
+	}
+	h.mux.Unlock()
+	if name != "" && len(names) == 0 {
+		http.Error(w, "agent not found", http.StatusNotFound)
+		return
+	}
+	sort.Strings(names)
+	debug := make([]debugAgent, 0, len(names))
+	for _, n := range names {
+		debug = append(debug, agents[n].debug(n))
+	}
+	if wantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		e := json.NewEncoder(w)
+		e.SetIndent("", "  ")
+		_ = e.Encode(debug)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = debugTemplate.Execute(w, debug)
+}
+
+var debugTemplate = template.Must(template.New("debug").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>ICE agents</title>
+<style>
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 2px 6px; text-align: left; font-family: monospace; }
+</style>
+</head>
+<body>
+{{range .}}
+<h1>{{.Name}}</h1>
+<table>
+<tr><th>State</th><td>{{.State}}</td></tr>
+<tr><th>Role</th><td>{{.Role}}</td></tr>
+<tr><th>Tiebreaker</th><td>{{.Tiebreaker}}</td></tr>
+<tr><th>Username</th><td>{{.LocalUsername}}</td></tr>
+<tr><th>Password</th><td>{{.LocalPassword}}</td></tr>
+</table>
+{{range .Streams}}
+<h2>Stream {{.ID}}{{if .Mid}} ({{.Mid}}){{end}}{{if .Removed}} removed{{end}}{{if .ChecklistInProgress}} in progress{{end}}</h2>
+<table>
+<tr><th>Remote username</th><td>{{.RemoteUsername}}</td></tr>
+<tr><th>Remote password</th><td>{{.RemotePassword}}</td></tr>
+</table>
+<h3>Local candidates</h3>
+<table>
+<tr><th>Type</th><th>Address</th><th>Base</th><th>Component</th><th>Priority</th></tr>
+{{range .LocalCandidates}}<tr><td>{{.Type}}</td><td>{{.Addr}}</td><td>{{.Base}}</td><td>{{.ComponentID}}</td><td>{{.Priority}}</td></tr>
+{{end}}</table>
+<h3>Remote candidates</h3>
+<table>
+<tr><th>Type</th><th>Address</th><th>Component</th><th>Priority</th></tr>
+{{range .RemoteCandidates}}<tr><td>{{.Type}}</td><td>{{.Addr}}</td><td>{{.ComponentID}}</td><td>{{.Priority}}</td></tr>
+{{end}}</table>
+{{with .Checklist}}
+<h3>Checklist ({{.State}})</h3>
+<table>
+<tr><th>Local</th><th>Remote</th><th>Component</th><th>State</th><th>Nominated</th><th>Priority</th></tr>
+{{range .Pairs}}<tr><td>{{.Local.Addr}}</td><td>{{.Remote.Addr}}</td><td>{{.ComponentID}}</td><td>{{.State}}</td><td>{{.Nominated}}</td><td>{{.Priority}}</td></tr>
+{{end}}</table>
+<h3>Valid</h3>
+<table>
+<tr><th>Local</th><th>Remote</th><th>Component</th><th>Nominated</th></tr>
+{{range .Valid}}<tr><td>{{.Local.Addr}}</td><td>{{.Remote.Addr}}</td><td>{{.ComponentID}}</td><td>{{.Nominated}}</td></tr>
+{{end}}</table>
+<h3>Triggered</h3>
+<table>
+<tr><th>Local</th><th>Remote</th><th>Component</th><th>State</th></tr>
+{{range .Triggered}}<tr><td>{{.Local.Addr}}</td><td>{{.Remote.Addr}}</td><td>{{.ComponentID}}</td><td>{{.State}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}
+<h2>Transactions</h2>
+<table>
+<tr><th>ID</th><th>Local</th><th>Remote</th><th>Attempt</th><th>RTO</th><th>Deadline</th><th>Nominate</th></tr>
+{{range .Transactions}}<tr><td>{{.ID}}</td><td>{{.Local}}</td><td>{{.Remote}}</td><td>{{.Attempt}}/{{.MaxAttempts}}</td><td>{{.RTO}}</td><td>{{.Deadline}}</td><td>{{.Nominate}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>No agents registered.</p>
+{{end}}
+</body>
+</html>
+`))
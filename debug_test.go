@@ -0,0 +1,142 @@
+package ice
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gortc.io/ice/candidate"
+)
+
+func TestDebugHandler(t *testing.T) {
+	local := Candidate{
+		Addr:        Addr{IP: net.IPv4(10, 0, 0, 1), Port: 1000, Proto: candidate.UDP},
+		Type:        candidate.Host,
+		ComponentID: 1,
+	}
+	local.Base = local.Addr
+	remote := Candidate{
+		Addr:        Addr{IP: net.IPv4(10, 0, 0, 2), Port: 2000, Proto: candidate.UDP},
+		Type:        candidate.Host,
+		ComponentID: 1,
+	}
+	a, err := NewAgent(withGatherer(&mockGatherer{
+		udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+			return []*localUDPCandidate{{candidate: local, conn: mockPacketConn{}}}, nil
+		},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	a.SetLocalCredentials("ufrag", "secret-password")
+	a.SetRemoteCredentials("remote", "remote-password")
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.AddRemoteCandidates([]Candidate{remote}); err != nil {
+		t.Fatal(err)
+	}
+	if err = a.PrepareChecklistSet(); err != nil {
+		t.Fatal(err)
+	}
+	a.tMux.Lock()
+	a.t[transactionID{1}] = &agentTransaction{
+		id:          transactionID{1},
+		pair:        getPairKey(&a.set[0].Pairs[0]),
+		attempt:     1,
+		maxAttempts: 3,
+		start:       time.Now(),
+		rto:         minRTO,
+	}
+	a.tMux.Unlock()
+
+	h := NewDebugHandler()
+	h.Register("test", a)
+	get := func(t *testing.T, target string, accept string) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+	t.Run("JSON", func(t *testing.T) {
+		for _, tc := range []struct {
+			name, target, accept string
+		}{
+			{name: "Query", target: "/?format=json"},
+			{name: "Accept", target: "/", accept: "application/json"},
+		} {
+			t.Run(tc.name, func(t *testing.T) {
+				w := get(t, tc.target, tc.accept)
+				if strings.Contains(w.Body.String(), "secret-password") {
+					t.Error("password should not be exposed")
+				}
+				var agents []debugAgent
+				if err := json.Unmarshal(w.Body.Bytes(), &agents); err != nil {
+					t.Fatal(err)
+				}
+				if len(agents) != 1 || agents[0].Name != "test" || len(agents[0].Streams) != 1 {
+					t.Fatalf("unexpected response: %s", w.Body)
+				}
+				d := agents[0]
+				if d.LocalUsername != "ufrag" || d.LocalPassword != fingerprint("secret-password") {
+					t.Error("unexpected local credentials")
+				}
+				s := d.Streams[0]
+				if len(s.LocalCandidates) != 1 || len(s.RemoteCandidates) != 1 {
+					t.Error("unexpected candidates")
+				}
+				if s.Checklist == nil || len(s.Checklist.Pairs) != 1 {
+					t.Error("unexpected checklist")
+				}
+				if len(d.Transactions) != 1 || d.Transactions[0].Remote != "10.0.0.2:2000" {
+					t.Errorf("unexpected transactions: %+v", d.Transactions)
+				}
+			})
+		}
+	})
+	t.Run("HTML", func(t *testing.T) {
+		w := get(t, "/", "")
+		if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("unexpected content type %q", ct)
+		}
+		body := w.Body.String()
+		for _, s := range []string{"<h1>test</h1>", "10.0.0.1:1000/UDP", "10.0.0.2:2000", "Waiting"} {
+			if !strings.Contains(body, s) {
+				t.Errorf("%q not found", s)
+			}
+		}
+	})
+	t.Run("Snapshot", func(t *testing.T) {
+		d := a.debug("test")
+		a.mux.Lock()
+		state := a.set[0].Pairs[0].State
+		a.set[0].Pairs[0].State = PairFailed
+		a.mux.Unlock()
+		if got := d.Streams[0].Checklist.Pairs[0].State; got != state {
+			t.Errorf("snapshot is modified: %s", got)
+		}
+		a.mux.Lock()
+		a.set[0].Pairs[0].State = state
+		a.mux.Unlock()
+	})
+	t.Run("NotFound", func(t *testing.T) {
+		if w := get(t, "/?agent=other", ""); w.Code != http.StatusNotFound {
+			t.Errorf("unexpected code %d", w.Code)
+		}
+	})
+	t.Run("Unregister", func(t *testing.T) {
+		h.Unregister("test")
+		if w := get(t, "/", ""); !strings.Contains(w.Body.String(), "No agents") {
+			t.Error("agent should be unregistered")
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package ice
+
+import "net"
+
+// PacketType is type of packet that is received on candidate socket, as
+// demultiplexed by first byte.
+//
+// See RFC 7983 Section 7.
+type PacketType byte
+
+// Possible packet types.
+const (
+	PacketUnknown PacketType = iota
+	PacketSTUN
+	PacketZRTP
+	PacketDTLS
+	PacketTURNChannel // TURN ChannelData
+	PacketRTP
+	PacketRTCP
+)
+
+var packetTypeToStr = map[PacketType]string{
+	PacketUnknown:     "unknown",
+	PacketSTUN:        "STUN",
+	PacketZRTP:        "ZRTP",
+	PacketDTLS:        "DTLS",
+	PacketTURNChannel: "TURN ChannelData",
+	PacketRTP:         "RTP",
+	PacketRTCP:        "RTCP",
+}
+
+func (t PacketType) String() string {
+	if s, ok := packetTypeToStr[t]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// ClassifyPacket returns type of packet by the RFC 7983 rules, where RTP
+// and RTCP are distinguished by payload type as in RFC 5761 Section 4.
+//
+//	            +----------------+
+//	            |        [0..3] -+--> forward to STUN
+//	            |                |
+//	            |      [16..19] -+--> forward to ZRTP
+//	            |                |
+//	packet -->  |      [20..63] -+--> forward to DTLS
+//	            |                |
+//	            |      [64..79] -+--> forward to TURN Channel
+//	            |                |
+//	            |    [128..191] -+--> forward to RTP/RTCP
+//	            +----------------+
+func ClassifyPacket(b []byte) PacketType {
+	if len(b) == 0 {
+		return PacketUnknown
+	}
+	switch v := b[0]; {
+	case v <= 3:
+		return PacketSTUN
+	case v >= 16 && v <= 19:
+		return PacketZRTP
+	case v >= 20 && v <= 63:
+		return PacketDTLS
+	case v >= 64 && v <= 79:
+		return PacketTURNChannel
+	case v >= 128 && v <= 191:
+		if len(b) > 1 && b[1] >= 192 && b[1] <= 223 {
+			// Payload types 64-95 with marker bit set are RTCP.
+			return PacketRTCP
+		}
+		return PacketRTP
+	default:
+		return PacketUnknown
+	}
+}
+
+// PacketHandler handles packet that was received on candidate socket from
+// remote address. The conn is candidate socket that can be used to write
+// to remote address. Handler is called sequentially for each packet and
+// owns p.
+type PacketHandler func(p []byte, from net.Addr, conn net.PacketConn)
+
+// handlePacket passes non-STUN packet to registered handler, reporting
+// whether it is found.
+func (a *Agent) handlePacket(t PacketType, p []byte, from net.Addr, conn net.PacketConn) bool {
+	h, ok := a.packetHandlers[t]
+	if !ok {
+		return false
+	}
+	h(p, from, conn)
+	return true
+}
@@ -0,0 +1,106 @@
+package ice
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/stun"
+)
+
+func TestClassifyPacket(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		in   []byte
+		out  PacketType
+	}{
+		{name: "Blank", out: PacketUnknown},
+		{name: "STUN", in: stun.MustBuild(stun.TransactionID, stun.BindingRequest).Raw, out: PacketSTUN},
+		{name: "ZRTP", in: []byte{16, 0}, out: PacketZRTP},
+		{name: "DTLSHandshake", in: []byte{22, 254, 253}, out: PacketDTLS},
+		{name: "DTLSMax", in: []byte{63}, out: PacketDTLS},
+		{name: "ChannelData", in: []byte{0x40, 0x00, 0x00, 0x04}, out: PacketTURNChannel},
+		{name: "RTP", in: []byte{128, 111}, out: PacketRTP},
+		{name: "RTPMarker", in: []byte{128, 128 | 96}, out: PacketRTP},
+		{name: "RTCPSenderReport", in: []byte{128, 200}, out: PacketRTCP},
+		{name: "RTCPFeedback", in: []byte{129, 205}, out: PacketRTCP},
+		{name: "Reserved", in: []byte{8}, out: PacketUnknown},
+		{name: "OutOfRange", in: []byte{200}, out: PacketUnknown},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if out := ClassifyPacket(tc.in); out != tc.out {
+				t.Errorf("%s (got) != %s (expected)", out, tc.out)
+			}
+		})
+	}
+}
+
+func TestAgent_PacketHandler(t *testing.T) {
+	lAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+	rAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 2000}
+	connL, connR := packetPipe(lAddr, rAddr)
+	defer mustClose(t, connR)
+	type packet struct {
+		t    PacketType
+		data []byte
+	}
+	received := make(chan packet, 10)
+	handler := func(t PacketType) PacketHandler {
+		return func(p []byte, from net.Addr, conn net.PacketConn) {
+			received <- packet{t: t, data: p}
+		}
+	}
+	a, err := NewAgent(
+		withGatherer(&mockGatherer{
+			udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+				addr := Addr{IP: lAddr.IP, Port: lAddr.Port, Proto: candidate.UDP}
+				return []*localUDPCandidate{{
+					candidate: Candidate{Addr: addr, Base: addr, Type: candidate.Host, ComponentID: 1},
+					conn:      connL,
+				}}, nil
+			},
+		}),
+		WithPacketHandler(PacketDTLS, handler(PacketDTLS)),
+		WithPacketHandler(PacketRTP, handler(PacketRTP)),
+		WithPacketHandler(PacketRTCP, handler(PacketRTCP)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	if err = a.GatherCandidates(); err != nil {
+		t.Fatal(err)
+	}
+	// Video RTP packet that does not fit in small buffer.
+	rtp := make([]byte, 1400)
+	copy(rtp, []byte{128, 111, 0, 1})
+	sent := []packet{
+		{t: PacketDTLS, data: []byte{22, 254, 253}},
+		{t: PacketZRTP, data: []byte{16, 0}}, // no handler
+		{t: PacketRTP, data: rtp},
+		{t: PacketRTCP, data: []byte{128, 200, 0, 6}},
+	}
+	for _, p := range sent {
+		if _, err = connR.WriteTo(p.data, lAddr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, expected := range []packet{sent[0], sent[2], sent[3]} {
+		select {
+		case p := <-received:
+			if p.t != expected.t {
+				t.Errorf("%s (got) != %s (expected)", p.t, expected.t)
+			}
+			if !bytes.Equal(p.data, expected.data) {
+				t.Errorf("unexpected %s packet of %d bytes", p.t, len(p.data))
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s packet is not handled", expected.t)
+		}
+	}
+	if _, err = NewAgent(WithPacketHandler(PacketSTUN, handler(PacketSTUN))); err != errSTUNHandler {
+		t.Errorf("unexpected error %v", err)
+	}
+}
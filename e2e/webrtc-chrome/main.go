@@ -63,15 +63,11 @@ type sdpDescription struct {
 	SDP  string `json:"sdp"`
 }
 
-type iceDescription struct {
-	Candidate string `json:"candidate"`
-}
-
 type sdpSignal struct {
-	SDP     sdpDescription `json:"sdp"`
-	ICE     iceDescription `json:"ice"`
-	Signal  string         `json:"signal"`
-	Success bool           `json:"success,omitempty"`
+	SDP     sdpDescription       `json:"sdp"`
+	ICE     iceSDP.CandidateInit `json:"ice"`
+	Signal  string               `json:"signal"`
+	Success bool                 `json:"success,omitempty"`
 }
 
 type sdpAnswer struct {
@@ -207,7 +203,7 @@ func startNative(ctx context.Context) error {
 					messages <- m
 				} else if sig.ICE.Candidate != "" {
 					var c iceSDP.Candidate
-					if err := iceSDP.ParseAttribute([]byte(sig.ICE.Candidate), &c); err != nil {
+					if err := sig.ICE.Parse(&c); err != nil {
 						log.Fatalln("failed to parse ICE candidate:", err)
 					}
 					log.Println("parsed ICE candidate:", c.ConnectionAddress, c.ComponentID)
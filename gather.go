@@ -1,7 +1,9 @@
 package ice
 
 import (
+	"fmt"
 	"net"
+	"sort"
 
 	ct "gortc.io/ice/candidate"
 	"gortc.io/ice/gather"
@@ -13,7 +15,67 @@ func Gather() ([]gather.Addr, error) {
 }
 
 type systemCandidateGatherer struct {
-	addr gather.Gatherer
+	addr   gather.Gatherer
+	listen listenFunc // net.ListenPacket if nil
+}
+
+type listenFunc func(network, address string) (net.PacketConn, error)
+
+// PortsExhaustedError is returned by gathering when no port from configured
+// range or list can be bound for host candidate.
+type PortsExhaustedError struct {
+	IP    net.IP
+	Min   int   // range minimum, if set
+	Max   int   // range maximum, if set
+	Ports []int // explicit ports, if set
+	Err   error // last bind error
+}
+
+func (e PortsExhaustedError) Error() string {
+	if len(e.Ports) > 0 {
+		return fmt.Sprintf("no port of %v is available on %s: %v", e.Ports, e.IP, e.Err)
+	}
+	return fmt.Sprintf("no port in range %d-%d is available on %s: %v", e.Min, e.Max, e.IP, e.Err)
+}
+
+// ports returns list of ports to try binding to, where nil means any port.
+func (opt gathererOptions) ports() []int {
+	if len(opt.Ports) > 0 {
+		return opt.Ports
+	}
+	if opt.PortMax == 0 {
+		return nil
+	}
+	ports := make([]int, 0, opt.PortMax-opt.PortMin+1)
+	for port := opt.PortMin; port <= opt.PortMax; port++ {
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+// listenUDP binds to host address and first port from configured ones that
+// is available, trying every port on conflict.
+func listenUDP(listen listenFunc, h HostAddr, opt gathererOptions) (net.PacketConn, error) {
+	ports := opt.ports()
+	if len(ports) == 0 {
+		addr := net.UDPAddr{IP: h.IP, Zone: h.Zone}
+		return listen("udp", addr.String())
+	}
+	var err error
+	for _, port := range ports {
+		addr := net.UDPAddr{IP: h.IP, Port: port, Zone: h.Zone}
+		var l net.PacketConn
+		if l, err = listen("udp", addr.String()); err == nil {
+			return l, nil
+		}
+	}
+	return nil, PortsExhaustedError{
+		IP:    h.IP,
+		Min:   opt.PortMin,
+		Max:   opt.PortMax,
+		Ports: opt.Ports,
+		Err:   err,
+	}
 }
 
 func (g systemCandidateGatherer) gatherUDP(opt gathererOptions) ([]*localUDPCandidate, error) {
@@ -22,47 +84,94 @@ func (g systemCandidateGatherer) gatherUDP(opt gathererOptions) ([]*localUDPCand
 		// Failed to gather host addresses.
 		return nil, err
 	}
-	hostAddr, err := HostAddresses(addrs)
+	addrs, filtered := opt.Filter.Filter(addrs)
+	if opt.Filtered != nil {
+		for _, f := range filtered {
+			opt.Filtered(f)
+		}
+	}
+	if opt.Policy != nil {
+		for i := range addrs {
+			addrs[i].Precedence = opt.Policy.Precedence(addrs[i].IP)
+		}
+		sort.Sort(gather.Addrs(addrs))
+	}
+	hostAddr, err := hostAddresses(addrs, opt.LinkLocal)
 	if err != nil {
 		return nil, err
 	}
+	listen := g.listen
+	if listen == nil {
+		listen = net.ListenPacket
+	}
 	var candidates []*localUDPCandidate
 	for component := 1; component <= opt.Components; component++ {
 		for _, addr := range hostAddr {
 			if opt.IPv4Only && addr.IP.To4() == nil {
 				continue
 			}
-			zeroPort := net.UDPAddr{
-				IP:   addr.IP,
-				Port: 0,
-			}
-			l, err := net.ListenPacket("udp", zeroPort.String())
+			c, err := hostCandidate(listen, addr, component, opt)
 			if err != nil {
+				for _, c := range candidates {
+					_ = c.Close()
+				}
 				return nil, err
 			}
-			a := l.LocalAddr().(*net.UDPAddr)
-			c := Candidate{
-				Base: Addr{
-					IP:    addr.IP,
-					Port:  a.Port,
-					Proto: ct.UDP,
-				},
-				Type: ct.Host,
-				Addr: Addr{
-					IP:    addr.IP,
-					Port:  a.Port,
-					Proto: ct.UDP,
-				},
-				ComponentID:     component,
-				LocalPreference: addr.LocalPreference,
+			candidates = append(candidates, c)
+		}
+	}
+	return candidates, nil
+}
+
+// hostCandidate binds socket on addr, returning host candidate for it.
+func hostCandidate(listen listenFunc, addr HostAddr, component int, opt gathererOptions) (*localUDPCandidate, error) {
+	l, err := listenUDP(listen, addr, opt)
+	if err != nil {
+		return nil, err
+	}
+	a := l.LocalAddr().(*net.UDPAddr)
+	c := Candidate{
+		Base: Addr{
+			IP:    addr.IP,
+			Zone:  addr.Zone,
+			Port:  a.Port,
+			Proto: ct.UDP,
+		},
+		Type: ct.Host,
+		Addr: Addr{
+			IP:    addr.IP,
+			Zone:  addr.Zone,
+			Port:  a.Port,
+			Proto: ct.UDP,
+		},
+		ComponentID:     component,
+		LocalPreference: addr.LocalPreference,
+		NetworkCost:     addr.NetworkCost,
+	}
+	c.Foundation = Foundation(&c, Addr{})
+	c.Priority = Priority(TypePreference(c.Type), addr.LocalPreference, c.ComponentID)
+	return &localUDPCandidate{
+		candidate: c,
+		conn:      l,
+	}, nil
+}
+
+// gatherAddrUDP implements addrGatherer.
+func (g systemCandidateGatherer) gatherAddrUDP(addr HostAddr, opt gathererOptions) ([]*localUDPCandidate, error) {
+	listen := g.listen
+	if listen == nil {
+		listen = net.ListenPacket
+	}
+	var candidates []*localUDPCandidate
+	for component := 1; component <= opt.Components; component++ {
+		c, err := hostCandidate(listen, addr, component, opt)
+		if err != nil {
+			for _, c := range candidates {
+				_ = c.Close()
 			}
-			c.Foundation = Foundation(&c, Addr{})
-			c.Priority = Priority(TypePreference(c.Type), addr.LocalPreference, c.ComponentID)
-			candidates = append(candidates, &localUDPCandidate{
-				candidate: c,
-				conn:      l,
-			})
+			return nil, err
 		}
+		candidates = append(candidates, c)
 	}
 	return candidates, nil
 }
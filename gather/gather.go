@@ -5,19 +5,8 @@ import (
 	"fmt"
 	"net"
 	"sort"
-
-	"gortc.io/ice/internal"
 )
 
-const precedencesCount = 11
-
-var precedences [precedencesCount]precedenceConfig
-
-type precedenceConfig struct {
-	ipNet *net.IPNet
-	value int
-}
-
 // Gatherer is source for addresses.
 //
 // See RFC 8445 Section 2.1 for details on gathering.
@@ -25,49 +14,16 @@ type Gatherer interface {
 	Gather() ([]Addr, error)
 }
 
-func init() {
-	// Initializing policy table.
-	// See RFC 6724 Section 2.1.
-	/*
-	   ::1/128               50     0
-	   ::/0                  40     1
-	   ::ffff:0:0/96         35     4
-	   2002::/16             30     2
-	   2001::/32              5     5
-	   fc00::/7               3    13
-	   ::/96                  1     3
-	   fec0::/10              1    11
-	   3ffe::/16              1    12
-	*/
-	for i, p := range [precedencesCount]struct {
-		cidr  string
-		value int
-		label int
-	}{
-		{"::1/128", 50, 0},
-		{"127.0.0.1/8", 45, 0},
-		{"::/0", 40, 1},
-		{"::ffff:0:0/96", 35, 4},
-		{"fe80::/10", 33, 1},
-		{"2002::/16", 30, 2},
-		{"2001::/32", 5, 5},
-		{"fc00::/7", 3, 13},
-		{"::/96", 1, 3},
-		{"fec0::/10", 1, 11},
-		{"3ffe::/16", 1, 12},
-	} {
-		precedences[i] = precedenceConfig{
-			ipNet: internal.MustParseNet(p.cidr),
-			value: p.value,
-		}
-	}
-}
-
 // Addr represents gathered address from interface.
 type Addr struct {
 	IP         net.IP
 	Zone       string
 	Precedence int
+	Interface  string      // interface name
+	Index      int         // interface index
+	MTU        int         // interface MTU
+	Flags      net.Flags   // interface flags
+	Network    NetworkType // inferred from interface
 }
 
 // Addrs is addr slice helper.
@@ -108,21 +64,13 @@ func (a Addr) ZeroPortAddr() string {
 
 type defaultGatherer struct{}
 
-// Precedence returns precedence value of ip address defined by RFC 6724.
-func Precedence(ip net.IP) int {
-	for _, p := range precedences {
-		if p.ipNet.Contains(ip) {
-			return p.value
-		}
-	}
-	return 0
-}
-
 type netInterface interface {
 	Addrs() ([]net.Addr, error)
 }
 
-func ifaceToAddr(i netInterface, name string) ([]Addr, error) {
+// ifaceToAddr returns addresses of interface, copying interface metadata
+// from meta.
+func ifaceToAddr(i netInterface, meta Addr) ([]Addr, error) {
 	var addrs []Addr
 	netAddrs, err := i.Addrs()
 	if err != nil {
@@ -133,13 +81,12 @@ func ifaceToAddr(i netInterface, name string) ([]Addr, error) {
 		if err != nil {
 			return addrs, err
 		}
-		addr := Addr{
-			IP:         ip,
-			Precedence: Precedence(ip),
-		}
+		addr := meta
+		addr.IP = ip
+		addr.Precedence = Precedence(ip)
 		if ip.IsLinkLocalUnicast() {
 			// Zone must be set for link-local addresses.
-			addr.Zone = name
+			addr.Zone = meta.Interface
 		}
 		addrs = append(addrs, addr)
 	}
@@ -169,7 +116,13 @@ func (g defaultGatherer) Gather() ([]Addr, error) {
 		if !ifaceValid(iface) {
 			continue
 		}
-		ifaceAddrs, err := ifaceToAddr(&iface, iface.Name)
+		ifaceAddrs, err := ifaceToAddr(&iface, Addr{
+			Interface: iface.Name,
+			Index:     iface.Index,
+			MTU:       iface.MTU,
+			Flags:     iface.Flags,
+			Network:   interfaceNetworkType(iface.Name, iface.Flags),
+		})
 		if err != nil {
 			return addrs, err
 		}
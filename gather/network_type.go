@@ -0,0 +1,117 @@
+package gather
+
+import (
+	"net"
+	"strings"
+)
+
+// NetworkType is type of network that interface is attached to.
+type NetworkType byte
+
+// Possible network types.
+const (
+	NetworkUnknown NetworkType = iota
+	NetworkWired
+	NetworkWiFi
+	NetworkCellular
+	NetworkVPN
+	NetworkVirtual // bridges and virtual ethernet of containers and VMs
+	NetworkLoopback
+)
+
+var networkTypeToStr = map[NetworkType]string{
+	NetworkUnknown:  "unknown",
+	NetworkWired:    "wired",
+	NetworkWiFi:     "wifi",
+	NetworkCellular: "cellular",
+	NetworkVPN:      "vpn",
+	NetworkVirtual:  "virtual",
+	NetworkLoopback: "loopback",
+}
+
+func (t NetworkType) String() string {
+	if s, ok := networkTypeToStr[t]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// ParseNetworkType returns NetworkType by its string representation.
+func ParseNetworkType(s string) (NetworkType, bool) {
+	for t, v := range networkTypeToStr {
+		if v == s {
+			return t, true
+		}
+	}
+	return NetworkUnknown, false
+}
+
+// Interface name prefixes by network type, sorted so longer prefixes go
+// before shorter ones that they start with.
+var networkTypePrefixes = []struct {
+	prefix string
+	t      NetworkType
+}{
+	{"docker", NetworkVirtual},
+	{"br-", NetworkVirtual},
+	{"veth", NetworkVirtual},
+	{"virbr", NetworkVirtual},
+	{"vmnet", NetworkVirtual},
+	{"vboxnet", NetworkVirtual},
+	{"tun", NetworkVPN},
+	{"tap", NetworkVPN},
+	{"wg", NetworkVPN},
+	{"ppp", NetworkVPN},
+	{"utun", NetworkVPN},
+	{"ipsec", NetworkVPN},
+	{"wlan", NetworkWiFi},
+	{"wlp", NetworkWiFi},
+	{"wl", NetworkWiFi},
+	{"rmnet", NetworkCellular},
+	{"wwan", NetworkCellular},
+	{"ccmni", NetworkCellular},
+	{"pdp_ip", NetworkCellular},
+	{"eth", NetworkWired},
+	{"en", NetworkWired},
+}
+
+// InferNetworkType returns network type of interface with provided name and
+// flags, using common naming conventions.
+func InferNetworkType(name string, flags net.Flags) NetworkType {
+	if flags&net.FlagLoopback != 0 {
+		return NetworkLoopback
+	}
+	for _, p := range networkTypePrefixes {
+		if strings.HasPrefix(name, p.prefix) {
+			return p.t
+		}
+	}
+	if flags&net.FlagPointToPoint != 0 {
+		return NetworkVPN
+	}
+	return NetworkUnknown
+}
+
+// Network costs, as used by WebRTC implementations.
+const (
+	NetworkCostMin      = 0
+	NetworkCostLow      = 10
+	NetworkCostUnknown  = 50
+	NetworkCostCellular = 900
+	NetworkCostMax      = 999
+)
+
+// Cost returns value of "network-cost" candidate extension for network type,
+// where higher cost means more expensive, e.g. metered, network.
+func (t NetworkType) Cost() int {
+	switch t {
+	case NetworkWired, NetworkLoopback:
+		return NetworkCostMin
+	case NetworkWiFi:
+		return NetworkCostLow
+	case NetworkCellular:
+		return NetworkCostCellular
+	default:
+		return NetworkCostUnknown
+	}
+}
@@ -0,0 +1,50 @@
+package gather
+
+import (
+	"net"
+	"testing"
+)
+
+func TestInferNetworkType(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		flags net.Flags
+		out   NetworkType
+	}{
+		{name: "lo", flags: net.FlagUp | net.FlagLoopback, out: NetworkLoopback},
+		{name: "eth0", out: NetworkWired},
+		{name: "enp3s0", out: NetworkWired},
+		{name: "wlan0", out: NetworkWiFi},
+		{name: "wlp2s0", out: NetworkWiFi},
+		{name: "rmnet_data0", out: NetworkCellular},
+		{name: "tun0", out: NetworkVPN},
+		{name: "wg0", out: NetworkVPN},
+		{name: "docker0", out: NetworkVirtual},
+		{name: "br-2f3e1a", out: NetworkVirtual},
+		{name: "veth12ab", out: NetworkVirtual},
+		{name: "gpd0", flags: net.FlagUp | net.FlagPointToPoint, out: NetworkVPN},
+		{name: "foo0", out: NetworkUnknown},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if out := InferNetworkType(tc.name, tc.flags); out != tc.out {
+				t.Errorf("%s (got) != %s (expected)", out, tc.out)
+			}
+		})
+	}
+}
+
+func TestNetworkType_String(t *testing.T) {
+	for typ := range networkTypeToStr {
+		s := typ.String()
+		parsed, ok := ParseNetworkType(s)
+		if !ok || parsed != typ {
+			t.Errorf("failed to parse %q", s)
+		}
+	}
+	if NetworkType(100).String() != "unknown" {
+		t.Error("unexpected string for invalid type")
+	}
+	if _, ok := ParseNetworkType("bad"); ok {
+		t.Error("should fail")
+	}
+}
@@ -0,0 +1,256 @@
+package gather
+
+import (
+	"net"
+	"sort"
+
+	"gortc.io/ice/internal"
+)
+
+// PolicyEntry is row of RFC 6724 policy table.
+type PolicyEntry struct {
+	Prefix     *net.IPNet
+	Precedence int
+	Label      int
+}
+
+// PolicyTable is RFC 6724 policy table that maps addresses to precedence
+// and label by longest matching prefix. IPv4 addresses and prefixes are
+// matched as IPv4-mapped IPv6 ones.
+//
+// See RFC 6724 Section 2.1.
+type PolicyTable []PolicyEntry
+
+// DefaultPolicyTable is default policy table from RFC 6724 Section 2.1.
+var DefaultPolicyTable = PolicyTable{
+	{Prefix: internal.MustParseNet("::1/128"), Precedence: 50, Label: 0},
+	{Prefix: internal.MustParseNet("::/0"), Precedence: 40, Label: 1},
+	{Prefix: internal.MustParseNet("::ffff:0:0/96"), Precedence: 35, Label: 4},
+	{Prefix: internal.MustParseNet("2002::/16"), Precedence: 30, Label: 2},
+	{Prefix: internal.MustParseNet("2001::/32"), Precedence: 5, Label: 5},
+	{Prefix: internal.MustParseNet("fc00::/7"), Precedence: 3, Label: 13},
+	{Prefix: internal.MustParseNet("::/96"), Precedence: 1, Label: 3},
+	{Prefix: internal.MustParseNet("fec0::/10"), Precedence: 1, Label: 11},
+	{Prefix: internal.MustParseNet("3ffe::/16"), Precedence: 1, Label: 12},
+}
+
+// prefixLen returns length of prefix in IPv6 representation.
+func prefixLen(n *net.IPNet) int {
+	ones, bits := n.Mask.Size()
+	if bits == 8*net.IPv4len {
+		ones += 8 * (net.IPv6len - net.IPv4len)
+	}
+	return ones
+}
+
+// commonPrefixLen returns length of common prefix of a and b in bits,
+// comparing IPv4 addresses in their 4-byte form. Addresses of different
+// families have no common prefix.
+func commonPrefixLen(a, b net.IP) int {
+	if !sameFamily(a, b) {
+		return 0
+	}
+	if a4, b4 := a.To4(), b.To4(); a4 != nil {
+		return prefixBits(a4, b4)
+	}
+	return prefixBits(a.To16(), b.To16())
+}
+
+func prefixBits(a, b net.IP) int {
+	if len(a) != len(b) {
+		return 0
+	}
+	n := 0
+	for i := range a {
+		x := a[i] ^ b[i]
+		if x == 0 {
+			n += 8
+			continue
+		}
+		for x&0x80 == 0 {
+			n++
+			x <<= 1
+		}
+		break
+	}
+	return n
+}
+
+// contains reports whether prefix of n contains ip in IPv6 representation.
+func contains(n *net.IPNet, ip net.IP) bool {
+	ip16, prefix := ip.To16(), n.IP.To16()
+	if ip16 == nil || prefix == nil {
+		return false
+	}
+	return prefixBits(ip16, prefix) >= prefixLen(n)
+}
+
+// Lookup returns entry with longest prefix that matches ip.
+func (t PolicyTable) Lookup(ip net.IP) (PolicyEntry, bool) {
+	var (
+		best    PolicyEntry
+		bestLen = -1
+	)
+	for _, e := range t {
+		if l := prefixLen(e.Prefix); l > bestLen && contains(e.Prefix, ip) {
+			best, bestLen = e, l
+		}
+	}
+	return best, bestLen >= 0
+}
+
+// Precedence returns precedence of ip, or zero if no entry matches.
+func (t PolicyTable) Precedence(ip net.IP) int {
+	e, _ := t.Lookup(ip)
+	return e.Precedence
+}
+
+// Label returns label of ip, or zero if no entry matches.
+func (t PolicyTable) Label(ip net.IP) int {
+	e, _ := t.Lookup(ip)
+	return e.Label
+}
+
+// Precedence returns precedence value of ip address defined by RFC 6724.
+func Precedence(ip net.IP) int {
+	return DefaultPolicyTable.Precedence(ip)
+}
+
+// Scope is address scope as defined by RFC 6724 Section 3.1.
+type Scope byte
+
+// Address scopes, values are the same as for multicast scope field.
+const (
+	ScopeInterfaceLocal Scope = 0x1
+	ScopeLinkLocal      Scope = 0x2
+	ScopeAdminLocal     Scope = 0x4
+	ScopeSiteLocal      Scope = 0x5
+	ScopeOrgLocal       Scope = 0x8
+	ScopeGlobal         Scope = 0xe
+)
+
+var siteLocalIPv6 = internal.MustParseNet("fec0::/10")
+
+// AddrScope returns scope of ip. IPv4 loopback and auto-configuration
+// addresses have link-local scope, other IPv4 addresses are global.
+func AddrScope(ip net.IP) Scope {
+	if ip4 := ip.To4(); ip4 != nil {
+		if ip4.IsLoopback() || ip4.IsLinkLocalUnicast() {
+			return ScopeLinkLocal
+		}
+		return ScopeGlobal
+	}
+	switch {
+	case ip.IsMulticast():
+		return Scope(ip[1] & 0xf)
+	case ip.IsLoopback(), ip.IsLinkLocalUnicast():
+		return ScopeLinkLocal
+	case siteLocalIPv6.Contains(ip):
+		return ScopeSiteLocal
+	default:
+		return ScopeGlobal
+	}
+}
+
+func sameFamily(a, b net.IP) bool {
+	return (a.To4() == nil) == (b.To4() == nil)
+}
+
+// lessSource reports whether source a is preferred over source b for
+// destination dst, using RFC 6724 Section 5 rules that do not require
+// information about interfaces and address states.
+func (t PolicyTable) lessSource(a, b, dst net.IP) bool {
+	// Rule 1: Prefer same address.
+	if a.Equal(dst) != b.Equal(dst) {
+		return a.Equal(dst)
+	}
+	// Rule 2: Prefer appropriate scope.
+	scopeA, scopeB, scopeD := AddrScope(a), AddrScope(b), AddrScope(dst)
+	if scopeA < scopeB {
+		return scopeA >= scopeD
+	}
+	if scopeB < scopeA {
+		return scopeB < scopeD
+	}
+	// Rule 6: Prefer matching label.
+	labelD := t.Label(dst)
+	if matchA, matchB := t.Label(a) == labelD, t.Label(b) == labelD; matchA != matchB {
+		return matchA
+	}
+	// Rule 8: Use longest matching prefix.
+	return commonPrefixLen(a, dst) > commonPrefixLen(b, dst)
+}
+
+// SelectSource returns source address for destination from provided ones
+// by RFC 6724 Section 5 rules, or false if no address of same family.
+func (t PolicyTable) SelectSource(dst net.IP, sources []net.IP) (net.IP, bool) {
+	var best net.IP
+	for _, s := range sources {
+		if !sameFamily(s, dst) {
+			continue
+		}
+		if best == nil || t.lessSource(s, best, dst) {
+			best = s
+		}
+	}
+	return best, best != nil
+}
+
+// Destination is destination address with source address that is used to
+// reach it, if any.
+type Destination struct {
+	IP     net.IP
+	Source net.IP // nil if unusable
+}
+
+// LessDestination reports whether destination a is preferred over b by RFC
+// 6724 Section 6 rules that do not require information about address states
+// and transport.
+func (t PolicyTable) LessDestination(a, b Destination) bool {
+	// Rule 1: Avoid unusable destinations.
+	if (a.Source == nil) != (b.Source == nil) {
+		return a.Source != nil
+	}
+	if a.Source == nil {
+		return false
+	}
+	// Rule 2: Prefer matching scope.
+	scopeA, scopeB := AddrScope(a.IP), AddrScope(b.IP)
+	matchA, matchB := scopeA == AddrScope(a.Source), scopeB == AddrScope(b.Source)
+	if matchA != matchB {
+		return matchA
+	}
+	// Rule 5: Prefer matching label.
+	matchA, matchB = t.Label(a.Source) == t.Label(a.IP), t.Label(b.Source) == t.Label(b.IP)
+	if matchA != matchB {
+		return matchA
+	}
+	// Rule 6: Prefer higher precedence.
+	if precA, precB := t.Precedence(a.IP), t.Precedence(b.IP); precA != precB {
+		return precA > precB
+	}
+	// Rule 8: Prefer smaller scope.
+	if scopeA != scopeB {
+		return scopeA < scopeB
+	}
+	// Rule 9: Use longest matching prefix.
+	if sameFamily(a.IP, b.IP) {
+		return commonPrefixLen(a.Source, a.IP) > commonPrefixLen(b.Source, b.IP)
+	}
+	// Rule 10: Otherwise, leave the order unchanged.
+	return false
+}
+
+// SortDestinations orders destinations by preference, selecting source
+// address for each of them from provided ones.
+func (t PolicyTable) SortDestinations(dst []net.IP, sources []net.IP) {
+	d := make([]Destination, len(dst))
+	for i, ip := range dst {
+		d[i].IP = ip
+		d[i].Source, _ = t.SelectSource(ip, sources)
+	}
+	sort.SliceStable(d, func(i, j int) bool { return t.LessDestination(d[i], d[j]) })
+	for i := range d {
+		dst[i] = d[i].IP
+	}
+}
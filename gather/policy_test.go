@@ -0,0 +1,223 @@
+package gather
+
+import (
+	"net"
+	"testing"
+
+	"gortc.io/ice/internal"
+)
+
+func TestPolicyTable_Lookup(t *testing.T) {
+	for _, tt := range []struct {
+		ip         string
+		precedence int
+		label      int
+	}{
+		{ip: "::1", precedence: 50, label: 0},
+		{ip: "2a00:1450:4010:c05::65", precedence: 40, label: 1},
+		{ip: "fe80::1", precedence: 40, label: 1},
+		{ip: "1.2.3.4", precedence: 35, label: 4},
+		{ip: "127.0.0.1", precedence: 35, label: 4},
+		{ip: "2002:c000:204::1", precedence: 30, label: 2},
+		{ip: "2001::1", precedence: 5, label: 5},
+		{ip: "fd00::1", precedence: 3, label: 13},
+		{ip: "::102:304", precedence: 1, label: 3},
+		{ip: "fec0::1", precedence: 1, label: 11},
+		{ip: "3ffe::1", precedence: 1, label: 12},
+	} {
+		t.Run(tt.ip, func(t *testing.T) {
+			ip := net.ParseIP(tt.ip)
+			if p := DefaultPolicyTable.Precedence(ip); p != tt.precedence {
+				t.Errorf("precedence %d (got) != %d (expected)", p, tt.precedence)
+			}
+			if l := DefaultPolicyTable.Label(ip); l != tt.label {
+				t.Errorf("label %d (got) != %d (expected)", l, tt.label)
+			}
+		})
+	}
+	t.Run("NoMatch", func(t *testing.T) {
+		table := PolicyTable{
+			{Prefix: internal.MustParseNet("10.0.0.0/8"), Precedence: 10, Label: 1},
+		}
+		if _, ok := table.Lookup(net.ParseIP("::1")); ok {
+			t.Error("should not match")
+		}
+		if e, ok := table.Lookup(net.ParseIP("10.1.2.3")); !ok || e.Precedence != 10 {
+			t.Error("should match")
+		}
+	})
+	t.Run("PreferIPv4", func(t *testing.T) {
+		// RFC 6724 Section 10.3.
+		table := append(PolicyTable{}, DefaultPolicyTable...)
+		table[2].Precedence = 100
+		if Precedence(net.ParseIP("1.2.3.4")) > Precedence(net.ParseIP("2a00::1")) {
+			t.Error("default table should prefer IPv6")
+		}
+		if table.Precedence(net.ParseIP("1.2.3.4")) < table.Precedence(net.ParseIP("2a00::1")) {
+			t.Error("modified table should prefer IPv4")
+		}
+	})
+}
+
+func TestAddrScope(t *testing.T) {
+	for _, tt := range []struct {
+		ip    string
+		scope Scope
+	}{
+		{ip: "::1", scope: ScopeLinkLocal},
+		{ip: "fe80::1", scope: ScopeLinkLocal},
+		{ip: "fec0::1", scope: ScopeSiteLocal},
+		{ip: "2a00::1", scope: ScopeGlobal},
+		{ip: "ff02::1", scope: ScopeLinkLocal},
+		{ip: "ff05::2", scope: ScopeSiteLocal},
+		{ip: "ff08::2", scope: ScopeOrgLocal},
+		{ip: "ff0e::2", scope: ScopeGlobal},
+		{ip: "127.0.0.1", scope: ScopeLinkLocal},
+		{ip: "169.254.1.1", scope: ScopeLinkLocal},
+		{ip: "10.0.0.1", scope: ScopeGlobal},
+		{ip: "1.2.3.4", scope: ScopeGlobal},
+	} {
+		t.Run(tt.ip, func(t *testing.T) {
+			if s := AddrScope(net.ParseIP(tt.ip)); s != tt.scope {
+				t.Errorf("%d (got) != %d (expected)", s, tt.scope)
+			}
+		})
+	}
+}
+
+func TestCommonPrefixLen(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		n    int
+	}{
+		{a: "1.2.3.4", b: "1.2.3.4", n: 32},
+		{a: "1.2.3.4", b: "1.2.3.5", n: 31},
+		{a: "128.0.0.0", b: "0.0.0.0", n: 0},
+		{a: "2001:db8::1", b: "2001:db8::2", n: 126},
+		{a: "2001:db8::1", b: "1.2.3.4", n: 0},
+	} {
+		t.Run(tt.a+"/"+tt.b, func(t *testing.T) {
+			if n := commonPrefixLen(net.ParseIP(tt.a), net.ParseIP(tt.b)); n != tt.n {
+				t.Errorf("%d (got) != %d (expected)", n, tt.n)
+			}
+		})
+	}
+}
+
+func parseIPs(s ...string) []net.IP {
+	ips := make([]net.IP, len(s))
+	for i := range s {
+		ips[i] = net.ParseIP(s[i])
+	}
+	return ips
+}
+
+func TestPolicyTable_SelectSource(t *testing.T) {
+	// Examples from RFC 6724 Section 10.1.
+	for _, tt := range []struct {
+		name    string
+		dst     string
+		sources []net.IP
+		src     string
+	}{
+		{
+			name: "Rule2", dst: "2001:db8:1::1",
+			sources: parseIPs("2001:db8:3::1", "fe80::1"), src: "2001:db8:3::1",
+		},
+		{
+			name: "Rule2LinkLocal", dst: "fe80::1",
+			sources: parseIPs("2001:db8:3::2", "fe80::2"), src: "fe80::2",
+		},
+		{
+			name: "Rule1", dst: "2001:db8:1::1",
+			sources: parseIPs("2001:db8:1::1", "2001:db8:3::1"), src: "2001:db8:1::1",
+		},
+		{
+			name: "Rule2Site", dst: "ff05::1",
+			sources: parseIPs("fe80::1", "fec0::1", "2001:db8:1::1"), src: "fec0::1",
+		},
+		{
+			name: "Rule6", dst: "2002:c633:6401::1",
+			sources: parseIPs("2002:c633:6401::2", "2001:db8:1::2"), src: "2002:c633:6401::2",
+		},
+		{
+			name: "Rule8", dst: "2001:db8:1::1",
+			sources: parseIPs("2001:db8:2::1", "2001:db8:1::2"), src: "2001:db8:1::2",
+		},
+		{
+			name: "IPv4", dst: "10.0.0.1",
+			sources: parseIPs("2001:db8:1::2", "192.168.0.1", "10.0.0.2"), src: "10.0.0.2",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			src, ok := DefaultPolicyTable.SelectSource(net.ParseIP(tt.dst), tt.sources)
+			if !ok {
+				t.Fatal("no source")
+			}
+			if !src.Equal(net.ParseIP(tt.src)) {
+				t.Errorf("%s (got) != %s (expected)", src, tt.src)
+			}
+		})
+	}
+	t.Run("NoFamily", func(t *testing.T) {
+		if _, ok := DefaultPolicyTable.SelectSource(net.ParseIP("1.2.3.4"), parseIPs("2001:db8::1")); ok {
+			t.Error("should not select source")
+		}
+	})
+}
+
+func TestPolicyTable_SortDestinations(t *testing.T) {
+	// Examples from RFC 6724 Section 10.2.
+	for _, tt := range []struct {
+		name    string
+		dst     []net.IP
+		sources []net.IP
+		out     []net.IP
+	}{
+		{
+			name:    "Rule1",
+			dst:     parseIPs("2001:db8:1::1", "198.51.100.121"),
+			sources: parseIPs("2001:db8:1::2", "fe80::1", "169.254.13.78"),
+			out:     parseIPs("2001:db8:1::1", "198.51.100.121"),
+		},
+		{
+			name:    "Rule2",
+			dst:     parseIPs("2001:db8:1::1", "198.51.100.121"),
+			sources: parseIPs("fe80::1", "198.51.100.117"),
+			out:     parseIPs("198.51.100.121", "2001:db8:1::1"),
+		},
+		{
+			name:    "Rule6",
+			dst:     parseIPs("2001:db8:1::1", "10.1.2.3"),
+			sources: parseIPs("2001:db8:1::2", "fe80::1", "10.1.2.4"),
+			out:     parseIPs("2001:db8:1::1", "10.1.2.3"),
+		},
+		{
+			name:    "Rule8",
+			dst:     parseIPs("2001:db8:1::1", "fe80::1"),
+			sources: parseIPs("2001:db8:1::2", "fe80::2"),
+			out:     parseIPs("fe80::1", "2001:db8:1::1"),
+		},
+		{
+			name:    "Rule5",
+			dst:     parseIPs("2001:db8:1::1", "2002:c633:6401::1"),
+			sources: parseIPs("2002:c633:6401::2", "fe80::2"),
+			out:     parseIPs("2002:c633:6401::1", "2001:db8:1::1"),
+		},
+		{
+			name:    "Rule9",
+			dst:     parseIPs("2001:db8:3ffe::1", "2001:db8:1::1"),
+			sources: parseIPs("2001:db8:1::2", "2001:db8:3f44::2", "fe80::2"),
+			out:     parseIPs("2001:db8:1::1", "2001:db8:3ffe::1"),
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			DefaultPolicyTable.SortDestinations(tt.dst, tt.sources)
+			for i := range tt.out {
+				if !tt.dst[i].Equal(tt.out[i]) {
+					t.Fatalf("%v (got) != %v (expected)", tt.dst, tt.out)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package gather
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sysfsNetRoot is directory of network interfaces in Linux sysfs.
+const sysfsNetRoot = "/sys/class/net"
+
+// Hardware types of interfaces from if_arp.h.
+const (
+	arphrdEther    = 1
+	arphrdPPP      = 512
+	arphrdRawIP    = 519
+	arphrdTunnel   = 768
+	arphrdTunnel6  = 769
+	arphrdLoopback = 772
+	arphrdSIT      = 776
+	arphrdIPGRE    = 778
+	arphrdNone     = 65534
+)
+
+func sysfsExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// sysfsDevType returns DEVTYPE value from uevent file of interface.
+func sysfsDevType(dir string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "uevent"))
+	if err != nil {
+		return ""
+	}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		if v := strings.TrimPrefix(s.Text(), "DEVTYPE="); v != s.Text() {
+			return v
+		}
+	}
+	return ""
+}
+
+// sysfsNetworkType returns network type of interface from sysfs in root
+// directory, reporting whether the interface was found.
+func sysfsNetworkType(root, name string) (NetworkType, bool) {
+	dir := filepath.Join(root, name)
+	if !sysfsExists(dir) {
+		return NetworkUnknown, false
+	}
+	switch sysfsDevType(dir) {
+	case "wlan":
+		return NetworkWiFi, true
+	case "wwan":
+		return NetworkCellular, true
+	case "bridge":
+		return NetworkVirtual, true
+	case "wireguard", "ppp":
+		return NetworkVPN, true
+	}
+	switch {
+	case sysfsExists(filepath.Join(dir, "wireless")), sysfsExists(filepath.Join(dir, "phy80211")):
+		return NetworkWiFi, true
+	case sysfsExists(filepath.Join(dir, "bridge")):
+		return NetworkVirtual, true
+	case sysfsExists(filepath.Join(dir, "tun_flags")):
+		return NetworkVPN, true
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "type"))
+	if err != nil {
+		return NetworkUnknown, true
+	}
+	hwType, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return NetworkUnknown, true
+	}
+	switch hwType {
+	case arphrdLoopback:
+		return NetworkLoopback, true
+	case arphrdRawIP:
+		return NetworkCellular, true
+	case arphrdPPP, arphrdTunnel, arphrdTunnel6, arphrdSIT, arphrdIPGRE, arphrdNone:
+		return NetworkVPN, true
+	case arphrdEther:
+		if !sysfsExists(filepath.Join(dir, "device")) {
+			// Virtual ethernet without physical device, like veth.
+			return NetworkVirtual, true
+		}
+		return NetworkWired, true
+	default:
+		return NetworkUnknown, true
+	}
+}
+
+// interfaceNetworkType returns network type of interface, using sysfs if
+// available and interface naming conventions otherwise.
+func interfaceNetworkType(name string, flags net.Flags) NetworkType {
+	if flags&net.FlagLoopback != 0 {
+		return NetworkLoopback
+	}
+	if t, ok := sysfsNetworkType(sysfsNetRoot, name); ok && t != NetworkUnknown {
+		return t
+	}
+	return InferNetworkType(name, flags)
+}
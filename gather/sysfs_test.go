@@ -0,0 +1,115 @@
+package gather
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSysfsNetworkType(t *testing.T) {
+	root, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := os.RemoveAll(root); err != nil {
+			t.Error(err)
+		}
+	}()
+	// Files by interface, where names with trailing slash are directories.
+	for name, files := range map[string]map[string]string{
+		"eth0":    {"type": "1", "device/": ""},
+		"veth0":   {"type": "1"},
+		"wlan0":   {"type": "1", "device/": "", "wireless/": ""},
+		"wlp2s0":  {"type": "1", "uevent": "DEVTYPE=wlan"},
+		"wwan0":   {"type": "1", "uevent": "INTERFACE=wwan0\nDEVTYPE=wwan"},
+		"rmnet0":  {"type": "519"},
+		"docker0": {"type": "1", "bridge/": ""},
+		"tun0":    {"type": "65534", "tun_flags": "0x1001"},
+		"wg0":     {"type": "65534", "uevent": "DEVTYPE=wireguard"},
+		"ppp0":    {"type": "512"},
+		"lo":      {"type": "772"},
+		"can0":    {"type": "280"},
+	} {
+		dir := filepath.Join(root, name)
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+		for f, content := range files {
+			path := filepath.Join(dir, f)
+			if strings.HasSuffix(f, "/") {
+				err = os.Mkdir(path, 0700)
+			} else {
+				err = ioutil.WriteFile(path, []byte(content+"\n"), 0600)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for _, tc := range []struct {
+		name  string
+		out   NetworkType
+		found bool
+	}{
+		{name: "eth0", out: NetworkWired, found: true},
+		{name: "veth0", out: NetworkVirtual, found: true},
+		{name: "wlan0", out: NetworkWiFi, found: true},
+		{name: "wlp2s0", out: NetworkWiFi, found: true},
+		{name: "wwan0", out: NetworkCellular, found: true},
+		{name: "rmnet0", out: NetworkCellular, found: true},
+		{name: "docker0", out: NetworkVirtual, found: true},
+		{name: "tun0", out: NetworkVPN, found: true},
+		{name: "wg0", out: NetworkVPN, found: true},
+		{name: "ppp0", out: NetworkVPN, found: true},
+		{name: "lo", out: NetworkLoopback, found: true},
+		{name: "can0", out: NetworkUnknown, found: true},
+		{name: "missing0", out: NetworkUnknown},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			out, found := sysfsNetworkType(root, tc.name)
+			if out != tc.out || found != tc.found {
+				t.Errorf("%s, %v (got) != %s, %v (expected)", out, found, tc.out, tc.found)
+			}
+		})
+	}
+}
+
+type addrsInterface []net.Addr
+
+func (i addrsInterface) Addrs() ([]net.Addr, error) { return i, nil }
+
+func TestIfaceToAddr(t *testing.T) {
+	meta := Addr{
+		Interface: "wlan0",
+		Index:     3,
+		MTU:       1500,
+		Flags:     net.FlagUp | net.FlagMulticast,
+		Network:   NetworkWiFi,
+	}
+	addrs, err := ifaceToAddr(addrsInterface{
+		&net.IPNet{IP: net.IPv4(192, 168, 1, 2), Mask: net.CIDRMask(24, 32)},
+		&net.IPNet{IP: net.ParseIP("fe80::1"), Mask: net.CIDRMask(64, 128)},
+	}, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("unexpected addresses: %v", addrs)
+	}
+	for _, a := range addrs {
+		if a.Interface != meta.Interface || a.Index != meta.Index || a.MTU != meta.MTU ||
+			a.Flags != meta.Flags || a.Network != meta.Network {
+			t.Errorf("metadata is not copied: %+v", a)
+		}
+	}
+	if addrs[0].Zone != "" || addrs[1].Zone != "wlan0" {
+		t.Errorf("unexpected zones %q, %q", addrs[0].Zone, addrs[1].Zone)
+	}
+	if addrs[0].Network.Cost() != NetworkCostLow {
+		t.Errorf("unexpected cost %d", addrs[0].Network.Cost())
+	}
+}
@@ -0,0 +1,218 @@
+package gather
+
+import (
+	"sync"
+	"time"
+)
+
+// EventType is type of host address change.
+type EventType byte
+
+// Possible address changes.
+const (
+	AddrAdded EventType = iota
+	AddrRemoved
+)
+
+var eventTypeToStr = map[EventType]string{
+	AddrAdded:   "added",
+	AddrRemoved: "removed",
+}
+
+func (t EventType) String() string {
+	if s, ok := eventTypeToStr[t]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// Event is change of host address.
+type Event struct {
+	Type EventType
+	Addr Addr
+}
+
+// Watcher reports changes of host addresses after it is created.
+type Watcher interface {
+	// Events returns channel of address changes that is closed by Close.
+	Events() <-chan Event
+	Close() error
+}
+
+// DefaultPollInterval is interval of polling when no notifications about
+// network changes are available.
+const DefaultPollInterval = time.Second * 5
+
+// notifier triggers gathering on possible changes of host addresses.
+type notifier interface {
+	C() <-chan struct{}
+	Close() error
+}
+
+// NewWatcher returns Watcher of addresses from g. On Linux the addresses are
+// gathered on netlink notifications, falling back to polling with provided
+// interval on other systems or if netlink is not available.
+func NewWatcher(g Gatherer, interval time.Duration) (Watcher, error) {
+	n, err := newNetlinkNotifier()
+	if err != nil {
+		return NewPollingWatcher(g, interval)
+	}
+	return newSnapshotWatcher(g, n)
+}
+
+// NewPollingWatcher returns Watcher that gathers addresses from g with
+// provided interval.
+func NewPollingWatcher(g Gatherer, interval time.Duration) (Watcher, error) {
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	return newSnapshotWatcher(g, newPollNotifier(interval))
+}
+
+type pollNotifier struct {
+	ticker *time.Ticker
+	c      chan struct{}
+	done   chan struct{}
+}
+
+func newPollNotifier(interval time.Duration) *pollNotifier {
+	n := &pollNotifier{
+		ticker: time.NewTicker(interval),
+		c:      make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go n.run()
+	return n
+}
+
+func (n *pollNotifier) run() {
+	defer close(n.c)
+	for {
+		select {
+		case <-n.ticker.C:
+			select {
+			case n.c <- struct{}{}:
+			case <-n.done:
+				return
+			}
+		case <-n.done:
+			return
+		}
+	}
+}
+
+func (n *pollNotifier) C() <-chan struct{} { return n.c }
+
+func (n *pollNotifier) Close() error {
+	n.ticker.Stop()
+	close(n.done)
+	return nil
+}
+
+// snapshotWatcher reports difference between consecutive address snapshots.
+type snapshotWatcher struct {
+	g      Gatherer
+	n      notifier
+	known  map[string]Addr
+	events chan Event
+	done   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func addrKey(a Addr) string { return a.IP.String() + "%" + a.Zone }
+
+func newSnapshotWatcher(g Gatherer, n notifier) (*snapshotWatcher, error) {
+	addrs, err := g.Gather()
+	if err != nil {
+		_ = n.Close()
+		return nil, err
+	}
+	w := &snapshotWatcher{
+		g:      g,
+		n:      n,
+		known:  make(map[string]Addr, len(addrs)),
+		events: make(chan Event),
+		done:   make(chan struct{}),
+	}
+	for _, a := range addrs {
+		w.known[addrKey(a)] = a
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+func (w *snapshotWatcher) Events() <-chan Event { return w.events }
+
+func (w *snapshotWatcher) run() {
+	defer w.wg.Done()
+	defer close(w.events)
+	for range w.n.C() {
+		addrs, err := w.g.Gather()
+		if err != nil {
+			continue
+		}
+		for _, e := range w.diff(addrs) {
+			select {
+			case w.events <- e:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// diff updates known addresses, returning changes.
+func (w *snapshotWatcher) diff(addrs []Addr) []Event {
+	var events []Event
+	current := make(map[string]Addr, len(addrs))
+	for _, a := range addrs {
+		k := addrKey(a)
+		current[k] = a
+		if _, ok := w.known[k]; !ok {
+			events = append(events, Event{Type: AddrAdded, Addr: a})
+		}
+	}
+	for k, a := range w.known {
+		if _, ok := current[k]; !ok {
+			events = append(events, Event{Type: AddrRemoved, Addr: a})
+		}
+	}
+	w.known = current
+	return events
+}
+
+// Close stops watching, closing events channel.
+func (w *snapshotWatcher) Close() error {
+	close(w.done)
+	err := w.n.Close()
+	w.wg.Wait()
+	return err
+}
+
+// FakeWatcher is Watcher that reports changes passed to Add and Remove,
+// for tests.
+type FakeWatcher struct {
+	events chan Event
+	once   sync.Once
+}
+
+// NewFakeWatcher returns new FakeWatcher.
+func NewFakeWatcher() *FakeWatcher {
+	return &FakeWatcher{events: make(chan Event)}
+}
+
+// Add reports added address, blocking until the event is received.
+func (w *FakeWatcher) Add(a Addr) { w.events <- Event{Type: AddrAdded, Addr: a} }
+
+// Remove reports removed address, blocking until the event is received.
+func (w *FakeWatcher) Remove(a Addr) { w.events <- Event{Type: AddrRemoved, Addr: a} }
+
+// Events implements Watcher.
+func (w *FakeWatcher) Events() <-chan Event { return w.events }
+
+// Close implements Watcher. Add and Remove should not be called after Close.
+func (w *FakeWatcher) Close() error {
+	w.once.Do(func() { close(w.events) })
+	return nil
+}
@@ -0,0 +1,89 @@
+//go:build linux
+// +build linux
+
+package gather
+
+import (
+	"os"
+	"syscall"
+)
+
+// Multicast groups of rtnetlink, see rtnetlink.h.
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// netlinkNotifier triggers gathering on rtnetlink notifications about
+// changes of links and addresses.
+type netlinkNotifier struct {
+	f *os.File
+	c chan struct{}
+}
+
+func newNetlinkNotifier() (notifier, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	addr := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr,
+	}
+	if err = syscall.Bind(fd, addr); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+	// Non-blocking descriptor is added to runtime poller, so Close
+	// interrupts pending Read.
+	if err = syscall.SetNonblock(fd, true); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("setnonblock", err)
+	}
+	n := &netlinkNotifier{
+		f: os.NewFile(uintptr(fd), "netlink"),
+		c: make(chan struct{}, 1),
+	}
+	go n.run()
+	return n, nil
+}
+
+func (n *netlinkNotifier) run() {
+	defer close(n.c)
+	buf := make([]byte, os.Getpagesize())
+	for {
+		read, err := n.f.Read(buf)
+		if err != nil {
+			return
+		}
+		if !isAddrChange(buf[:read]) {
+			continue
+		}
+		select {
+		case n.c <- struct{}{}:
+		default:
+			// Gathering is already pending.
+		}
+	}
+}
+
+// isAddrChange reports whether netlink messages contain link or address
+// change.
+func isAddrChange(b []byte) bool {
+	messages, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return false
+	}
+	for _, m := range messages {
+		switch m.Header.Type {
+		case syscall.RTM_NEWADDR, syscall.RTM_DELADDR, syscall.RTM_NEWLINK, syscall.RTM_DELLINK:
+			return true
+		}
+	}
+	return false
+}
+
+func (n *netlinkNotifier) C() <-chan struct{} { return n.c }
+
+func (n *netlinkNotifier) Close() error { return n.f.Close() }
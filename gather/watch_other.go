@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package gather
+
+import "errors"
+
+func newNetlinkNotifier() (notifier, error) {
+	return nil, errors.New("netlink is not supported")
+}
@@ -0,0 +1,132 @@
+package gather
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mutableGatherer returns addresses that can be changed concurrently.
+type mutableGatherer struct {
+	mux   sync.Mutex
+	addrs []Addr
+}
+
+func (g *mutableGatherer) Gather() ([]Addr, error) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	return append([]Addr(nil), g.addrs...), nil
+}
+
+func (g *mutableGatherer) set(addrs ...Addr) {
+	g.mux.Lock()
+	g.addrs = addrs
+	g.mux.Unlock()
+}
+
+// manualNotifier triggers gathering on trigger calls.
+type manualNotifier chan struct{}
+
+func (n manualNotifier) C() <-chan struct{} { return n }
+
+func (n manualNotifier) Close() error {
+	close(n)
+	return nil
+}
+
+func nextEvent(t *testing.T, w Watcher) Event {
+	t.Helper()
+	select {
+	case e := <-w.Events():
+		return e
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out")
+	}
+	return Event{}
+}
+
+func TestSnapshotWatcher(t *testing.T) {
+	var (
+		a = Addr{IP: net.IPv4(10, 0, 0, 1)}
+		b = Addr{IP: net.IPv4(10, 0, 0, 2)}
+		c = Addr{IP: net.ParseIP("fe80::1"), Zone: "eth0"}
+	)
+	g := &mutableGatherer{addrs: []Addr{a, b}}
+	n := make(manualNotifier)
+	w, err := newSnapshotWatcher(g, n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.set(a, c)
+	n <- struct{}{}
+	events := []Event{nextEvent(t, w), nextEvent(t, w)}
+	for _, e := range []Event{
+		{Type: AddrAdded, Addr: c},
+		{Type: AddrRemoved, Addr: b},
+	} {
+		found := false
+		for _, got := range events {
+			if got.Type == e.Type && got.Addr.IP.Equal(e.Addr.IP) && got.Addr.Zone == e.Addr.Zone {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("%s %s not found in %v", e.Type, e.Addr, events)
+		}
+	}
+	g.set(a)
+	n <- struct{}{}
+	if e := nextEvent(t, w); e.Type != AddrRemoved || !e.Addr.IP.Equal(c.IP) {
+		t.Errorf("unexpected event %s %s", e.Type, e.Addr)
+	}
+	if err = w.Close(); err != nil {
+		t.Error(err)
+	}
+	if _, ok := <-w.Events(); ok {
+		t.Error("events should be closed")
+	}
+}
+
+func TestNewPollingWatcher(t *testing.T) {
+	g := &mutableGatherer{}
+	w, err := NewPollingWatcher(g, time.Millisecond*10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.set(Addr{IP: net.IPv4(10, 0, 0, 1)})
+	if e := nextEvent(t, w); e.Type != AddrAdded {
+		t.Errorf("unexpected event %s", e.Type)
+	}
+	if err = w.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNewWatcher(t *testing.T) {
+	w, err := NewWatcher(DefaultGatherer, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFakeWatcher(t *testing.T) {
+	w := NewFakeWatcher()
+	addr := Addr{IP: net.IPv4(10, 0, 0, 1)}
+	go func() {
+		w.Add(addr)
+		w.Remove(addr)
+		_ = w.Close()
+	}()
+	for _, expected := range []EventType{AddrAdded, AddrRemoved} {
+		if e := nextEvent(t, w); e.Type != expected {
+			t.Errorf("%s (got) != %s (expected)", e.Type, expected)
+		}
+	}
+	if _, ok := <-w.Events(); ok {
+		t.Error("events should be closed")
+	}
+}
@@ -1,6 +1,13 @@
 package ice
 
-import "testing"
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"gortc.io/ice/gather"
+)
 
 func TestGather(t *testing.T) {
 	_, err := Gather()
@@ -8,3 +15,167 @@ func TestGather(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+type staticGatherer []gather.Addr
+
+func (g staticGatherer) Gather() ([]gather.Addr, error) { return g, nil }
+
+type boundPacketConn struct {
+	mockPacketConn
+	addr *net.UDPAddr
+}
+
+func (c boundPacketConn) LocalAddr() net.Addr { return c.addr }
+
+// portListener binds to any port except busy ones, recording attempts.
+type portListener struct {
+	busy     map[int]bool
+	attempts []int
+}
+
+func (l *portListener) listen(network, address string) (net.PacketConn, error) {
+	addr, err := net.ResolveUDPAddr(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if addr.Port == 0 {
+		// Ephemeral port.
+		addr.Port = 40000
+		return boundPacketConn{addr: addr}, nil
+	}
+	l.attempts = append(l.attempts, addr.Port)
+	if l.busy[addr.Port] {
+		return nil, errors.New("address already in use")
+	}
+	l.busy[addr.Port] = true
+	return boundPacketConn{addr: addr}, nil
+}
+
+func TestSystemCandidateGatherer_Ports(t *testing.T) {
+	g := systemCandidateGatherer{
+		addr: staticGatherer{
+			{IP: net.IPv4(10, 0, 0, 1)},
+			{IP: net.IPv4(10, 0, 0, 2)},
+		},
+	}
+	for _, tc := range []struct {
+		name  string
+		opt   gathererOptions
+		busy  []int
+		ports []int
+		err   bool
+	}{
+		{
+			name:  "Any",
+			ports: []int{40000, 40000},
+		},
+		{
+			name:  "Range",
+			opt:   gathererOptions{PortMin: 5000, PortMax: 5010},
+			busy:  []int{5000, 5001},
+			ports: []int{5002, 5003},
+		},
+		{
+			name: "RangeExhausted",
+			opt:  gathererOptions{PortMin: 5000, PortMax: 5002},
+			busy: []int{5000, 5002},
+			err:  true,
+		},
+		{
+			name:  "Explicit",
+			opt:   gathererOptions{PortMin: 5000, PortMax: 5010, Ports: []int{6000, 6002, 6004}},
+			busy:  []int{6000},
+			ports: []int{6002, 6004},
+		},
+		{
+			name: "ExplicitExhausted",
+			opt:  gathererOptions{Ports: []int{6000, 6002}},
+			busy: []int{6000},
+			err:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			l := &portListener{busy: make(map[int]bool)}
+			for _, port := range tc.busy {
+				l.busy[port] = true
+			}
+			g.listen = l.listen
+			tc.opt.Components = 1
+			candidates, err := g.gatherUDP(tc.opt)
+			if tc.err {
+				exhausted, ok := err.(PortsExhaustedError)
+				if !ok {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if !exhausted.IP.Equal(net.IPv4(10, 0, 0, 2)) {
+					t.Errorf("unexpected IP %s", exhausted.IP)
+				}
+				t.Log(err)
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ports []int
+			for _, c := range candidates {
+				ports = append(ports, c.candidate.Addr.Port)
+			}
+			if !reflect.DeepEqual(ports, tc.ports) {
+				t.Errorf("unexpected ports %v (attempts %v)", ports, l.attempts)
+			}
+		})
+	}
+}
+
+func TestWithPortRange(t *testing.T) {
+	for _, tc := range []struct {
+		min, max int
+		err      error
+	}{
+		{min: 5000, max: 5010},
+		{min: 5000, max: 5000},
+		{min: 0, max: 5000, err: errInvalidPortRange},
+		{min: 5000, max: 4000, err: errInvalidPortRange},
+		{min: 5000, max: 70000, err: errInvalidPortRange},
+	} {
+		if _, err := NewAgent(WithPortRange(tc.min, tc.max)); err != tc.err {
+			t.Errorf("%d-%d: unexpected error %v", tc.min, tc.max, err)
+		}
+	}
+	if _, err := NewAgent(WithPorts(5000, 0)); err != errInvalidPort {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSystemCandidateGatherer_LinkLocal(t *testing.T) {
+	var listened []string
+	g := systemCandidateGatherer{
+		addr: staticGatherer{
+			{IP: net.ParseIP("2001:db8::1")},
+			{IP: net.ParseIP("fe80::1"), Zone: "eth0"},
+		},
+		listen: func(network, address string) (net.PacketConn, error) {
+			listened = append(listened, address)
+			addr, err := net.ResolveUDPAddr(network, address)
+			if err != nil {
+				return nil, err
+			}
+			addr.Port = 40000
+			return boundPacketConn{addr: addr}, nil
+		},
+	}
+	candidates, err := g.gatherUDP(gathererOptions{Components: 1, LinkLocal: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("unexpected candidates count %d", len(candidates))
+	}
+	c := candidates[1].candidate
+	if c.Addr.Zone != "eth0" || c.Base.Zone != "eth0" {
+		t.Errorf("unexpected zone in %s", c.Addr)
+	}
+	if listened[1] != "[fe80::1%eth0]:0" {
+		t.Errorf("unexpected listen address %s", listened[1])
+	}
+}
@@ -2,6 +2,7 @@ package ice
 
 import (
 	"net"
+	"sort"
 
 	"gortc.io/ice/gather"
 	"gortc.io/ice/internal"
@@ -12,6 +13,12 @@ var siteLocalIPv6 = internal.MustParseNet("FEC0::/10")
 
 // IsHostIPValid reports whether ip is valid as host address ip.
 func IsHostIPValid(ip net.IP, ipv6Only bool) bool {
+	return isHostIPValid(ip, ipv6Only, false)
+}
+
+// isHostIPValid is IsHostIPValid that optionally allows IPv6 link-local
+// addresses, which are usable between hosts on same link.
+func isHostIPValid(ip net.IP, ipv6Only, linkLocal bool) bool {
 	var (
 		v4 = ip.To4() != nil
 		v6 = !v4
@@ -36,7 +43,7 @@ func IsHostIPValid(ip net.IP, ipv6Only bool) bool {
 		// address candidates.
 		return false
 	}
-	if ip.IsLinkLocalUnicast() && v6 {
+	if ip.IsLinkLocalUnicast() && v6 && !linkLocal {
 		// When host candidates corresponding to an IPv6 address generated
 		// using a mechanism that prevents location tracking are gathered, then
 		// host candidates corresponding to IPv6 link-local addresses [RFC4291]
@@ -49,7 +56,9 @@ func IsHostIPValid(ip net.IP, ipv6Only bool) bool {
 // HostAddr wraps IP of host interface and local preference.
 type HostAddr struct {
 	IP              net.IP
+	Zone            string // for link-local addresses
 	LocalPreference int
+	NetworkCost     int // of interface network type
 }
 
 // v4 and v6 length must be non-zero, and len(v4) + len(v6) must be len(all).
@@ -70,13 +79,17 @@ func processDualStack(all, v4, v6 []gather.Addr) []HostAddr {
 			v6InARow++
 			hostAddrs = append(hostAddrs, HostAddr{
 				IP:              v6[0].IP,
+				Zone:            v6[0].Zone,
 				LocalPreference: pref,
+				NetworkCost:     v6[0].Network.Cost(),
 			})
 			v6 = v6[1:]
 		} else if len(v4) > 0 {
 			hostAddrs = append(hostAddrs, HostAddr{
 				IP:              v4[0].IP,
+				Zone:            v4[0].Zone,
 				LocalPreference: pref,
+				NetworkCost:     v4[0].Network.Cost(),
 			})
 			v4 = v4[1:]
 		}
@@ -95,11 +108,11 @@ func isV6Only(addrs []gather.Addr) bool {
 	return v6Only
 }
 
-func filterValid(gathered []gather.Addr) []gather.Addr {
+func filterValid(gathered []gather.Addr, linkLocal bool) []gather.Addr {
 	valid := make([]gather.Addr, 0, len(gathered))
 	v6Only := isV6Only(gathered)
 	for _, addr := range gathered {
-		if !IsHostIPValid(addr.IP, v6Only) {
+		if !isHostIPValid(addr.IP, v6Only, linkLocal) {
 			continue
 		}
 		valid = append(valid, addr)
@@ -119,13 +132,27 @@ const (
 // When gathered addresses are only IPv6, the host is considered ipv6-only.
 // When there are both IPv6 and IPv4 addresses, the RFC 8421 is used to
 // calculate local preferences.
+//
+// Addresses on networks with lower cost, like wired ones, have higher local
+// preference than addresses on networks with higher cost, like cellular.
 func HostAddresses(gathered []gather.Addr) ([]HostAddr, error) {
+	return hostAddresses(gathered, false)
+}
+
+// hostAddresses is HostAddresses that optionally keeps IPv6 link-local
+// addresses.
+func hostAddresses(gathered []gather.Addr, linkLocal bool) ([]HostAddr, error) {
 	if len(gathered) == 0 {
 		return []HostAddr{}, nil
 	}
-	validOnly := filterValid(gathered)
+	return addrPreferences(filterValid(gathered, linkLocal)), nil
+}
+
+// addrPreferences returns host addresses with calculated local preference
+// for addresses that are already validated.
+func addrPreferences(validOnly []gather.Addr) []HostAddr {
 	if len(validOnly) == 0 {
-		return []HostAddr{}, nil
+		return []HostAddr{}
 	}
 	if len(validOnly) == 1 {
 		// Setting local preference for single IP as defined
@@ -133,14 +160,46 @@ func HostAddresses(gathered []gather.Addr) ([]HostAddr, error) {
 		return []HostAddr{
 			{
 				IP:              validOnly[0].IP,
+				Zone:            validOnly[0].Zone,
 				LocalPreference: singleIPAddrPreference,
+				NetworkCost:     validOnly[0].Network.Cost(),
 			},
-		}, nil
+		}
 	}
+	// Grouping by network cost, so each group with lower cost gets local
+	// preferences above the ones with higher cost.
 	var (
-		v6Addrs, v4Addrs []gather.Addr
+		costs  []int
+		groups = make(map[int][]gather.Addr)
 	)
 	for _, addr := range validOnly {
+		cost := addr.Network.Cost()
+		if _, ok := groups[cost]; !ok {
+			costs = append(costs, cost)
+		}
+		groups[cost] = append(groups[cost], addr)
+	}
+	sort.Ints(costs)
+	hostAddrs := make([]HostAddr, 0, len(validOnly))
+	offset := len(validOnly)
+	for _, cost := range costs {
+		group := groups[cost]
+		offset -= len(group)
+		for _, a := range groupPreferences(group) {
+			a.LocalPreference += offset
+			hostAddrs = append(hostAddrs, a)
+		}
+	}
+	return hostAddrs
+}
+
+// groupPreferences returns host addresses with local preferences in range
+// from 1 to len(addrs).
+func groupPreferences(addrs []gather.Addr) []HostAddr {
+	var (
+		v6Addrs, v4Addrs []gather.Addr
+	)
+	for _, addr := range addrs {
 		if addr.IP.To4() == nil {
 			v6Addrs = append(v6Addrs, addr)
 		} else {
@@ -149,15 +208,17 @@ func HostAddresses(gathered []gather.Addr) ([]HostAddr, error) {
 	}
 	if len(v4Addrs) == 0 || len(v6Addrs) == 0 {
 		// Single-stack and multi-homed.
-		hostAddrs := make([]HostAddr, 0, len(validOnly))
-		for i, a := range validOnly {
+		hostAddrs := make([]HostAddr, 0, len(addrs))
+		for i, a := range addrs {
 			hostAddrs = append(hostAddrs, HostAddr{
 				IP:              a.IP,
-				LocalPreference: len(validOnly) - i,
+				Zone:            a.Zone,
+				LocalPreference: len(addrs) - i,
+				NetworkCost:     a.Network.Cost(),
 			})
 		}
-		return hostAddrs, nil
+		return hostAddrs
 	}
 	// Dual-stack calculation as defined in RFC 8421.
-	return processDualStack(validOnly, v4Addrs, v6Addrs), nil
+	return processDualStack(addrs, v4Addrs, v6Addrs)
 }
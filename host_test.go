@@ -238,3 +238,74 @@ func TestIsValidHostIP(t *testing.T) {
 		})
 	}
 }
+
+func TestHostAddresses_NetworkCost(t *testing.T) {
+	gotAddr, err := HostAddresses([]gather.Addr{
+		{IP: net.ParseIP("2a03:e2c0:60f:52:cfe1:fdd:daf7:7fa1"), Network: gather.NetworkCellular},
+		{IP: net.ParseIP("1.1.1.1"), Network: gather.NetworkCellular},
+		{IP: net.ParseIP("1.1.1.2"), Network: gather.NetworkWiFi},
+		{IP: net.ParseIP("2a03:e2c0:60f:52:cfe1:fdd:daf7:7fa2"), Network: gather.NetworkWired},
+		{IP: net.ParseIP("1.1.1.3"), Network: gather.NetworkWired},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, exp := range []HostAddr{
+		{IP: net.ParseIP("2a03:e2c0:60f:52:cfe1:fdd:daf7:7fa2"), LocalPreference: 5, NetworkCost: gather.NetworkCostMin},
+		{IP: net.ParseIP("1.1.1.3"), LocalPreference: 4, NetworkCost: gather.NetworkCostMin},
+		{IP: net.ParseIP("1.1.1.2"), LocalPreference: 3, NetworkCost: gather.NetworkCostLow},
+		{IP: net.ParseIP("2a03:e2c0:60f:52:cfe1:fdd:daf7:7fa1"), LocalPreference: 2, NetworkCost: gather.NetworkCostCellular},
+		{IP: net.ParseIP("1.1.1.1"), LocalPreference: 1, NetworkCost: gather.NetworkCostCellular},
+	} {
+		got := gotAddr[i]
+		if got.LocalPreference != exp.LocalPreference || !got.IP.Equal(exp.IP) || got.NetworkCost != exp.NetworkCost {
+			t.Errorf("[%d]: %s, %d, %d (got) != %s, %d, %d (expected)",
+				i, got.IP, got.LocalPreference, got.NetworkCost, exp.IP, exp.LocalPreference, exp.NetworkCost,
+			)
+		}
+	}
+}
+
+func TestHostAddresses_LinkLocal(t *testing.T) {
+	gathered := []gather.Addr{
+		{IP: net.ParseIP("2001:db8::1"), Interface: "eth0"},
+		{IP: net.ParseIP("fe80::1"), Zone: "eth0", Interface: "eth0"},
+	}
+	for _, tc := range []struct {
+		name      string
+		linkLocal bool
+		out       []HostAddr
+	}{
+		{
+			name: "Disabled",
+			out: []HostAddr{
+				{IP: net.ParseIP("2001:db8::1"), LocalPreference: singleIPAddrPreference},
+			},
+		},
+		{
+			name:      "Enabled",
+			linkLocal: true,
+			out: []HostAddr{
+				{IP: net.ParseIP("2001:db8::1"), LocalPreference: 2},
+				{IP: net.ParseIP("fe80::1"), Zone: "eth0", LocalPreference: 1},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := hostAddresses(gathered, tc.linkLocal)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tc.out) {
+				t.Fatalf("unexpected addresses: %v", got)
+			}
+			for i, exp := range tc.out {
+				if !got[i].IP.Equal(exp.IP) || got[i].Zone != exp.Zone || got[i].LocalPreference != exp.LocalPreference {
+					t.Errorf("[%d]: %s%%%s, %d (got) != %s%%%s, %d (expected)",
+						i, got[i].IP, got[i].Zone, got[i].LocalPreference, exp.IP, exp.Zone, exp.LocalPreference,
+					)
+				}
+			}
+		})
+	}
+}
@@ -3,7 +3,10 @@
 // A Protocol for Network Address Translator (NAT) Traversal
 package ice
 
-import "encoding/binary"
+import (
+	"encoding/binary"
+	"fmt"
+)
 
 // bin is shorthand for BigEndian.
 var bin = binary.BigEndian
@@ -31,3 +34,19 @@ var stateToStr = map[State]string{
 }
 
 func (s State) String() string { return stateToStr[s] }
+
+// UnmarshalText implements TextUnmarshaler.
+func (s *State) UnmarshalText(text []byte) error {
+	for k, v := range stateToStr {
+		if string(text) == v {
+			*s = k
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown state value: %q", text)
+}
+
+// MarshalText implements TextMarshaler.
+func (s State) MarshalText() (text []byte, err error) {
+	return []byte(s.String()), nil
+}
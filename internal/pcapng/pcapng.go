@@ -0,0 +1,162 @@
+// Package pcapng implements writer of pcapng capture files with UDP packets
+// that have synthesized IP and UDP headers.
+//
+// See draft-ietf-opsawg-pcapng.
+package pcapng
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Block types.
+const (
+	blockSectionHeader        = 0x0A0D0D0A
+	blockInterfaceDescription = 0x00000001
+	blockEnhancedPacket       = 0x00000006
+)
+
+const (
+	byteOrderMagic = 0x1A2B3C4D
+	linkTypeRaw    = 101 // raw IPv4 or IPv6, LINKTYPE_RAW
+	protoUDP       = 17
+	defaultTTL     = 64
+
+	ipv4HeaderSize = 20
+	ipv6HeaderSize = 40
+	udpHeaderSize  = 8
+)
+
+// Writer writes UDP packets to little-endian pcapng file with single raw IP
+// interface.
+// Writer is safe for concurrent use.
+type Writer struct {
+	mux sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+// NewWriter writes section header and interface description to w,
+// returning Writer for packets.
+func NewWriter(w io.Writer) (*Writer, error) {
+	header := make([]byte, 0, 48)
+	// Section Header Block.
+	header = appendUint32(header, blockSectionHeader)
+	header = appendUint32(header, 28)
+	header = appendUint32(header, byteOrderMagic)
+	header = appendUint16(header, 1) // major version
+	header = appendUint16(header, 0) // minor version
+	header = appendUint32(header, 0xFFFFFFFF)
+	header = appendUint32(header, 0xFFFFFFFF) // section length is not specified
+	header = appendUint32(header, 28)
+	// Interface Description Block.
+	header = appendUint32(header, blockInterfaceDescription)
+	header = appendUint32(header, 20)
+	header = appendUint16(header, linkTypeRaw)
+	header = appendUint16(header, 0) // reserved
+	header = appendUint32(header, 0) // no snapshot length limit
+	header = appendUint32(header, 20)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w}, nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+// WritePacket writes UDP datagram with payload from src to dst that was
+// sent or received at t. IPv4 addresses are written as IPv6 ones if other
+// address is IPv6.
+func (w *Writer) WritePacket(t time.Time, src, dst *net.UDPAddr, payload []byte) error {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	packet := appendIPPacket(w.buf[:0], src, dst, payload)
+	padding := (4 - len(packet)%4) % 4
+	total := 32 + len(packet) + padding
+	ts := uint64(t.UnixNano() / int64(time.Microsecond))
+	b := make([]byte, 0, total)
+	b = appendUint32(b, blockEnhancedPacket)
+	b = appendUint32(b, uint32(total))
+	b = appendUint32(b, 0) // interface ID
+	b = appendUint32(b, uint32(ts>>32))
+	b = appendUint32(b, uint32(ts))
+	b = appendUint32(b, uint32(len(packet))) // captured length
+	b = appendUint32(b, uint32(len(packet))) // original length
+	b = append(b, packet...)
+	b = append(b, make([]byte, padding)...)
+	b = appendUint32(b, uint32(total))
+	w.buf = packet
+	_, err := w.w.Write(b)
+	return err
+}
+
+// appendIPPacket appends IP packet with UDP datagram to b.
+func appendIPPacket(b []byte, src, dst *net.UDPAddr, payload []byte) []byte {
+	udpLength := udpHeaderSize + len(payload)
+	srcIP, dstIP := src.IP.To4(), dst.IP.To4()
+	if srcIP == nil || dstIP == nil {
+		srcIP, dstIP = src.IP.To16(), dst.IP.To16()
+	}
+	if len(srcIP) == net.IPv4len {
+		start := len(b)
+		b = append(b, 0x45, 0) // version 4, header length 5 words, TOS
+		b = append(b, byte((ipv4HeaderSize+udpLength)>>8), byte(ipv4HeaderSize+udpLength))
+		b = append(b, 0, 0, 0, 0) // identification, flags and fragment offset
+		b = append(b, defaultTTL, protoUDP, 0, 0)
+		b = append(b, srcIP...)
+		b = append(b, dstIP...)
+		sum := ^fold(checksum(0, b[start:]))
+		b[start+10], b[start+11] = byte(sum>>8), byte(sum)
+	} else {
+		b = append(b, 0x60, 0, 0, 0) // version 6, traffic class, flow label
+		b = append(b, byte(udpLength>>8), byte(udpLength), protoUDP, defaultTTL)
+		b = append(b, srcIP...)
+		b = append(b, dstIP...)
+	}
+	start := len(b)
+	b = append(b,
+		byte(src.Port>>8), byte(src.Port),
+		byte(dst.Port>>8), byte(dst.Port),
+		byte(udpLength>>8), byte(udpLength),
+		0, 0,
+	)
+	b = append(b, payload...)
+	// Pseudo header checksum.
+	sum := checksum(0, srcIP)
+	sum = checksum(sum, dstIP)
+	sum += protoUDP + uint32(udpLength)
+	sum = checksum(sum, b[start:])
+	c := ^fold(sum)
+	if c == 0 {
+		// Zero means no checksum, so it is transmitted as all ones.
+		c = 0xFFFF
+	}
+	b[start+6], b[start+7] = byte(c>>8), byte(c)
+	return b
+}
+
+// checksum adds b to one's complement sum.
+func checksum(sum uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		sum += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+	if len(b)%2 == 1 {
+		sum += uint32(b[len(b)-1]) << 8
+	}
+	return sum
+}
+
+func fold(sum uint32) uint16 {
+	for sum > 0xFFFF {
+		sum = sum>>16 + sum&0xFFFF
+	}
+	return uint16(sum)
+}
@@ -0,0 +1,87 @@
+package pcapng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w, err := NewWriter(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 48 {
+		t.Fatalf("unexpected header length %d", buf.Len())
+	}
+	now := time.Unix(1, 500)
+	for _, tc := range []struct {
+		name     string
+		src, dst *net.UDPAddr
+		header   int
+	}{
+		{
+			name:   "IPv4",
+			src:    &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000},
+			dst:    &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 2000},
+			header: ipv4HeaderSize,
+		},
+		{
+			name:   "IPv6",
+			src:    &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1000},
+			dst:    &net.UDPAddr{IP: net.ParseIP("2001:db8::2"), Port: 2000},
+			header: ipv6HeaderSize,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			buf.Reset()
+			payload := []byte{0, 1, 0, 0, 1, 2, 3}
+			if err := w.WritePacket(now, tc.src, tc.dst, payload); err != nil {
+				t.Fatal(err)
+			}
+			b := buf.Bytes()
+			le := binary.LittleEndian
+			if le.Uint32(b) != blockEnhancedPacket {
+				t.Fatal("unexpected block type")
+			}
+			total := int(le.Uint32(b[4:]))
+			if total != len(b) || total%4 != 0 || int(le.Uint32(b[total-4:])) != total {
+				t.Fatalf("unexpected block length %d", total)
+			}
+			if ts := uint64(le.Uint32(b[12:]))<<32 | uint64(le.Uint32(b[16:])); ts != 1000000 {
+				t.Errorf("unexpected timestamp %d", ts)
+			}
+			n := int(le.Uint32(b[20:]))
+			if n != tc.header+udpHeaderSize+len(payload) {
+				t.Fatalf("unexpected packet length %d", n)
+			}
+			packet := b[28 : 28+n]
+			if tc.header == ipv4HeaderSize {
+				if fold(checksum(0, packet[:ipv4HeaderSize])) != 0xFFFF {
+					t.Error("bad IPv4 header checksum")
+				}
+			}
+			udp := packet[tc.header:]
+			if binary.BigEndian.Uint16(udp) != 1000 || binary.BigEndian.Uint16(udp[2:]) != 2000 {
+				t.Error("unexpected ports")
+			}
+			sum := checksum(0, tc.src.IP.To16())
+			if tc.header == ipv4HeaderSize {
+				sum = checksum(0, tc.src.IP.To4())
+				sum = checksum(sum, tc.dst.IP.To4())
+			} else {
+				sum = checksum(sum, tc.dst.IP.To16())
+			}
+			sum += protoUDP + uint32(len(udp))
+			if fold(checksum(sum, udp)) != 0xFFFF {
+				t.Error("bad UDP checksum")
+			}
+			if !bytes.Equal(udp[udpHeaderSize:], payload) {
+				t.Error("unexpected payload")
+			}
+		})
+	}
+}
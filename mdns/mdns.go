@@ -0,0 +1,255 @@
+// Package mdns implements minimal Multicast DNS (RFC 6762) querier and
+// responder for host names used to obfuscate ICE host candidates.
+//
+// See https://tools.ietf.org/html/draft-ietf-mmusic-mdns-ice-candidates for
+// details on using mDNS with ICE.
+package mdns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultAddr is IPv4 mDNS multicast group address.
+var DefaultAddr = &net.UDPAddr{
+	IP:   net.IPv4(224, 0, 0, 251),
+	Port: 5353,
+}
+
+const (
+	maxMessageSize = 9000
+	// Time between retransmissions of query, see RFC 6762 Section 5.2.
+	queryInterval = time.Second
+	// Recommended TTL for host name records, see RFC 6762 Section 10.
+	defaultTTL = 120
+)
+
+// ErrClosed is returned when using closed Conn.
+var ErrClosed = errors.New("mdns: connection closed")
+
+// Conn is mDNS querier and responder over single packet connection.
+type Conn struct {
+	conn  net.PacketConn
+	group net.Addr
+	log   *zap.Logger
+
+	mux     sync.Mutex
+	names   map[string]net.IP // published names
+	queries map[*query]struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+type query struct {
+	name   string
+	result chan []net.IP
+}
+
+// Listen joins IPv4 mDNS multicast group on the default interface and
+// starts serving.
+func Listen(log *zap.Logger) (*Conn, error) {
+	conn, err := net.ListenMulticastUDP("udp4", nil, DefaultAddr)
+	if err != nil {
+		return nil, err
+	}
+	return NewConn(conn, DefaultAddr, log), nil
+}
+
+// NewConn initializes and starts serving new mDNS connection, where group
+// is multicast address that is used for queries and responses.
+func NewConn(conn net.PacketConn, group net.Addr, log *zap.Logger) *Conn {
+	if log == nil {
+		log = zap.NewNop()
+	}
+	c := &Conn{
+		conn:    conn,
+		group:   group,
+		log:     log,
+		names:   make(map[string]net.IP),
+		queries: make(map[*query]struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.readUntilClose()
+	return c
+}
+
+// Publish starts responding to queries for name with ip.
+func (c *Conn) Publish(name string, ip net.IP) {
+	c.mux.Lock()
+	c.names[normalizeName(name)] = ip
+	c.mux.Unlock()
+}
+
+// Unpublish stops responding to queries for name.
+func (c *Conn) Unpublish(name string) {
+	c.mux.Lock()
+	delete(c.names, normalizeName(name))
+	c.mux.Unlock()
+}
+
+// Resolve sends queries for name until first response is received or ctx is
+// done, returning all addresses from that response.
+func (c *Conn) Resolve(ctx context.Context, name string) ([]net.IP, error) {
+	q := &query{
+		name:   normalizeName(name),
+		result: make(chan []net.IP, 1),
+	}
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		return nil, ErrClosed
+	}
+	c.queries[q] = struct{}{}
+	c.mux.Unlock()
+	defer func() {
+		c.mux.Lock()
+		delete(c.queries, q)
+		c.mux.Unlock()
+	}()
+	ticker := time.NewTicker(queryInterval)
+	defer ticker.Stop()
+	for {
+		if err := c.sendQuery(q.name); err != nil {
+			return nil, err
+		}
+		select {
+		case ips := <-q.result:
+			return ips, nil
+		case <-ticker.C:
+		case <-c.done:
+			return nil, ErrClosed
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Close stops serving and closes underlying connection.
+func (c *Conn) Close() error {
+	c.mux.Lock()
+	if c.closed {
+		c.mux.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	c.mux.Unlock()
+	return c.conn.Close()
+}
+
+func (c *Conn) send(m *message) error {
+	b, err := m.Append(make([]byte, 0, 512))
+	if err != nil {
+		return err
+	}
+	_, err = c.conn.WriteTo(b, c.group)
+	return err
+}
+
+func (c *Conn) sendQuery(name string) error {
+	return c.send(&message{
+		Questions: []question{
+			{Name: name, Type: typeA, Class: classINET},
+			{Name: name, Type: typeAAAA, Class: classINET},
+		},
+	})
+}
+
+func (c *Conn) readUntilClose() {
+	buf := make([]byte, maxMessageSize)
+	m := new(message)
+	for {
+		n, _, err := c.conn.ReadFrom(buf)
+		if err != nil {
+			c.log.Debug("read failed", zap.Error(err))
+			break
+		}
+		if err = m.Decode(buf[:n]); err != nil {
+			c.log.Debug("failed to decode message", zap.Error(err))
+			continue
+		}
+		if m.isResponse() {
+			c.handleResponse(m)
+			continue
+		}
+		if err = c.handleQuery(m); err != nil {
+			c.log.Debug("failed to handle query", zap.Error(err))
+		}
+	}
+}
+
+func (c *Conn) handleQuery(m *message) error {
+	res := &message{
+		Flags: flagResponse | flagAuthoritative,
+	}
+	c.mux.Lock()
+	for _, q := range m.Questions {
+		if q.Class&classMask != classINET {
+			continue
+		}
+		ip, ok := c.names[normalizeName(q.Name)]
+		if !ok {
+			continue
+		}
+		r := resource{
+			Name:  q.Name,
+			Class: classINET | cacheFlush,
+			TTL:   defaultTTL,
+		}
+		if v4 := ip.To4(); v4 != nil {
+			r.Type = typeA
+			r.Data = v4
+		} else {
+			r.Type = typeAAAA
+			r.Data = ip.To16()
+		}
+		if q.Type != r.Type && q.Type != typeANY {
+			continue
+		}
+		res.Answers = append(res.Answers, r)
+	}
+	c.mux.Unlock()
+	if len(res.Answers) == 0 {
+		return nil
+	}
+	return c.send(res)
+}
+
+func (c *Conn) handleResponse(m *message) {
+	found := make(map[string][]net.IP)
+	for _, r := range m.Answers {
+		if r.Class&classMask != classINET {
+			continue
+		}
+		var ip net.IP
+		switch {
+		case r.Type == typeA && len(r.Data) == net.IPv4len:
+			ip = net.IPv4(r.Data[0], r.Data[1], r.Data[2], r.Data[3])
+		case r.Type == typeAAAA && len(r.Data) == net.IPv6len:
+			ip = make(net.IP, net.IPv6len)
+			copy(ip, r.Data)
+		default:
+			continue
+		}
+		name := normalizeName(r.Name)
+		found[name] = append(found[name], ip)
+	}
+	c.mux.Lock()
+	for q := range c.queries {
+		ips, ok := found[q.name]
+		if !ok {
+			continue
+		}
+		select {
+		case q.result <- ips:
+		default:
+			// Result is already delivered.
+		}
+	}
+	c.mux.Unlock()
+}
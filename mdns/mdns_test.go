@@ -0,0 +1,129 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// hub emulates multicast group, delivering each packet to every member.
+type hub struct {
+	mux     sync.Mutex
+	members []*hubConn
+}
+
+type hubPacket struct {
+	buf  []byte
+	addr net.Addr
+}
+
+type hubConn struct {
+	h      *hub
+	addr   net.Addr
+	in     chan hubPacket
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (h *hub) conn(addr net.Addr) *hubConn {
+	c := &hubConn{
+		h:      h,
+		addr:   addr,
+		in:     make(chan hubPacket, 10),
+		closed: make(chan struct{}),
+	}
+	h.mux.Lock()
+	h.members = append(h.members, c)
+	h.mux.Unlock()
+	return c
+}
+
+func (c *hubConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	select {
+	case pkt := <-c.in:
+		return copy(p, pkt.buf), pkt.addr, nil
+	case <-c.closed:
+		return 0, nil, ErrClosed
+	}
+}
+
+func (c *hubConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.h.mux.Lock()
+	defer c.h.mux.Unlock()
+	for _, m := range c.h.members {
+		buf := make([]byte, len(p))
+		copy(buf, p)
+		select {
+		case m.in <- hubPacket{buf: buf, addr: c.addr}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+func (c *hubConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *hubConn) LocalAddr() net.Addr                { return c.addr }
+func (c *hubConn) SetDeadline(t time.Time) error      { return nil }
+func (c *hubConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *hubConn) SetWriteDeadline(t time.Time) error { return nil }
+
+func TestConn_Resolve(t *testing.T) {
+	h := new(hub)
+	a := NewConn(h.conn(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 5353}), DefaultAddr, nil)
+	b := NewConn(h.conn(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 5353}), DefaultAddr, nil)
+	defer func() {
+		if err := a.Close(); err != nil {
+			t.Error(err)
+		}
+		if err := b.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	a.Publish("1f30e3a4-6aa5-4fb8-96f9-3b2c1a3fc4a1.local", net.IPv4(10, 0, 0, 1))
+	t.Run("Published", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		ips, err := b.Resolve(ctx, "1F30E3A4-6AA5-4FB8-96F9-3B2C1A3FC4A1.local.")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ips) != 1 || !ips[0].Equal(net.IPv4(10, 0, 0, 1)) {
+			t.Errorf("unexpected result %v", ips)
+		}
+	})
+	t.Run("Unpublished", func(t *testing.T) {
+		a.Unpublish("1f30e3a4-6aa5-4fb8-96f9-3b2c1a3fc4a1.local")
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+		defer cancel()
+		if _, err := b.Resolve(ctx, "1f30e3a4-6aa5-4fb8-96f9-3b2c1a3fc4a1.local"); err != context.DeadlineExceeded {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("IPv6", func(t *testing.T) {
+		a.Publish("v6.local", net.ParseIP("2001:db8::1"))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		ips, err := b.Resolve(ctx, "v6.local")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ips) != 1 || !ips[0].Equal(net.ParseIP("2001:db8::1")) {
+			t.Errorf("unexpected result %v", ips)
+		}
+	})
+	t.Run("Closed", func(t *testing.T) {
+		c := NewConn(h.conn(&net.UDPAddr{IP: net.IPv4(10, 0, 0, 3), Port: 5353}), DefaultAddr, nil)
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := c.Resolve(context.Background(), "v6.local"); err != ErrClosed {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
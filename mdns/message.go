@@ -0,0 +1,239 @@
+package mdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+var bin = binary.BigEndian
+
+// Record types and classes from RFC 1035 and RFC 3596.
+const (
+	typeA    uint16 = 1
+	typeAAAA uint16 = 28
+	typeANY  uint16 = 255
+
+	classINET uint16 = 1
+	// classMask removes unicast-response bit from question class or
+	// cache-flush bit from resource record class, see RFC 6762 Section 18.
+	classMask uint16 = 1<<15 - 1
+	// cacheFlush is the cache-flush bit for unique resource records.
+	cacheFlush uint16 = 1 << 15
+)
+
+// Header flags.
+const (
+	flagResponse      uint16 = 1 << 15
+	flagAuthoritative uint16 = 1 << 10
+)
+
+const (
+	headerSize    = 12
+	maxLabelSize  = 63
+	maxNameSize   = 255
+	maxPointers   = 10
+	pointerMask   = 0xC0
+	pointerOffset = 0x3FFF
+)
+
+var (
+	errUnexpectedEOF   = errors.New("unexpected end of message")
+	errLabelTooLong    = errors.New("label is too long")
+	errNameTooLong     = errors.New("name is too long")
+	errTooManyPointers = errors.New("too many compression pointers")
+)
+
+// question is DNS question section entry.
+type question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// resource is DNS resource record.
+type resource struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+}
+
+// message is DNS message as used by mDNS.
+//
+// Resource records from answer, authority and additional sections are
+// decoded into Answers, because all of them can be used for resolution.
+type message struct {
+	ID        uint16
+	Flags     uint16
+	Questions []question
+	Answers   []resource
+}
+
+func (m *message) isResponse() bool { return m.Flags&flagResponse != 0 }
+
+// normalizeName returns lower case name without trailing dot.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
+
+func appendName(b []byte, name string) ([]byte, error) {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > maxNameSize {
+		return b, errNameTooLong
+	}
+	if name != "" {
+		for _, label := range strings.Split(name, ".") {
+			if len(label) > maxLabelSize {
+				return b, errLabelTooLong
+			}
+			b = append(b, byte(len(label)))
+			b = append(b, label...)
+		}
+	}
+	return append(b, 0), nil
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// Append appends encoded message to b, placing all resource records to
+// the answer section. Names are not compressed.
+func (m *message) Append(b []byte) ([]byte, error) {
+	b = appendUint16(b, m.ID)
+	b = appendUint16(b, m.Flags)
+	b = appendUint16(b, uint16(len(m.Questions)))
+	b = appendUint16(b, uint16(len(m.Answers)))
+	b = appendUint16(b, 0) // authority
+	b = appendUint16(b, 0) // additional
+	var err error
+	for _, q := range m.Questions {
+		if b, err = appendName(b, q.Name); err != nil {
+			return b, err
+		}
+		b = appendUint16(b, q.Type)
+		b = appendUint16(b, q.Class)
+	}
+	for _, r := range m.Answers {
+		if b, err = appendName(b, r.Name); err != nil {
+			return b, err
+		}
+		b = appendUint16(b, r.Type)
+		b = appendUint16(b, r.Class)
+		b = appendUint32(b, r.TTL)
+		b = appendUint16(b, uint16(len(r.Data)))
+		b = append(b, r.Data...)
+	}
+	return b, nil
+}
+
+// readName reads possibly compressed name from msg at offset, returning
+// name and offset after it.
+func readName(msg []byte, offset int) (string, int, error) {
+	var (
+		labels   []string
+		size     int
+		pointers int
+		next     = -1 // offset after name if pointer was followed
+	)
+	for {
+		if offset >= len(msg) {
+			return "", 0, errUnexpectedEOF
+		}
+		l := int(msg[offset])
+		switch {
+		case l == 0:
+			offset++
+			if next < 0 {
+				next = offset
+			}
+			return strings.Join(labels, "."), next, nil
+		case l&pointerMask == pointerMask:
+			if offset+1 >= len(msg) {
+				return "", 0, errUnexpectedEOF
+			}
+			pointers++
+			if pointers > maxPointers {
+				return "", 0, errTooManyPointers
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(bin.Uint16(msg[offset:])) & pointerOffset
+		case l > maxLabelSize:
+			return "", 0, errLabelTooLong
+		default:
+			offset++
+			if offset+l > len(msg) {
+				return "", 0, errUnexpectedEOF
+			}
+			size += l + 1
+			if size > maxNameSize {
+				return "", 0, errNameTooLong
+			}
+			labels = append(labels, string(msg[offset:offset+l]))
+			offset += l
+		}
+	}
+}
+
+// Decode decodes message from b.
+func (m *message) Decode(b []byte) error {
+	if len(b) < headerSize {
+		return errUnexpectedEOF
+	}
+	m.ID = bin.Uint16(b[0:2])
+	m.Flags = bin.Uint16(b[2:4])
+	var (
+		questions = int(bin.Uint16(b[4:6]))
+		resources = int(bin.Uint16(b[6:8])) + int(bin.Uint16(b[8:10])) + int(bin.Uint16(b[10:12]))
+		offset    = headerSize
+		name      string
+		err       error
+	)
+	m.Questions = m.Questions[:0]
+	m.Answers = m.Answers[:0]
+	for i := 0; i < questions; i++ {
+		if name, offset, err = readName(b, offset); err != nil {
+			return err
+		}
+		if offset+4 > len(b) {
+			return errUnexpectedEOF
+		}
+		m.Questions = append(m.Questions, question{
+			Name:  name,
+			Type:  bin.Uint16(b[offset:]),
+			Class: bin.Uint16(b[offset+2:]),
+		})
+		offset += 4
+	}
+	for i := 0; i < resources; i++ {
+		if name, offset, err = readName(b, offset); err != nil {
+			return err
+		}
+		if offset+10 > len(b) {
+			return errUnexpectedEOF
+		}
+		r := resource{
+			Name:  name,
+			Type:  bin.Uint16(b[offset:]),
+			Class: bin.Uint16(b[offset+2:]),
+			TTL:   bin.Uint32(b[offset+4:]),
+		}
+		l := int(bin.Uint16(b[offset+8:]))
+		offset += 10
+		if offset+l > len(b) {
+			return errUnexpectedEOF
+		}
+		r.Data = b[offset : offset+l]
+		offset += l
+		m.Answers = append(m.Answers, r)
+	}
+	return nil
+}
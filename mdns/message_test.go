@@ -0,0 +1,82 @@
+package mdns
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMessage_Decode(t *testing.T) {
+	m := &message{
+		Flags: flagResponse,
+		Questions: []question{
+			{Name: "a.local", Type: typeA, Class: classINET},
+		},
+		Answers: []resource{
+			{Name: "a.local.", Type: typeA, Class: classINET | cacheFlush, TTL: 120, Data: []byte{10, 0, 0, 1}},
+		},
+	}
+	b, err := m.Append(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := new(message)
+	if err = decoded.Decode(b); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.isResponse() {
+		t.Error("should be response")
+	}
+	if len(decoded.Questions) != 1 || decoded.Questions[0].Name != "a.local" {
+		t.Errorf("unexpected questions %+v", decoded.Questions)
+	}
+	if len(decoded.Answers) != 1 {
+		t.Fatalf("unexpected answers %+v", decoded.Answers)
+	}
+	a := decoded.Answers[0]
+	if a.Name != "a.local" || a.TTL != 120 || a.Class&classMask != classINET {
+		t.Errorf("unexpected answer %+v", a)
+	}
+	if !bytes.Equal(a.Data, []byte{10, 0, 0, 1}) {
+		t.Errorf("unexpected data %v", a.Data)
+	}
+	t.Run("Compressed", func(t *testing.T) {
+		// Answer name is pointer to question name at offset 12.
+		b := []byte{
+			0, 0, 0x84, 0, 0, 1, 0, 1, 0, 0, 0, 0,
+			1, 'a', 5, 'l', 'o', 'c', 'a', 'l', 0, 0, 1, 0, 1,
+			0xC0, 12, 0, 1, 0x80, 1, 0, 0, 0, 120, 0, 4, 10, 0, 0, 2,
+		}
+		m := new(message)
+		if err := m.Decode(b); err != nil {
+			t.Fatal(err)
+		}
+		if len(m.Answers) != 1 || m.Answers[0].Name != "a.local" {
+			t.Errorf("unexpected answers %+v", m.Answers)
+		}
+	})
+	t.Run("PointerLoop", func(t *testing.T) {
+		b := []byte{
+			0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0,
+			0xC0, 12, 0, 1, 0, 1,
+		}
+		if err := new(message).Decode(b); err != errTooManyPointers {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("EOF", func(t *testing.T) {
+		for i := 0; i < len(b); i++ {
+			if err := new(message).Decode(b[:i]); err == nil {
+				t.Errorf("[%d] should error", i)
+			}
+		}
+	})
+}
+
+func TestAppendName(t *testing.T) {
+	if _, err := appendName(nil, string(make([]byte, maxLabelSize+1))); err != errLabelTooLong {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := appendName(nil, string(make([]byte, maxNameSize+1))); err != errNameTooLong {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package ice
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Counter is aggregate agent counter.
+type Counter byte
+
+// Agent counters.
+const (
+	// CounterAgents is count of created agents.
+	CounterAgents Counter = iota
+	// CounterChecks is count of sent connectivity checks.
+	CounterChecks
+	// CounterRetransmits is count of retransmitted binding requests.
+	CounterRetransmits
+	// CounterTimeouts is count of connectivity checks that timed out.
+	CounterTimeouts
+	// CounterRoleConflicts is count of role conflict error responses.
+	CounterRoleConflicts
+	// CounterSelectedCandidates is count of selected candidate pairs,
+	// labeled with local and remote candidate types.
+	CounterSelectedCandidates
+)
+
+var counterToStr = map[Counter]string{
+	CounterAgents:             "ice_agents_created_total",
+	CounterChecks:             "ice_checks_sent_total",
+	CounterRetransmits:        "ice_retransmits_total",
+	CounterTimeouts:           "ice_timeouts_total",
+	CounterRoleConflicts:      "ice_role_conflicts_total",
+	CounterSelectedCandidates: "ice_selected_candidates_total",
+}
+
+var counterHelp = map[Counter]string{
+	CounterAgents:             "Count of created agents.",
+	CounterChecks:             "Count of sent connectivity checks.",
+	CounterRetransmits:        "Count of retransmitted binding requests.",
+	CounterTimeouts:           "Count of connectivity checks that timed out.",
+	CounterRoleConflicts:      "Count of role conflict error responses.",
+	CounterSelectedCandidates: "Count of selected candidate pairs by candidate types.",
+}
+
+// counterLabels are label names of counters, in order of label values.
+var counterLabels = map[Counter][]string{
+	CounterSelectedCandidates: {"local", "remote"},
+}
+
+func (c Counter) String() string {
+	if s, ok := counterToStr[c]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// Histogram is aggregate agent duration histogram.
+type Histogram byte
+
+// Agent histograms.
+const (
+	// HistogramFirstValidPair is time from first connectivity check to
+	// first valid pair.
+	HistogramFirstValidPair Histogram = iota
+	// HistogramNomination is time from first connectivity check to
+	// completion of checklist.
+	HistogramNomination
+)
+
+var histogramToStr = map[Histogram]string{
+	HistogramFirstValidPair: "ice_first_valid_pair_seconds",
+	HistogramNomination:     "ice_nomination_seconds",
+}
+
+var histogramHelp = map[Histogram]string{
+	HistogramFirstValidPair: "Time from first connectivity check to first valid pair.",
+	HistogramNomination:     "Time from first connectivity check to completed checklist.",
+}
+
+func (h Histogram) String() string {
+	if s, ok := histogramToStr[h]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// Metrics is sink of aggregate agent metrics, that can be shared between
+// agents.
+//
+// Metrics is called synchronously, possibly with agent lock held, so it
+// should be safe for concurrent use and should not block.
+type Metrics interface {
+	// Inc increments counter with label values.
+	Inc(c Counter, labels ...string)
+	// Observe adds duration to histogram.
+	Observe(h Histogram, d time.Duration)
+}
+
+// DefaultBuckets are upper bounds of PrometheusMetrics histogram buckets in
+// seconds.
+var DefaultBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type histogramValues struct {
+	buckets []uint64 // cumulative counts are computed on write
+	count   uint64
+	sum     float64
+}
+
+// PrometheusMetrics is Metrics that exposes values in Prometheus text
+// exposition format.
+type PrometheusMetrics struct {
+	mux        sync.Mutex
+	buckets    []float64
+	counters   map[Counter]map[string]uint64 // by joined label values
+	histograms map[Histogram]*histogramValues
+}
+
+// NewPrometheusMetrics returns PrometheusMetrics with provided histogram
+// buckets in seconds, or DefaultBuckets if none.
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64{}, buckets...)
+	sort.Float64s(buckets)
+	return &PrometheusMetrics{
+		buckets:    buckets,
+		counters:   make(map[Counter]map[string]uint64),
+		histograms: make(map[Histogram]*histogramValues),
+	}
+}
+
+// labelSep separates label values in counter key.
+const labelSep = "\x00"
+
+// Inc implements Metrics.
+func (m *PrometheusMetrics) Inc(c Counter, labels ...string) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	values, ok := m.counters[c]
+	if !ok {
+		values = make(map[string]uint64)
+		m.counters[c] = values
+	}
+	values[strings.Join(labels, labelSep)]++
+}
+
+// Observe implements Metrics.
+func (m *PrometheusMetrics) Observe(h Histogram, d time.Duration) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	v, ok := m.histograms[h]
+	if !ok {
+		v = &histogramValues{buckets: make([]uint64, len(m.buckets))}
+		m.histograms[h] = v
+	}
+	s := d.Seconds()
+	for i, b := range m.buckets {
+		if s <= b {
+			v.buckets[i]++
+			break
+		}
+	}
+	v.count++
+	v.sum += s
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(v)
+}
+
+// formatLabels returns labels of counter sample, like {local="host"}.
+func formatLabels(names []string, key string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	values := strings.Split(key, labelSep)
+	pairs := make([]string, 0, len(names))
+	for i, name := range names {
+		var v string
+		if i < len(values) {
+			v = values[i]
+		}
+		pairs = append(pairs, name+"=\""+escapeLabel(v)+"\"")
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// WriteTo writes all metrics in Prometheus text exposition format,
+// implementing io.WriterTo.
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	b := bufio.NewWriter(cw)
+	m.mux.Lock()
+	for c := CounterAgents; c <= CounterSelectedCandidates; c++ {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s counter\n", c, counterHelp[c], c)
+		values := m.counters[c]
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if len(keys) == 0 && len(counterLabels[c]) == 0 {
+			fmt.Fprintf(b, "%s 0\n", c)
+		}
+		for _, k := range keys {
+			fmt.Fprintf(b, "%s%s %d\n", c, formatLabels(counterLabels[c], k), values[k])
+		}
+	}
+	for h := HistogramFirstValidPair; h <= HistogramNomination; h++ {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s histogram\n", h, histogramHelp[h], h)
+		v, ok := m.histograms[h]
+		if !ok {
+			v = &histogramValues{buckets: make([]uint64, len(m.buckets))}
+		}
+		var cumulative uint64
+		for i, bound := range m.buckets {
+			cumulative += v.buckets[i]
+			fmt.Fprintf(b, "%s_bucket{le=%q} %d\n", h, formatFloat(bound), cumulative)
+		}
+		fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", h, v.count)
+		fmt.Fprintf(b, "%s_sum %s\n", h, formatFloat(v.sum))
+		fmt.Fprintf(b, "%s_count %d\n", h, v.count)
+	}
+	m.mux.Unlock()
+	err := b.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP writes metrics for Prometheus scraping.
+func (m *PrometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := m.WriteTo(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// inc increments agent counter if metrics are configured.
+func (a *Agent) inc(c Counter, labels ...string) {
+	if a.metrics == nil {
+		return
+	}
+	a.metrics.Inc(c, labels...)
+}
+
+// observeSinceChecks adds duration since first connectivity check to
+// histogram if metrics are configured. Should be called with a.mux held.
+func (a *Agent) observeSinceChecks(h Histogram, now time.Time) {
+	if a.metrics == nil || a.timeline.FirstCheck.IsZero() {
+		return
+	}
+	a.metrics.Observe(h, now.Sub(a.timeline.FirstCheck))
+}
+
+// observeSelected counts candidate types of selected pair of completed
+// checklist. Should be called with a.mux held.
+func (a *Agent) observeSelected(checklist int, now time.Time) {
+	if a.metrics == nil {
+		return
+	}
+	a.observeSinceChecks(HistogramNomination, now)
+	selected, ok := selectedPair(a.set[checklist])
+	if !ok {
+		return
+	}
+	a.metrics.Inc(CounterSelectedCandidates, selected.Local.Type.String(), selected.Remote.Type.String())
+}
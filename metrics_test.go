@@ -0,0 +1,163 @@
+package ice
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/stun"
+)
+
+func TestPrometheusMetrics_WriteTo(t *testing.T) {
+	m := NewPrometheusMetrics(0.1, 0.01, 1)
+	m.Inc(CounterAgents)
+	m.Inc(CounterAgents)
+	m.Inc(CounterChecks)
+	m.Inc(CounterSelectedCandidates, "host", "srflx")
+	m.Inc(CounterSelectedCandidates, "host", "host")
+	m.Inc(CounterSelectedCandidates, "host", "host")
+	m.Observe(HistogramFirstValidPair, time.Millisecond*5)
+	m.Observe(HistogramFirstValidPair, time.Millisecond*50)
+	m.Observe(HistogramFirstValidPair, time.Second*3)
+	buf := new(bytes.Buffer)
+	n, err := m.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("unexpected written bytes: %d", n)
+	}
+	if *writeGolden {
+		f, closeF := createGolden(t, "metrics.prom")
+		defer closeF()
+		if _, err = f.Write(buf.Bytes()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, closeF := readGolden(t, "metrics.prom")
+	defer closeF()
+	expected, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("unexpected exposition:\n%s", buf)
+	}
+}
+
+func TestPrometheusMetrics_ServeHTTP(t *testing.T) {
+	m := NewPrometheusMetrics()
+	m.Inc(CounterTimeouts)
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type: %s", ct)
+	}
+	if !strings.Contains(w.Body.String(), "\nice_timeouts_total 1\n") {
+		t.Errorf("unexpected body:\n%s", w.Body)
+	}
+}
+
+func TestFormatLabels(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		names  []string
+		key    string
+		labels string
+	}{
+		{name: "None", labels: ""},
+		{name: "Single", names: []string{"a"}, key: "x", labels: `{a="x"}`},
+		{name: "Quoted", names: []string{"a"}, key: `"x"`, labels: `{a="\"x\""}`},
+		{name: "Escaped", names: []string{"a"}, key: "a\\b\"c\nd", labels: `{a="a\\b\"c\nd"}`},
+		{name: "Multiple", names: []string{"a", "b"}, key: "x" + labelSep + "y", labels: `{a="x",b="y"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := formatLabels(tc.names, tc.key); got != tc.labels {
+				t.Errorf("%s != %s", got, tc.labels)
+			}
+		})
+	}
+}
+
+func TestAgent_Metrics(t *testing.T) {
+	m := NewPrometheusMetrics()
+	concludeSession(t, []AgentOption{WithMetrics(m)}, []AgentOption{WithMetrics(m)})
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if got := m.counters[CounterAgents][""]; got != 2 {
+		t.Errorf("unexpected agents: %d", got)
+	}
+	if m.counters[CounterChecks][""] == 0 {
+		t.Error("no checks counted")
+	}
+	if m.histograms[HistogramFirstValidPair].count == 0 {
+		t.Error("no first valid pair observed")
+	}
+	if m.histograms[HistogramNomination] == nil {
+		t.Fatal("no nomination observed")
+	}
+	host := candidate.Host.String()
+	if m.counters[CounterSelectedCandidates][host+labelSep+host] == 0 {
+		t.Error("no selected candidates counted")
+	}
+}
+
+// failPacketConn is mockPacketConn that fails to write.
+type failPacketConn struct{ mockPacketConn }
+
+func (failPacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return 0, errors.New("failed")
+}
+
+func TestAgent_MetricsRetransmits(t *testing.T) {
+	m := NewPrometheusMetrics()
+	a, err := NewAgent(WithMetrics(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mustClose(t, a)
+	local := Candidate{Addr: Addr{IP: net.IPv4(10, 0, 0, 1), Port: 1000, Proto: candidate.UDP}}
+	pair := Pair{Local: local, State: PairInProgress}
+	pair.Remote.Addr = Addr{IP: net.IPv4(10, 0, 0, 2), Port: 2000, Proto: candidate.UDP}
+	a.set = ChecklistSet{{Pairs: Pairs{pair}}}
+	for _, tc := range []struct {
+		name     string
+		conn     net.PacketConn
+		expected uint64
+	}{
+		{name: "WriteFailed", conn: failPacketConn{}, expected: 0},
+		{name: "Written", conn: discardPacketConn{}, expected: 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a.localCandidates = [][]*localUDPCandidate{{{candidate: local, conn: tc.conn}}}
+			at := &agentTransaction{
+				id:          stun.NewTransactionID(),
+				rto:         time.Millisecond * 100,
+				start:       time.Now(),
+				attempt:     1,
+				maxAttempts: 2,
+				pair:        getPairKey(&pair),
+			}
+			at.setDeadline(at.start)
+			a.tMux.Lock()
+			a.t[at.id] = at
+			a.tMux.Unlock()
+			a.collect(at.deadline)
+			m.mux.Lock()
+			retransmits := m.counters[CounterRetransmits][""]
+			m.mux.Unlock()
+			stats := a.Stats()
+			if retransmits != tc.expected || stats.Pairs[0].Retransmissions != tc.expected {
+				t.Errorf("unexpected retransmits: %d (metrics), %d (stats)",
+					retransmits, stats.Pairs[0].Retransmissions,
+				)
+			}
+		})
+	}
+}
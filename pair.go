@@ -186,12 +186,10 @@ func NewPairs(local, remote Candidates) Pairs {
 			if !sameFamily(ipL, ipR) {
 				continue
 			}
-			if ipL.To4() == nil && ipL.IsLinkLocalUnicast() {
+			if ipL.To4() == nil && ipL.IsLinkLocalUnicast() != ipR.IsLinkLocalUnicast() {
 				// IPv6 link-local addresses MUST NOT be paired with other
 				// than link-local addresses.
-				if !ipR.IsLinkLocalUnicast() {
-					continue
-				}
+				continue
 			}
 			pair := Pair{
 				Local:       local[l],
@@ -247,10 +245,29 @@ func (k pairKey) Equal(p *Pair) bool {
 }
 
 func getPairKey(p *Pair) pairKey {
+	return newPairKey(p.Local.Addr, p.Remote.Addr)
+}
+
+// newPairKey returns key of pair with provided local and remote addresses.
+func newPairKey(local, remote Addr) pairKey {
 	k := pairKey{}
-	copy(k.LocalIP[:], p.Local.Addr.IP)
-	copy(k.RemoteIP[:], p.Remote.Addr.IP)
-	k.LocalPort = p.Local.Addr.Port
-	k.RemotePort = p.Remote.Addr.Port
+	copy(k.LocalIP[:], local.IP.To16())
+	copy(k.RemoteIP[:], remote.IP.To16())
+	k.LocalPort = local.Port
+	k.RemotePort = remote.Port
 	return k
 }
+
+// remoteUDPAddr returns UDP address of remote candidate, using zone of local
+// candidate for IPv6 link-local address without zone.
+func (p *Pair) remoteUDPAddr() *net.UDPAddr {
+	addr := &net.UDPAddr{
+		IP:   p.Remote.Addr.IP,
+		Port: p.Remote.Addr.Port,
+		Zone: p.Remote.Addr.Zone,
+	}
+	if addr.Zone == "" && addr.IP.To4() == nil && addr.IP.IsLinkLocalUnicast() {
+		addr.Zone = p.Local.Addr.Zone
+	}
+	return addr
+}
@@ -0,0 +1,40 @@
+package ice
+
+import (
+	"sort"
+
+	"gortc.io/ice/gather"
+)
+
+// policyPairs orders pairs like Pairs, breaking priority ties by RFC 6724
+// destination address selection rules, where local candidate address is
+// source and remote one is destination.
+type policyPairs struct {
+	Pairs
+	table gather.PolicyTable
+}
+
+func (p policyPairs) Less(i, j int) bool {
+	a, b := p.Pairs[i], p.Pairs[j]
+	if a.Priority != b.Priority {
+		return a.Priority > b.Priority
+	}
+	if a.ComponentID != b.ComponentID {
+		return a.ComponentID < b.ComponentID
+	}
+	return p.table.LessDestination(
+		gather.Destination{IP: a.Remote.Addr.IP, Source: a.Local.Addr.IP},
+		gather.Destination{IP: b.Remote.Addr.IP, Source: b.Local.Addr.IP},
+	)
+}
+
+// SortPolicy is Sort that orders pairs with equal priority by RFC 6724
+// destination address selection rules using provided policy table, so
+// address families are ordered as RFC 8421 recommends. DefaultPolicyTable
+// is used if t is nil.
+func (c *Checklist) SortPolicy(t gather.PolicyTable) {
+	if t == nil {
+		t = gather.DefaultPolicyTable
+	}
+	sort.Stable(policyPairs{Pairs: c.Pairs, table: t})
+}
@@ -0,0 +1,45 @@
+package ice
+
+import (
+	"net"
+	"testing"
+
+	"gortc.io/ice/gather"
+)
+
+func TestChecklist_SortPolicy(t *testing.T) {
+	pair := func(local, remote string) Pair {
+		return Pair{
+			Local:       Candidate{Addr: Addr{IP: net.ParseIP(local)}},
+			Remote:      Candidate{Addr: Addr{IP: net.ParseIP(remote)}},
+			ComponentID: 1,
+			Priority:    100,
+		}
+	}
+	newList := func() Checklist {
+		return Checklist{Pairs: Pairs{
+			pair("10.0.0.1", "10.0.0.2"),
+			pair("2001:db8::1", "2001:db8::2"),
+			{ComponentID: 1, Priority: 200},
+		}}
+	}
+	t.Run("Default", func(t *testing.T) {
+		c := newList()
+		c.SortPolicy(nil)
+		if c.Pairs[0].Priority != 200 {
+			t.Error("priority should be compared first")
+		}
+		if c.Pairs[1].Remote.Addr.IP.To4() != nil {
+			t.Error("IPv6 should be preferred")
+		}
+	})
+	t.Run("PreferIPv4", func(t *testing.T) {
+		table := append(gather.PolicyTable{}, gather.DefaultPolicyTable...)
+		table[2].Precedence = 100
+		c := newList()
+		c.SortPolicy(table)
+		if c.Pairs[1].Remote.Addr.IP.To4() == nil {
+			t.Error("IPv4 should be preferred")
+		}
+	})
+}
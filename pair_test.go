@@ -136,6 +136,61 @@ func TestNewPairs(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "Link-local",
+			Local: Candidates{
+				{
+					Addr: Addr{
+						IP:   net.ParseIP("fe80::1"),
+						Zone: "eth0",
+					},
+				},
+				{
+					Addr: Addr{
+						IP: net.ParseIP("2001:db8::1"),
+					},
+				},
+			},
+			Remote: Candidates{
+				{
+					Addr: Addr{
+						IP: net.ParseIP("fe80::2"),
+					},
+				},
+				{
+					Addr: Addr{
+						IP: net.ParseIP("2001:db8::2"),
+					},
+				},
+			},
+			Result: Pairs{
+				{
+					Local: Candidate{
+						Addr: Addr{
+							IP:   net.ParseIP("fe80::1"),
+							Zone: "eth0",
+						},
+					},
+					Remote: Candidate{
+						Addr: Addr{
+							IP: net.ParseIP("fe80::2"),
+						},
+					},
+				},
+				{
+					Local: Candidate{
+						Addr: Addr{
+							IP: net.ParseIP("2001:db8::1"),
+						},
+					},
+					Remote: Candidate{
+						Addr: Addr{
+							IP: net.ParseIP("2001:db8::2"),
+						},
+					},
+				},
+			},
+		},
 	} {
 		t.Run(tc.Name, func(t *testing.T) {
 			got := NewPairs(tc.Local, tc.Remote)
@@ -157,3 +212,44 @@ func TestNewPairs(t *testing.T) {
 		})
 	}
 }
+
+func TestPair_remoteUDPAddr(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		local  Addr
+		remote Addr
+		out    string
+	}{
+		{
+			name:   "IPv4",
+			local:  Addr{IP: net.IPv4(10, 0, 0, 1), Port: 1000},
+			remote: Addr{IP: net.IPv4(10, 0, 0, 2), Port: 2000},
+			out:    "10.0.0.2:2000",
+		},
+		{
+			name:   "LinkLocal",
+			local:  Addr{IP: net.ParseIP("fe80::1"), Zone: "eth0", Port: 1000},
+			remote: Addr{IP: net.ParseIP("fe80::2"), Port: 2000},
+			out:    "[fe80::2%eth0]:2000",
+		},
+		{
+			name:   "LinkLocalWithZone",
+			local:  Addr{IP: net.ParseIP("fe80::1"), Zone: "eth0", Port: 1000},
+			remote: Addr{IP: net.ParseIP("fe80::2"), Zone: "eth1", Port: 2000},
+			out:    "[fe80::2%eth1]:2000",
+		},
+		{
+			name:   "Global",
+			local:  Addr{IP: net.ParseIP("2001:db8::1"), Port: 1000},
+			remote: Addr{IP: net.ParseIP("2001:db8::2"), Port: 2000},
+			out:    "[2001:db8::2]:2000",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := Pair{Local: Candidate{Addr: tc.local}, Remote: Candidate{Addr: tc.remote}}
+			if out := p.remoteUDPAddr().String(); out != tc.out {
+				t.Errorf("%s (got) != %s (expected)", out, tc.out)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package ice
+
+import "time"
+
+// maxReportErrors is maximum count of last errors in report.
+const maxReportErrors = 32
+
+// ReportServer is ICE server in Report, without credential.
+type ReportServer struct {
+	URI      []string `json:"uri"`
+	Username string   `json:"username,omitempty"`
+}
+
+// ReportConfig is agent configuration in Report.
+type ReportConfig struct {
+	Servers         []ReportServer  `json:"servers,omitempty"`
+	Role            Role            `json:"role"`
+	Ta              time.Duration   `json:"ta"`
+	MaxChecks       int             `json:"max_checks"`
+	MaxAttempts     int             `json:"max_attempts"`
+	CandidatePolicy CandidatePolicy `json:"candidate_policy"`
+}
+
+// Report describes agent session, e.g. to be saved as JSON when session
+// ends. Candidates and selected pairs are indexed by data stream.
+type Report struct {
+	Timestamp        time.Time     `json:"timestamp"`
+	State            State         `json:"state"`
+	Config           ReportConfig  `json:"config"`
+	LocalCandidates  [][]Candidate `json:"local_candidates"`
+	RemoteCandidates [][]Candidate `json:"remote_candidates"`
+	Set              ChecklistSet  `json:"checklist_set"`
+	Selected         []*Pair       `json:"selected"` // nil if none
+	Stats            Stats         `json:"stats"`
+	Timeline         Timeline      `json:"timeline"`
+	Errors           []string      `json:"errors,omitempty"` // last errors
+}
+
+// selectedPair returns selected pair of checklist, that is nominated valid
+// pair or, if none, first valid pair.
+func selectedPair(c Checklist) (Pair, bool) {
+	if len(c.Valid) == 0 {
+		return Pair{}, false
+	}
+	for _, p := range c.Valid {
+		if p.Nominated {
+			return p, true
+		}
+	}
+	return c.Valid[0], true
+}
+
+// reportError saves error for report, keeping only last ones.
+func (a *Agent) reportError(err error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if len(a.errs) == maxReportErrors {
+		a.errs = append(a.errs[:0], a.errs[1:]...)
+	}
+	a.errs = append(a.errs, err.Error())
+}
+
+// Report returns description of agent session with configuration,
+// candidates, checklist set, selected pairs, statistics and last errors.
+// Server credentials and local candidates that are not allowed by candidate
+// policy are omitted, as in Stats.
+func (a *Agent) Report() Report {
+	stats := a.Stats()
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	r := Report{
+		Timestamp: stats.Timestamp,
+		State:     a.state,
+		Config: ReportConfig{
+			Role:            a.role,
+			Ta:              a.ta,
+			MaxChecks:       a.maxChecks,
+			MaxAttempts:     a.maxAttempts,
+			CandidatePolicy: a.candidatePolicy,
+		},
+		LocalCandidates:  make([][]Candidate, len(a.streams)),
+		RemoteCandidates: make([][]Candidate, len(a.streams)),
+		Set:              make(ChecklistSet, len(a.set)),
+		Selected:         make([]*Pair, len(a.set)),
+		Stats:            stats,
+		Timeline:         a.timeline,
+		Errors:           append([]string(nil), a.errs...),
+	}
+	for _, s := range a.servers {
+		r.Config.Servers = append(r.Config.Servers, ReportServer{URI: s.URI, Username: s.Username})
+	}
+	for streamID := range a.streams {
+		if streamID < len(a.localCandidates) {
+			r.LocalCandidates[streamID] = a.allowedCandidates(a.localCandidates[streamID])
+		}
+		if streamID < len(a.remoteCandidates) {
+			r.RemoteCandidates[streamID] = append([]Candidate(nil), a.remoteCandidates[streamID]...)
+		}
+	}
+	for i, c := range a.set {
+		r.Set[i] = Checklist{
+			Pairs:     append(Pairs(nil), c.Pairs...),
+			Valid:     append(Pairs(nil), c.Valid...),
+			Triggered: append(Pairs(nil), c.Triggered...),
+			State:     c.State,
+		}
+		if p, ok := selectedPair(c); ok {
+			r.Selected[i] = &p
+		}
+	}
+	return r
+}
@@ -0,0 +1,117 @@
+package ice
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSelectedPair(t *testing.T) {
+	first, nominated := Pair{Priority: 1}, Pair{Priority: 2, Nominated: true}
+	for _, tc := range []struct {
+		name     string
+		c        Checklist
+		selected Pair
+		ok       bool
+	}{
+		{name: "NoValid"},
+		{name: "First", c: Checklist{Valid: Pairs{first, {Priority: 3}}}, selected: first, ok: true},
+		{name: "Nominated", c: Checklist{Valid: Pairs{first, nominated}}, selected: nominated, ok: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			selected, ok := selectedPair(tc.c)
+			if ok != tc.ok || selected.Priority != tc.selected.Priority {
+				t.Errorf("unexpected selected pair: %v %v", selected, ok)
+			}
+		})
+	}
+}
+
+func TestAgent_reportError(t *testing.T) {
+	a := &Agent{}
+	for i := 0; i < maxReportErrors+2; i++ {
+		a.reportError(fmt.Errorf("error %d", i))
+	}
+	if len(a.errs) != maxReportErrors {
+		t.Fatalf("unexpected errors: %d", len(a.errs))
+	}
+	if a.errs[0] != "error 2" {
+		t.Errorf("unexpected first error: %s", a.errs[0])
+	}
+}
+
+func TestAgent_Report(t *testing.T) {
+	t.Run("Credentials", func(t *testing.T) {
+		a, err := NewAgent(WithServer(Server{
+			URI:        []string{"turn:example.com"},
+			Username:   "user",
+			Credential: "secret",
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mustClose(t, a)
+		data, err := json.Marshal(a.Report())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("secret")) {
+			t.Error("report should not contain credential")
+		}
+		if !bytes.Contains(data, []byte("turn:example.com")) {
+			t.Error("report should contain server")
+		}
+	})
+	t.Run("Session", func(t *testing.T) {
+		agents := concludeSession(t, nil, nil)
+		agents[0].reportError(errors.New("failed"))
+		r := agents[0].Report()
+		if r.State != Completed {
+			t.Errorf("unexpected state: %s", r.State)
+		}
+		if r.Config.Role != Controlling || r.Config.MaxChecks != defaultMaxChecks {
+			t.Errorf("unexpected config: %+v", r.Config)
+		}
+		if len(r.LocalCandidates) != 1 || len(r.LocalCandidates[0]) != 1 {
+			t.Errorf("unexpected local candidates: %v", r.LocalCandidates)
+		}
+		if len(r.RemoteCandidates) != 1 || len(r.RemoteCandidates[0]) != 1 {
+			t.Errorf("unexpected remote candidates: %v", r.RemoteCandidates)
+		}
+		if len(r.Selected) != 1 || r.Selected[0] == nil {
+			t.Fatalf("unexpected selected pairs: %v", r.Selected)
+		}
+		if !r.Selected[0].Remote.Addr.Equal(r.RemoteCandidates[0][0].Addr) {
+			t.Errorf("unexpected selected pair: %+v", r.Selected[0])
+		}
+		if len(r.Stats.Pairs) == 0 || r.Timeline.Completed.IsZero() {
+			t.Error("report should contain stats and timeline")
+		}
+		if len(r.Errors) != 1 || r.Errors[0] != "failed" {
+			t.Errorf("unexpected errors: %v", r.Errors)
+		}
+		data, err := json.Marshal(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []string{`"checklist_set"`, `"selected"`, `"stats"`, `"timeline"`} {
+			if !strings.Contains(string(data), key) {
+				t.Errorf("no %s in report", key)
+			}
+		}
+		var decoded Report
+		if err = json.Unmarshal(data, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		redata, err := json.Marshal(decoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, redata) {
+			t.Errorf("report changed after decoding:\n%s\n%s", data, redata)
+		}
+	})
+}
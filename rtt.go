@@ -0,0 +1,75 @@
+package ice
+
+import "time"
+
+// rttEstimator estimates round trip time of candidate pair from check
+// samples as defined by RFC 6298 Section 2.
+type rttEstimator struct {
+	srtt    time.Duration // smoothed round trip time
+	rttvar  time.Duration // round trip time variation
+	samples int
+}
+
+// RFC 6298 constants, alpha = 1/rttAlpha and beta = 1/rttBeta.
+const (
+	rttAlpha = 8
+	rttBeta  = 4
+	rttK     = 4
+)
+
+// update adds round trip time sample r.
+func (e *rttEstimator) update(r time.Duration) {
+	if e.samples == 0 {
+		e.srtt = r
+		e.rttvar = r / 2
+	} else {
+		d := e.srtt - r
+		if d < 0 {
+			d = -d
+		}
+		e.rttvar += (d - e.rttvar) / rttBeta
+		e.srtt += (r - e.srtt) / rttAlpha
+	}
+	e.samples++
+}
+
+// rto returns retransmission timeout that is not less than min, or false
+// if there are no samples.
+func (e *rttEstimator) rto(min time.Duration) (time.Duration, bool) {
+	if e.samples == 0 {
+		return 0, false
+	}
+	rto := e.srtt + rttK*e.rttvar
+	if rto < min {
+		rto = min
+	}
+	return rto, true
+}
+
+// pairRTO returns retransmission timeout for check of pair, estimated from
+// round trip time of previous checks or by rto if there are none.
+func (a *Agent) pairRTO(k pairKey) time.Duration {
+	a.statsMux.Lock()
+	c, ok := a.stats[k]
+	var rto time.Duration
+	if ok {
+		rto, ok = c.rtt.rto(minRTO)
+	}
+	a.statsMux.Unlock()
+	if !ok {
+		return a.rto()
+	}
+	return rto
+}
+
+// smoothedRTT returns smoothed round trip time of pair or false if it is
+// not measured. Should be called with a.mux held.
+func (a *Agent) smoothedRTT(p *Pair) (time.Duration, bool) {
+	a.statsMux.Lock()
+	defer a.statsMux.Unlock()
+	c, ok := a.stats[getPairKey(p)]
+	if !ok || c.rtt.samples == 0 {
+		return 0, false
+	}
+	return c.rtt.srtt, true
+}
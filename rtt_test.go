@@ -0,0 +1,96 @@
+package ice
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestRTTEstimator(t *testing.T) {
+	var e rttEstimator
+	if _, ok := e.rto(minRTO); ok {
+		t.Error("rto should not be estimated without samples")
+	}
+	e.update(time.Millisecond * 100)
+	if e.srtt != time.Millisecond*100 || e.rttvar != time.Millisecond*50 {
+		t.Errorf("unexpected first sample estimation: %s %s", e.srtt, e.rttvar)
+	}
+	if rto, _ := e.rto(0); rto != time.Millisecond*300 {
+		t.Errorf("unexpected rto %s", rto)
+	}
+	if rto, _ := e.rto(minRTO); rto != minRTO {
+		t.Errorf("rto %s should not be less than minimum", rto)
+	}
+	e.update(time.Millisecond * 200)
+	// RTTVAR = 3/4 * 50ms + 1/4 * |100ms - 200ms|
+	// SRTT = 7/8 * 100ms + 1/8 * 200ms
+	if e.rttvar != time.Microsecond*62500 || e.srtt != time.Microsecond*112500 {
+		t.Errorf("unexpected estimation: %s %s", e.srtt, e.rttvar)
+	}
+	if rto, _ := e.rto(0); rto != time.Microsecond*362500 {
+		t.Errorf("unexpected rto %s", rto)
+	}
+}
+
+func TestAgent_pairRTO(t *testing.T) {
+	a := &Agent{ta: defaultAgentTa}
+	k := pairKey{LocalPort: 1, RemotePort: 2}
+	if rto := a.pairRTO(k); rto != minRTO {
+		t.Errorf("unexpected default rto %s", rto)
+	}
+	now := time.Now()
+	// Retransmitted check is ignored.
+	a.countResponse(&agentTransaction{pair: k, attempt: 2, start: now.Add(-time.Second)}, now)
+	if rto := a.pairRTO(k); rto != minRTO {
+		t.Errorf("unexpected rto %s after ambiguous sample", rto)
+	}
+	a.countResponse(&agentTransaction{pair: k, attempt: 1, start: now.Add(-time.Second)}, now)
+	if rto := a.pairRTO(k); rto != time.Second*3 {
+		t.Errorf("unexpected rto %s", rto)
+	}
+}
+
+func TestAgent_startNomination(t *testing.T) {
+	pair := func(port int) Pair {
+		return Pair{
+			Local:       Candidate{Addr: Addr{IP: net.IPv4(10, 0, 0, 1), Port: port}},
+			Remote:      Candidate{Addr: Addr{IP: net.IPv4(10, 0, 0, 2), Port: port}},
+			ComponentID: 1,
+		}
+	}
+	now := time.Now()
+	for _, tc := range []struct {
+		name     string
+		rtt      map[int]time.Duration // by port
+		expected int                   // port
+	}{
+		{name: "NoRTT", expected: 1},
+		{name: "Measured", rtt: map[int]time.Duration{3: time.Millisecond}, expected: 3},
+		{
+			name:     "LeastRTT",
+			rtt:      map[int]time.Duration{1: time.Millisecond * 30, 2: time.Millisecond * 10, 3: time.Millisecond * 20},
+			expected: 2,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &Agent{log: zap.NewNop()}
+			a.set = ChecklistSet{{Valid: Pairs{pair(1), pair(2), pair(3)}}}
+			for port, rtt := range tc.rtt {
+				p := pair(port)
+				a.countResponse(&agentTransaction{pair: getPairKey(&p), attempt: 1, start: now.Add(-rtt)}, now)
+			}
+			if err := a.startNomination(0); err != nil {
+				t.Fatal(err)
+			}
+			triggered := a.set[0].Triggered
+			if len(triggered) != 1 || !triggered[0].Nominated {
+				t.Fatalf("unexpected triggered pairs: %v", triggered)
+			}
+			if port := triggered[0].Local.Addr.Port; port != tc.expected {
+				t.Errorf("nominated %d (got) != %d (expected)", port, tc.expected)
+			}
+		})
+	}
+}
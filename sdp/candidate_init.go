@@ -0,0 +1,74 @@
+package sdp
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// Errors that are returned for CandidateInit.
+var (
+	ErrEndOfCandidates = errors.New("end of candidates")
+	ErrMissingMid      = errors.New("both sdpMid and sdpMLineIndex are null")
+)
+
+// CandidateInit is ICE candidate in JSON format of WebRTC RTCIceCandidateInit
+// dictionary, as used by signaling for trickle ICE.
+//
+// Blank Candidate indicates end of candidates for the media stream that is
+// identified by SDPMid or SDPMLineIndex.
+//
+// See https://www.w3.org/TR/webrtc/#dom-rtcicecandidateinit.
+type CandidateInit struct {
+	Candidate        string  `json:"candidate"`
+	SDPMid           *string `json:"sdpMid"`
+	SDPMLineIndex    *uint16 `json:"sdpMLineIndex"`
+	UsernameFragment *string `json:"usernameFragment"`
+}
+
+// NewCandidateInit returns CandidateInit for candidate of media stream with
+// provided mid and m-line index.
+func NewCandidateInit(c Candidate, mid string, mLineIndex uint16) CandidateInit {
+	i := EndOfCandidatesInit(mid, mLineIndex)
+	i.Candidate = "candidate:" + c.String()
+	return i
+}
+
+// EndOfCandidatesInit returns CandidateInit that indicates end of candidates
+// for media stream with provided mid and m-line index.
+func EndOfCandidatesInit(mid string, mLineIndex uint16) CandidateInit {
+	return CandidateInit{
+		SDPMid:        &mid,
+		SDPMLineIndex: &mLineIndex,
+	}
+}
+
+// EndOfCandidates reports whether i indicates end of candidates.
+func (i CandidateInit) EndOfCandidates() bool {
+	return i.Candidate == ""
+}
+
+// Parse parses candidate attribute into c, returning ErrEndOfCandidates if i
+// indicates end of candidates.
+func (i CandidateInit) Parse(c *Candidate) error {
+	if i.EndOfCandidates() {
+		return ErrEndOfCandidates
+	}
+	return ParseAttribute([]byte(i.Candidate), c)
+}
+
+// candidateInit is CandidateInit without custom unmarshaler.
+type candidateInit CandidateInit
+
+// UnmarshalJSON implements json.Unmarshaler, returning ErrMissingMid for
+// candidate without both sdpMid and sdpMLineIndex, like browsers do.
+func (i *CandidateInit) UnmarshalJSON(b []byte) error {
+	var v candidateInit
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v.Candidate != "" && v.SDPMid == nil && v.SDPMLineIndex == nil {
+		return ErrMissingMid
+	}
+	*i = CandidateInit(v)
+	return nil
+}
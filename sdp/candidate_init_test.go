@@ -0,0 +1,102 @@
+package sdp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gortc.io/ice/candidate"
+)
+
+func TestCandidateInit(t *testing.T) {
+	t.Run("Browser", func(t *testing.T) {
+		// Result of JSON.stringify(event.candidate) in Chrome.
+		in := `{"candidate":"candidate:842163049 1 udp 1677729535 91.225.236.99 51941 typ srflx raddr 10.1.22.220 rport 51940 generation 0 ufrag Vh3j network-cost 999","sdpMid":"0","sdpMLineIndex":0,"usernameFragment":"Vh3j"}`
+		var i CandidateInit
+		if err := json.Unmarshal([]byte(in), &i); err != nil {
+			t.Fatal(err)
+		}
+		if i.SDPMid == nil || *i.SDPMid != "0" {
+			t.Error("unexpected sdpMid")
+		}
+		if i.SDPMLineIndex == nil || *i.SDPMLineIndex != 0 {
+			t.Error("unexpected sdpMLineIndex")
+		}
+		if i.UsernameFragment == nil || *i.UsernameFragment != "Vh3j" {
+			t.Error("unexpected usernameFragment")
+		}
+		if i.EndOfCandidates() {
+			t.Error("unexpected end of candidates")
+		}
+		var c Candidate
+		if err := i.Parse(&c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Type != candidate.ServerReflexive || c.RelatedPort != 51940 {
+			t.Errorf("unexpected candidate %s", c)
+		}
+	})
+	t.Run("RoundTrip", func(t *testing.T) {
+		c := Candidate{
+			ConnectionAddress: Address{
+				Type: AddressFQDN,
+				Host: []byte("1e5a7f0a-6b52-4e43-9c4f-4b3b0c1d8a9e.local"),
+			},
+			Type:        candidate.Host,
+			Transport:   candidate.UDP,
+			ComponentID: 1,
+			Port:        5000,
+			Foundation:  3862931549,
+			Priority:    2113937151,
+		}
+		b, err := json.Marshal(NewCandidateInit(c, "audio", 1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var i CandidateInit
+		if err = json.Unmarshal(b, &i); err != nil {
+			t.Fatal(err)
+		}
+		if *i.SDPMid != "audio" || *i.SDPMLineIndex != 1 {
+			t.Errorf("unexpected mid in %s", b)
+		}
+		var parsed Candidate
+		if err = i.Parse(&parsed); err != nil {
+			t.Fatal(err)
+		}
+		if !parsed.Equal(&c) {
+			t.Errorf("%s (parsed) != %s (expected)", parsed, c)
+		}
+	})
+	t.Run("EndOfCandidates", func(t *testing.T) {
+		b, err := json.Marshal(EndOfCandidatesInit("0", 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != `{"candidate":"","sdpMid":"0","sdpMLineIndex":0,"usernameFragment":null}` {
+			t.Errorf("unexpected JSON %s", b)
+		}
+		var i CandidateInit
+		if err = json.Unmarshal(b, &i); err != nil {
+			t.Fatal(err)
+		}
+		if !i.EndOfCandidates() {
+			t.Error("should be end of candidates")
+		}
+		if err = i.Parse(new(Candidate)); err != ErrEndOfCandidates {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("MissingMid", func(t *testing.T) {
+		in := `{"candidate":"candidate:1 1 udp 2113937151 10.0.0.1 5000 typ host"}`
+		var i CandidateInit
+		if err := json.Unmarshal([]byte(in), &i); err != ErrMissingMid {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+	t.Run("Malformed", func(t *testing.T) {
+		var i CandidateInit
+		if err := json.Unmarshal([]byte(`{"candidate":1}`), &i); err == nil {
+			t.Error("should error")
+		}
+	})
+}
@@ -72,6 +72,11 @@ func (a Address) Equal(b Address) bool {
 	}
 }
 
+// blank reports whether address is not set.
+func (a Address) blank() bool {
+	return len(a.IP) == 0 && len(a.Host) == 0
+}
+
 func (a Address) str() string {
 	switch a.Type {
 	case AddressFQDN:
@@ -159,8 +164,14 @@ func (c Candidate) String() string {
 		c.ConnectionAddress.String(),
 		strconv.Itoa(c.Port),
 		aType, typToStr(c.Type),
-		aGeneration, strconv.Itoa(c.Generation),
 	}
+	if c.Type != ct.Host && !c.RelatedAddress.blank() {
+		parts = append(parts,
+			aRelatedAddress, c.RelatedAddress.String(),
+			aRelatedPort, strconv.Itoa(c.RelatedPort),
+		)
+	}
+	parts = append(parts, aGeneration, strconv.Itoa(c.Generation))
 	if c.NetworkCost > 0 {
 		parts = append(parts, aNetworkCost, strconv.Itoa(c.NetworkCost))
 	}
@@ -281,8 +292,11 @@ func (a Attribute) String() string {
 //  conn. address -------------------------------┘         |
 //           port -----------------------------------------┘
 type candidateParser struct {
-	buf []byte
-	c   *Candidate
+	buf    []byte
+	c      *Candidate
+	strict bool
+	offset int // count of bytes trimmed from the start of input
+	seen   seenAttributes
 }
 
 const sp = ' '
@@ -310,7 +324,7 @@ func (p *candidateParser) parseComponentID(v []byte) error {
 		return fmt.Errorf("failed to parse component ID: %v", err)
 	}
 	p.c.ComponentID = i
-	return nil
+	return p.checkRange(i, minComponentID, maxComponentID, ErrComponentIDRange)
 }
 
 func (p *candidateParser) parsePriority(v []byte) error {
@@ -319,7 +333,7 @@ func (p *candidateParser) parsePriority(v []byte) error {
 		return fmt.Errorf("failed to parse priority: %v", err)
 	}
 	p.c.Priority = i
-	return nil
+	return p.checkRange(i, minPriority, maxPriority, ErrPriorityRange)
 }
 
 func (p *candidateParser) parsePort(v []byte) error {
@@ -328,7 +342,7 @@ func (p *candidateParser) parsePort(v []byte) error {
 		return fmt.Errorf("failed to parse port: %v", err)
 	}
 	p.c.Port = i
-	return nil
+	return p.checkRange(i, 0, maxPort, ErrPortRange)
 }
 
 func (p *candidateParser) parseRelatedPort(v []byte) error {
@@ -337,7 +351,7 @@ func (p *candidateParser) parseRelatedPort(v []byte) error {
 		return fmt.Errorf("failed to parse port: %v", err)
 	}
 	p.c.RelatedPort = i
-	return nil
+	return p.checkRange(i, 0, maxPort, ErrPortRange)
 }
 
 // b2s converts byte slice to a string without memory allocation.
@@ -401,10 +415,13 @@ func (p *candidateParser) parseAttribute(a Attribute) error {
 	case aNetworkCost:
 		return p.parseNetworkCost(a.Value)
 	case aType:
+		p.seen.typ = true
 		return p.parseType(a.Value)
 	case aRelatedAddress:
+		p.seen.relatedAddress = true
 		return p.parseRelatedAddress(a.Value)
 	case aRelatedPort:
+		p.seen.relatedPort = true
 		return p.parseRelatedPort(a.Value)
 	default:
 		p.c.Attributes = append(p.c.Attributes, a)
@@ -420,16 +437,22 @@ const minBufLen = 10
 //
 //nolint:gocognit,funlen // TODO: simplify
 func (p *candidateParser) parse() error {
-	if len(p.buf) < minBufLen {
+	if len(p.buf) == 0 && p.strict {
+		return p.newError(0, mandatoryFields[0], ErrMissingElement)
+	}
+	if len(p.buf) < minBufLen && !p.strict {
+		// Strict parser reports first missing element instead.
 		return fmt.Errorf("buffer too small (%d < %d)", len(p.buf), minBufLen)
 	}
 	// special cases for raw value support:
+	n := len(p.buf)
 	if p.buf[0] == 'a' {
 		p.buf = bytes.TrimPrefix(p.buf, []byte("a="))
 	}
-	if p.buf[0] == 'c' {
+	if len(p.buf) > 0 && p.buf[0] == 'c' {
 		p.buf = bytes.TrimPrefix(p.buf, []byte("candidate:"))
 	}
+	p.offset = n - len(p.buf)
 	// pos is current position
 	// l is value length
 	// last is last character offset
@@ -456,6 +479,9 @@ func (p *candidateParser) parse() error {
 		}
 		// space character reached
 		if err := fns[pos](p.buf[i-l : i]); err != nil {
+			if p.strict {
+				return p.newError(i-l, mandatoryFields[pos], err)
+			}
 			return fmt.Errorf("failed to parse char %d, pos %d: %v",
 				i, pos, err,
 			)
@@ -465,7 +491,21 @@ func (p *candidateParser) parse() error {
 	}
 	if last == 0 {
 		// no non-mandatory elements
-		return nil
+		if !p.strict {
+			return nil
+		}
+		if l > 0 {
+			// Last element is not terminated by space.
+			i := len(p.buf)
+			if err := fns[pos](p.buf[i-l : i]); err != nil {
+				return p.newError(i-l, mandatoryFields[pos], err)
+			}
+			pos++
+		}
+		if pos < mandatoryElements {
+			return p.newError(len(p.buf), mandatoryFields[pos], ErrMissingElement)
+		}
+		return p.validate()
 	}
 	// offsets:
 	var (
@@ -514,6 +554,9 @@ func (p *candidateParser) parse() error {
 			Value: buf[vStart:i],
 		}
 		if err := p.parseAttribute(a); err != nil {
+			if p.strict {
+				return p.newError(last-1+vStart, string(a.Key), err)
+			}
 			return fmt.Errorf("failed to parse attribute at char %d: %v",
 				i+last, err,
 			)
@@ -523,6 +566,12 @@ func (p *candidateParser) parse() error {
 		end = 0
 		start = 0
 	}
+	if p.strict {
+		if err := p.parseLastAttribute(buf, start, end, last-1); err != nil {
+			return err
+		}
+		return p.validate()
+	}
 	return nil
 }
 
@@ -555,12 +604,19 @@ func (p *candidateParser) parseType(v []byte) error {
 	case sdpCandidateServerReflexive:
 		p.c.Type = ct.ServerReflexive
 	default:
+		if p.strict {
+			return ErrUnknownType
+		}
 		return fmt.Errorf("unknown candidate %q", v)
 	}
 	return nil
 }
 
 // ParseAttribute parses v into ct and returns error if any.
+//
+// The parsing is lenient: missing or malformed optional parts are ignored
+// where possible to interoperate with implementations that produce sloppy
+// candidates. Use ParseAttributeStrict for validation.
 func ParseAttribute(v []byte, c *Candidate) error {
 	p := candidateParser{
 		buf: v,
@@ -569,3 +625,15 @@ func ParseAttribute(v []byte, c *Candidate) error {
 	err := p.parse()
 	return err
 }
+
+// ParseAttributeStrict parses v into c like ParseAttribute, but also validates
+// the candidate against the grammar from Section 5.1 of ice-sip-sdp. The
+// returned error, if any, is *ParseError.
+func ParseAttributeStrict(v []byte, c *Candidate) error {
+	p := candidateParser{
+		buf:    v,
+		c:      c,
+		strict: true,
+	}
+	return p.parse()
+}
@@ -323,6 +323,27 @@ func TestCandidate_String(t *testing.T) {
 				NetworkCost: 999,
 			},
 		},
+		{
+			Name: "related address",
+			Out:  "842163049 1 udp 1677729535 91.225.236.99 51941 typ srflx raddr 10.1.22.220 rport 51940 generation 0",
+			In: Candidate{
+				ConnectionAddress: Address{
+					Type: AddressIPv4,
+					IP:   net.IPv4(91, 225, 236, 99),
+				},
+				RelatedAddress: Address{
+					Type: AddressIPv4,
+					IP:   net.IPv4(10, 1, 22, 220),
+				},
+				Type:        candidate.ServerReflexive,
+				Transport:   candidate.UDP,
+				ComponentID: 1,
+				Port:        51941,
+				RelatedPort: 51940,
+				Foundation:  842163049,
+				Priority:    1677729535,
+			},
+		},
 	} {
 		t.Run(tc.Name, func(t *testing.T) {
 			if out := tc.In.String(); out != tc.Out {
@@ -0,0 +1,121 @@
+package sdp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	ct "gortc.io/ice/candidate"
+)
+
+// Errors that are returned as ParseError.Err by ParseAttributeStrict.
+var (
+	ErrMissingElement        = errors.New("mandatory element is missing")
+	ErrMissingValue          = errors.New("attribute value is missing")
+	ErrMissingType           = errors.New("candidate type is missing")
+	ErrUnknownType           = errors.New("unknown candidate type")
+	ErrComponentIDRange      = errors.New("component ID is out of range")
+	ErrPriorityRange         = errors.New("priority is out of range")
+	ErrPortRange             = errors.New("port is out of range")
+	ErrMissingRelatedAddress = errors.New("related address is missing")
+	ErrMissingRelatedPort    = errors.New("related port is missing")
+)
+
+// ParseError describes candidate attribute that failed strict validation.
+type ParseError struct {
+	Offset int    // byte offset in input
+	Field  string // name of element or attribute key
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("invalid candidate %s at offset %d: %v", e.Field, e.Offset, e.Err)
+}
+
+// Names of mandatory elements in order of appearance.
+var mandatoryFields = [mandatoryElements]string{
+	"foundation",
+	"component-id",
+	"transport",
+	"priority",
+	"connection-address",
+	"port",
+}
+
+// Limits from Section 5.1 of ice-sip-sdp and RFC 8445 Section 5.1.2.1.
+const (
+	minComponentID = 1
+	maxComponentID = 256
+	minPriority    = 1
+	maxPriority    = 1<<31 - 1
+	maxPort        = 65535
+)
+
+// seenAttributes tracks attributes that are subject of strict validation.
+type seenAttributes struct {
+	typ            bool
+	relatedAddress bool
+	relatedPort    bool
+}
+
+// newError returns *ParseError with offset relative to the original input.
+func (p *candidateParser) newError(offset int, field string, err error) error {
+	return &ParseError{
+		Offset: p.offset + offset,
+		Field:  field,
+		Err:    err,
+	}
+}
+
+// parseLastAttribute handles attribute that was not saved by parse because of
+// reaching end of buf, where start and end are key offsets and bufOffset is
+// offset of buf in parser buffer.
+func (p *candidateParser) parseLastAttribute(buf []byte, start, end, bufOffset int) error {
+	if start == 0 {
+		// All attributes are saved.
+		return nil
+	}
+	last := len(buf) - 1
+	if end < last && buf[last] != sp {
+		// Single character value at the end of buffer.
+		a := Attribute{
+			Key:   buf[start:end],
+			Value: buf[last:],
+		}
+		if err := p.parseAttribute(a); err != nil {
+			return p.newError(bufOffset+last, string(a.Key), err)
+		}
+		return nil
+	}
+	key := bytes.TrimRight(buf[start:], " ")
+	return p.newError(bufOffset+start, string(key), ErrMissingValue)
+}
+
+// validate checks presence of attributes that are mandatory for the
+// candidate type.
+func (p *candidateParser) validate() error {
+	if !p.seen.typ {
+		return p.newError(len(p.buf), aType, ErrMissingType)
+	}
+	switch p.c.Type {
+	case ct.ServerReflexive, ct.PeerReflexive, ct.Relayed:
+		if !p.seen.relatedAddress {
+			return p.newError(len(p.buf), aRelatedAddress, ErrMissingRelatedAddress)
+		}
+		if !p.seen.relatedPort {
+			return p.newError(len(p.buf), aRelatedPort, ErrMissingRelatedPort)
+		}
+	}
+	return nil
+}
+
+// checkRange returns err if strict parser got v out of [lo, hi] range.
+func (p *candidateParser) checkRange(v, lo, hi int, err error) error {
+	if !p.strict {
+		return nil
+	}
+	if v < lo || v > hi {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package sdp
+
+import (
+	"testing"
+
+	"gortc.io/ice/candidate"
+)
+
+func TestParseAttributeStrict(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		in     string
+		field  string
+		offset int
+		err    error
+	}{
+		{
+			name:   "Empty",
+			in:     "",
+			field:  "foundation",
+			offset: 0,
+			err:    ErrMissingElement,
+		},
+		{
+			name:   "PrefixOnly",
+			in:     "a=candidate:",
+			field:  "foundation",
+			offset: 12,
+			err:    ErrMissingElement,
+		},
+		{
+			name:   "Short",
+			in:     "1 1 udp",
+			field:  "priority",
+			offset: 7,
+			err:    ErrMissingElement,
+		},
+		{
+			name:   "ShortComponentID",
+			in:     "1 1",
+			field:  "transport",
+			offset: 3,
+			err:    ErrMissingElement,
+		},
+		{
+			name:   "NoPort",
+			in:     "candidate:1 1 udp 2113937151 10.0.0.1",
+			field:  "port",
+			offset: 37,
+			err:    ErrMissingElement,
+		},
+		{
+			name:   "NoType",
+			in:     "a=candidate:1 1 udp 2113937151 10.0.0.1 5000",
+			field:  "typ",
+			offset: 44,
+			err:    ErrMissingType,
+		},
+		{
+			name:   "UnknownType",
+			in:     "1 1 udp 2113937151 10.0.0.1 5000 typ foo generation 0",
+			field:  "typ",
+			offset: 37,
+			err:    ErrUnknownType,
+		},
+		{
+			name:   "ComponentID",
+			in:     "1 257 udp 2113937151 10.0.0.1 5000 typ host",
+			field:  "component-id",
+			offset: 2,
+			err:    ErrComponentIDRange,
+		},
+		{
+			name:   "ComponentIDZero",
+			in:     "candidate:1 0 udp 2113937151 10.0.0.1 5000 typ host",
+			field:  "component-id",
+			offset: 12,
+			err:    ErrComponentIDRange,
+		},
+		{
+			name:   "Priority",
+			in:     "1 1 udp 2147483648 10.0.0.1 5000 typ host",
+			field:  "priority",
+			offset: 8,
+			err:    ErrPriorityRange,
+		},
+		{
+			name:   "Port",
+			in:     "1 1 udp 2113937151 10.0.0.1 65536 typ host",
+			field:  "port",
+			offset: 28,
+			err:    ErrPortRange,
+		},
+		{
+			name:   "RelatedAddress",
+			in:     "1 1 udp 1677729535 213.141.156.236 55726 typ srflx generation 0",
+			field:  "raddr",
+			offset: 63,
+			err:    ErrMissingRelatedAddress,
+		},
+		{
+			name:   "RelatedPort",
+			in:     "1 1 udp 1677729535 213.141.156.236 55726 typ relay raddr 10.0.0.1 generation 0",
+			field:  "rport",
+			offset: 78,
+			err:    ErrMissingRelatedPort,
+		},
+		{
+			name:   "RelatedPortRange",
+			in:     "1 1 udp 1677729535 213.141.156.236 55726 typ relay raddr 10.0.0.1 rport 70000 generation 0",
+			field:  "rport",
+			offset: 72,
+			err:    ErrPortRange,
+		},
+		{
+			name:   "MissingValue",
+			in:     "1 1 udp 2113937151 10.0.0.1 5000 typ host generation",
+			field:  "generation",
+			offset: 42,
+			err:    ErrMissingValue,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ParseAttributeStrict([]byte(tc.in), new(Candidate))
+			parseErr, ok := err.(*ParseError)
+			if !ok {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if parseErr.Err != tc.err {
+				t.Errorf("unexpected reason %v", parseErr.Err)
+			}
+			if parseErr.Field != tc.field {
+				t.Errorf("unexpected field %q", parseErr.Field)
+			}
+			if parseErr.Offset != tc.offset {
+				t.Errorf("unexpected offset %d", parseErr.Offset)
+			}
+			t.Log(err)
+		})
+	}
+	t.Run("Valid", func(t *testing.T) {
+		for _, in := range []string{
+			"a=candidate:3862931549 1 udp 2113937151 192.168.220.128 56032 typ host generation 0 network-cost 50",
+			"842163049 2 udp 1677729534 91.225.236.99 51941 typ srflx raddr 10.1.22.220 rport 51941 generation 0",
+			"842163049 1 udp 1677729535 b2.cydev.ru 56024 typ srflx raddr 10.1.22.220 rport 56024",
+		} {
+			c := new(Candidate)
+			if err := ParseAttributeStrict([]byte(in), c); err != nil {
+				t.Errorf("%q: %v", in, err)
+			}
+		}
+	})
+	t.Run("Lenient", func(t *testing.T) {
+		c := new(Candidate)
+		in := "1 1 udp 1677729535 213.141.156.236 55726 typ srflx generation 0"
+		if err := ParseAttribute([]byte(in), c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Type != candidate.ServerReflexive {
+			t.Error("unexpected type")
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package ice
+
+import (
+	"time"
+
+	ct "gortc.io/ice/candidate"
+)
+
+// PhaseTiming is start and end of connection setup phase that can run
+// multiple times, e.g. gathering for every data stream, spanning from
+// earliest start to latest end.
+type PhaseTiming struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Duration returns duration of phase or zero if phase is not finished.
+func (p PhaseTiming) Duration() time.Duration {
+	if p.Start.IsZero() || p.End.IsZero() {
+		return 0
+	}
+	return p.End.Sub(p.Start)
+}
+
+func (p *PhaseTiming) add(start, end time.Time) {
+	if p.Start.IsZero() || start.Before(p.Start) {
+		p.Start = start
+	}
+	if end.After(p.End) {
+		p.End = end
+	}
+}
+
+// Timeline is timestamps of connection setup phases. Timestamp is zero if
+// phase did not happen.
+type Timeline struct {
+	// Gathering of candidates by type.
+	Host            PhaseTiming `json:"host"`
+	ServerReflexive PhaseTiming `json:"server_reflexive"`
+	Relayed         PhaseTiming `json:"relayed"`
+
+	ChecklistPrepared time.Time `json:"checklist_prepared"`
+	FirstCheck        time.Time `json:"first_check"`
+	FirstSuccess      time.Time `json:"first_success"` // first valid pair
+	Nomination        time.Time `json:"nomination"`    // first nominated pair
+	Completed         time.Time `json:"completed"`     // all checklists completed
+}
+
+// TimeToConnect returns duration from start of gathering to completion of
+// all checklists or zero if agent is not completed.
+func (t Timeline) TimeToConnect() time.Duration {
+	if t.Host.Start.IsZero() || t.Completed.IsZero() {
+		return 0
+	}
+	return t.Completed.Sub(t.Host.Start)
+}
+
+// Timeline returns timestamps of connection setup phases, which are
+// complete after Conclude.
+func (a *Agent) Timeline() Timeline {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.timeline
+}
+
+// markOnce sets timestamp of phase if it is not set yet.
+func markOnce(t *time.Time, now time.Time) {
+	if t.IsZero() {
+		*t = now
+	}
+}
+
+// timeGathering adds gathering of candidates with provided type to
+// timeline.
+func (a *Agent) timeGathering(t ct.Type, start time.Time) {
+	end := a.clock()
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	switch t {
+	case ct.Host:
+		a.timeline.Host.add(start, end)
+	case ct.ServerReflexive:
+		a.timeline.ServerReflexive.add(start, end)
+	case ct.Relayed:
+		a.timeline.Relayed.add(start, end)
+	}
+}
@@ -0,0 +1,60 @@
+package ice
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPhaseTiming(t *testing.T) {
+	var (
+		p   PhaseTiming
+		now = time.Now()
+	)
+	if p.Duration() != 0 {
+		t.Error("duration of empty phase should be zero")
+	}
+	p.add(now.Add(time.Second), now.Add(time.Second*2))
+	p.add(now, now.Add(time.Second))
+	p.add(now.Add(time.Second), now.Add(time.Second*3))
+	if !p.Start.Equal(now) {
+		t.Error("start should be earliest")
+	}
+	if p.Duration() != time.Second*3 {
+		t.Errorf("unexpected duration: %s", p.Duration())
+	}
+}
+
+func TestAgent_Timeline(t *testing.T) {
+	agents := concludeSession(t, nil, nil)
+	tl := agents[0].Timeline()
+	for _, phase := range []struct {
+		name string
+		t    time.Time
+	}{
+		{"host start", tl.Host.Start},
+		{"host end", tl.Host.End},
+		{"checklist prepared", tl.ChecklistPrepared},
+		{"first check", tl.FirstCheck},
+		{"first success", tl.FirstSuccess},
+		{"completed", tl.Completed},
+	} {
+		if phase.t.IsZero() {
+			t.Errorf("%s: not set", phase.name)
+		}
+	}
+	if tl.ChecklistPrepared.Before(tl.Host.End) {
+		t.Error("checklist should be prepared after gathering")
+	}
+	if tl.FirstSuccess.Before(tl.FirstCheck) {
+		t.Error("first success should be after first check")
+	}
+	if !tl.ServerReflexive.Start.IsZero() || !tl.Relayed.Start.IsZero() {
+		t.Error("no server reflexive or relayed candidates should be gathered")
+	}
+	if tl.TimeToConnect() <= 0 {
+		t.Errorf("unexpected time to connect: %s", tl.TimeToConnect())
+	}
+	if (Timeline{}).TimeToConnect() != 0 {
+		t.Error("time to connect of empty timeline should be zero")
+	}
+}
@@ -0,0 +1,298 @@
+package ice
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	ct "gortc.io/ice/candidate"
+	"gortc.io/stun"
+)
+
+// TraceEventType is type of traced agent event.
+type TraceEventType byte
+
+// Traced agent events.
+const (
+	// TraceGatherStart is start of candidate gathering for data stream.
+	TraceGatherStart TraceEventType = iota
+	// TraceGatherFinish is end of candidate gathering for data stream.
+	TraceGatherFinish
+	// TraceCheckSent is binding request of connectivity check that is sent.
+	TraceCheckSent
+	// TraceRetransmit is retransmission of binding request.
+	TraceRetransmit
+	// TraceResponse is binding response to connectivity check.
+	TraceResponse
+	// TracePairState is change of candidate pair state.
+	TracePairState
+	// TraceNomination is nomination of candidate pair.
+	TraceNomination
+	// TraceTimeout is connectivity check that failed without response,
+	// after maximum attempts or on write error.
+	TraceTimeout
+)
+
+var traceEventTypeToStr = map[TraceEventType]string{
+	TraceGatherStart:  "gather start",
+	TraceGatherFinish: "gather finish",
+	TraceCheckSent:    "check sent",
+	TraceRetransmit:   "retransmit",
+	TraceResponse:     "response",
+	TracePairState:    "pair state",
+	TraceNomination:   "nomination",
+	TraceTimeout:      "timeout",
+}
+
+func (t TraceEventType) String() string {
+	if s, ok := traceEventTypeToStr[t]; ok {
+		return s
+	}
+	return "unknown"
+}
+
+// TraceEvent is typed agent event. Fields that are not relevant for event
+// type are zero.
+type TraceEvent struct {
+	Type   TraceEventType
+	Time   time.Time
+	Stream int
+
+	// Candidate pair of check, state change or nomination.
+	Local  Addr
+	Remote Addr
+
+	Transaction [stun.TransactionIDSize]byte // binding request of check
+	Attempt     int                          // attempt of binding request
+	Nominate    bool                         // check nominates pair
+	RTT         time.Duration                // since first attempt, for response
+	State       PairState                    // new pair state
+	Candidates  int                          // gathered candidates
+	Err         error                        // failed gathering or check
+}
+
+// Tracer receives typed agent events, so agent can be connected to external
+// tracing system.
+//
+// Tracer is called synchronously, possibly with agent lock held, so it
+// should not block or call agent methods.
+type Tracer interface {
+	// Trace is called on agent event that is not part of connectivity
+	// check.
+	Trace(e TraceEvent)
+	// StartCheck is called when connectivity check is sent, returning
+	// span of the check.
+	StartCheck(e TraceEvent) CheckSpan
+}
+
+// CheckSpan traces single connectivity check from sending binding request
+// until response or timeout.
+type CheckSpan interface {
+	// Trace is called on check event, like retransmission.
+	Trace(e TraceEvent)
+	// Finish is called with response or timeout event, ending the span.
+	Finish(e TraceEvent)
+}
+
+// zapTracer logs events with zap.
+type zapTracer struct {
+	log *zap.Logger
+}
+
+// NewZapTracer returns Tracer that logs events to l on debug level.
+func NewZapTracer(l *zap.Logger) Tracer {
+	return zapTracer{log: l}
+}
+
+func traceFields(e TraceEvent) []zap.Field {
+	fields := []zap.Field{
+		zap.Time("time", e.Time),
+		zap.Int("stream", e.Stream),
+	}
+	switch e.Type {
+	case TraceGatherStart:
+		return fields
+	case TraceGatherFinish:
+		fields = append(fields, zap.Int("candidates", e.Candidates))
+	case TracePairState:
+		fields = append(fields, zap.Stringer("state", e.State))
+	case TraceCheckSent, TraceRetransmit:
+		fields = append(fields, zap.Int("attempt", e.Attempt), zap.Bool("nominate", e.Nominate))
+	case TraceResponse:
+		fields = append(fields, zap.Duration("rtt", e.RTT))
+	}
+	if e.Type != TraceGatherFinish {
+		fields = append(fields,
+			zap.Stringer("local", e.Local),
+			zap.Stringer("remote", e.Remote),
+		)
+	}
+	if e.Transaction != [stun.TransactionIDSize]byte{} {
+		fields = append(fields, zap.String("transaction", fmt.Sprintf("%x", e.Transaction)))
+	}
+	if e.Err != nil {
+		fields = append(fields, zap.Error(e.Err))
+	}
+	return fields
+}
+
+func (t zapTracer) Trace(e TraceEvent) {
+	t.log.Debug(e.Type.String(), traceFields(e)...)
+}
+
+func (t zapTracer) StartCheck(e TraceEvent) CheckSpan {
+	t.Trace(e)
+	return t
+}
+
+func (t zapTracer) Finish(e TraceEvent) {
+	t.Trace(e)
+}
+
+// TraceRecorder is Tracer that records events in memory, e.g. for tests.
+type TraceRecorder struct {
+	mux    sync.Mutex
+	events []TraceEvent
+	checks []*RecordedCheck
+}
+
+// RecordedCheck is connectivity check span recorded by TraceRecorder.
+type RecordedCheck struct {
+	Events   []TraceEvent // starting from check sent event
+	Finished bool
+}
+
+type recordedSpan struct {
+	r     *TraceRecorder
+	check *RecordedCheck
+}
+
+func (s recordedSpan) Trace(e TraceEvent) {
+	s.r.mux.Lock()
+	s.check.Events = append(s.check.Events, e)
+	s.r.events = append(s.r.events, e)
+	s.r.mux.Unlock()
+}
+
+func (s recordedSpan) Finish(e TraceEvent) {
+	s.r.mux.Lock()
+	s.check.Events = append(s.check.Events, e)
+	s.check.Finished = true
+	s.r.events = append(s.r.events, e)
+	s.r.mux.Unlock()
+}
+
+// Trace implements Tracer.
+func (r *TraceRecorder) Trace(e TraceEvent) {
+	r.mux.Lock()
+	r.events = append(r.events, e)
+	r.mux.Unlock()
+}
+
+// StartCheck implements Tracer.
+func (r *TraceRecorder) StartCheck(e TraceEvent) CheckSpan {
+	c := &RecordedCheck{Events: []TraceEvent{e}}
+	r.mux.Lock()
+	r.events = append(r.events, e)
+	r.checks = append(r.checks, c)
+	r.mux.Unlock()
+	return recordedSpan{r: r, check: c}
+}
+
+// Events returns all recorded events in order.
+func (r *TraceRecorder) Events() []TraceEvent {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]TraceEvent{}, r.events...)
+}
+
+// Checks returns recorded connectivity checks in order of start.
+func (r *TraceRecorder) Checks() []RecordedCheck {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	checks := make([]RecordedCheck, 0, len(r.checks))
+	for _, c := range r.checks {
+		checks = append(checks, RecordedCheck{
+			Events:   append([]TraceEvent{}, c.Events...),
+			Finished: c.Finished,
+		})
+	}
+	return checks
+}
+
+// trace passes event to agent tracer.
+func (a *Agent) trace(e TraceEvent) {
+	if a.tracer == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = a.clock()
+	}
+	a.tracer.Trace(e)
+}
+
+// tracePair passes event for candidate pair of checklist to agent tracer.
+func (a *Agent) tracePair(t TraceEventType, checklist int, p *Pair) {
+	if a.tracer == nil {
+		return
+	}
+	a.trace(TraceEvent{
+		Type:   t,
+		Stream: checklist,
+		Local:  p.Local.Addr,
+		Remote: p.Remote.Addr,
+		State:  p.State,
+	})
+}
+
+// startCheckSpan starts span of connectivity check for transaction.
+func (a *Agent) startCheckSpan(t *agentTransaction, p *Pair) {
+	if a.tracer == nil {
+		return
+	}
+	t.span = a.tracer.StartCheck(TraceEvent{
+		Type:        TraceCheckSent,
+		Time:        t.start,
+		Stream:      t.checklist,
+		Local:       p.Local.Addr,
+		Remote:      p.Remote.Addr,
+		Transaction: t.id,
+		Attempt:     t.attempt,
+		Nominate:    t.nominate,
+	})
+}
+
+// traceCheck passes event of connectivity check to its span.
+func (t *agentTransaction) traceCheck(typ TraceEventType, now time.Time, err error) {
+	if t.span == nil {
+		return
+	}
+	e := t.checkEvent(typ, now)
+	e.Err = err
+	if typ == TraceRetransmit {
+		t.span.Trace(e)
+		return
+	}
+	if typ == TraceResponse && err == nil {
+		e.RTT = now.Sub(t.start)
+	}
+	t.span.Finish(e)
+}
+
+// checkEvent returns event of connectivity check for transaction.
+func (t *agentTransaction) checkEvent(typ TraceEventType, now time.Time) TraceEvent {
+	local, remote := t.pair.LocalIP, t.pair.RemoteIP
+	return TraceEvent{
+		Type:        typ,
+		Time:        now,
+		Stream:      t.checklist,
+		Local:       Addr{IP: net.IP(local[:]), Port: t.pair.LocalPort, Proto: ct.UDP},
+		Remote:      Addr{IP: net.IP(remote[:]), Port: t.pair.RemotePort, Proto: ct.UDP},
+		Transaction: t.id,
+		Attempt:     t.attempt,
+		Nominate:    t.nominate,
+	}
+}
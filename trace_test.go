@@ -0,0 +1,218 @@
+package ice
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"gortc.io/ice/candidate"
+	"gortc.io/stun"
+)
+
+func TestTraceEventType_String(t *testing.T) {
+	for v, s := range traceEventTypeToStr {
+		if v.String() != s {
+			t.Errorf("%d: %s != %s", v, v, s)
+		}
+	}
+	if TraceEventType(255).String() != "unknown" {
+		t.Error("unexpected string for unknown type")
+	}
+}
+
+func TestZapTracer(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	tracer := NewZapTracer(zap.New(core))
+	span := tracer.StartCheck(TraceEvent{Type: TraceCheckSent, Attempt: 1})
+	span.Trace(TraceEvent{Type: TraceRetransmit, Attempt: 2})
+	span.Finish(TraceEvent{Type: TraceTimeout, Err: errors.New("failed")})
+	tracer.Trace(TraceEvent{Type: TraceGatherFinish, Candidates: 2})
+	entries := logs.AllUntimed()
+	for i, msg := range []string{"check sent", "retransmit", "timeout", "gather finish"} {
+		if entries[i].Message != msg {
+			t.Errorf("%d: %q != %q", i, entries[i].Message, msg)
+		}
+	}
+	if _, ok := entries[2].ContextMap()["error"]; !ok {
+		t.Error("error should be logged")
+	}
+	if entries[3].ContextMap()["candidates"] != int64(2) {
+		t.Error("candidates should be logged")
+	}
+}
+
+func TestAgent_Trace(t *testing.T) {
+	t.Run("Timeout", func(t *testing.T) {
+		r := new(TraceRecorder)
+		a, err := NewAgent(WithTracer(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.checklist = 0
+		a.set = ChecklistSet{{Pairs: Pairs{{State: PairInProgress}}}}
+		at := &agentTransaction{
+			id:          stun.NewTransactionID(),
+			rto:         time.Millisecond * 100,
+			start:       time.Now(),
+			attempt:     1,
+			maxAttempts: 1,
+			pair:        getPairKey(&a.set[0].Pairs[0]),
+		}
+		at.setDeadline(at.start)
+		a.startCheckSpan(at, &a.set[0].Pairs[0])
+		a.t[at.id] = at
+		a.collect(at.deadline)
+		checks := r.Checks()
+		if len(checks) != 1 {
+			t.Fatalf("unexpected checks: %d", len(checks))
+		}
+		if !checks[0].Finished {
+			t.Error("check should be finished")
+		}
+		var types []TraceEventType
+		for _, e := range checks[0].Events {
+			types = append(types, e.Type)
+			if e.Transaction != at.id {
+				t.Errorf("%s: unexpected transaction", e.Type)
+			}
+		}
+		if len(types) != 2 || types[0] != TraceCheckSent || types[1] != TraceTimeout {
+			t.Errorf("unexpected check events: %v", types)
+		}
+		events := r.Events()
+		last := events[len(events)-1]
+		if last.Type != TracePairState || last.State != PairFailed {
+			t.Errorf("unexpected last event: %+v", last)
+		}
+	})
+	t.Run("Unfreeze", func(t *testing.T) {
+		r := new(TraceRecorder)
+		a, err := NewAgent(WithTracer(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.set = ChecklistSet{{Pairs: Pairs{
+			{Foundation: []byte{1}},
+			{Foundation: []byte{1}},
+		}}}
+		a.unfreeze(0)
+		events := r.Events()
+		if len(events) != 1 || events[0].Type != TracePairState || events[0].State != PairWaiting {
+			t.Errorf("unexpected events: %+v", events)
+		}
+	})
+	t.Run("FailPairs", func(t *testing.T) {
+		r := new(TraceRecorder)
+		a, err := NewAgent(WithTracer(r))
+		if err != nil {
+			t.Fatal(err)
+		}
+		local := Addr{IP: net.IPv4(10, 0, 0, 1), Port: 1000, Proto: candidate.UDP}
+		pair := Pair{State: PairWaiting}
+		pair.Local.Addr = local
+		a.set = ChecklistSet{{Pairs: Pairs{pair}}}
+		a.failPairs(0, []Addr{local})
+		a.failPairs(0, []Addr{local})
+		events := r.Events()
+		if len(events) != 1 || events[0].Type != TracePairState || events[0].State != PairFailed {
+			t.Errorf("unexpected events: %+v", events)
+		}
+		if !events[0].Local.Equal(local) {
+			t.Errorf("unexpected local address %s", events[0].Local)
+		}
+	})
+	t.Run("Session", func(t *testing.T) {
+		tracers := []*TraceRecorder{new(TraceRecorder), new(TraceRecorder)}
+		concludeSession(t, []AgentOption{WithTracer(tracers[0])}, []AgentOption{WithTracer(tracers[1])})
+		for i, r := range tracers {
+			count := make(map[TraceEventType]int)
+			for _, e := range r.Events() {
+				count[e.Type]++
+			}
+			for _, typ := range []TraceEventType{
+				TraceGatherStart, TraceGatherFinish, TraceCheckSent,
+				TraceResponse, TracePairState,
+			} {
+				if count[typ] == 0 {
+					t.Errorf("agent %d: no %s event", i, typ)
+				}
+			}
+			responded := false
+			for _, c := range r.Checks() {
+				last := c.Events[len(c.Events)-1]
+				if c.Finished && last.Type == TraceResponse && last.Err == nil {
+					responded = true
+				}
+			}
+			if !responded {
+				t.Errorf("agent %d: no check with response", i)
+			}
+		}
+	})
+}
+
+// concludeSession concludes controlling and controlled agents that are
+// connected with pipe and configured with provided options, returning
+// closed agents.
+func concludeSession(t *testing.T, controlling, controlled []AgentOption) []*Agent {
+	t.Helper()
+	lAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+	rAddr := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 2000}
+	connL, connR := packetPipe(lAddr, rAddr)
+	var agents []*Agent
+	for i, conn := range []net.PacketConn{connL, connR} {
+		addr, opts := lAddr, append([]AgentOption{WithRole(Controlling)}, controlling...)
+		if i > 0 {
+			addr, opts = rAddr, append([]AgentOption{WithRole(Controlled)}, controlled...)
+		}
+		conn := conn
+		a, err := NewAgent(append(opts, withGatherer(&mockGatherer{
+			udp: func(opt gathererOptions) ([]*localUDPCandidate, error) {
+				c := Addr{IP: addr.IP, Port: addr.Port, Proto: candidate.UDP}
+				return []*localUDPCandidate{{
+					candidate: Candidate{Base: c, Addr: c, Type: candidate.Host, ComponentID: 1},
+					conn:      conn,
+				}}, nil
+			},
+		}))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer mustClose(t, a)
+		if err = a.GatherCandidates(); err != nil {
+			t.Fatal(err)
+		}
+		agents = append(agents, a)
+	}
+	for i, a := range agents {
+		remote, err := agents[1-i].LocalCandidates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = a.AddRemoteCandidates(remote); err != nil {
+			t.Fatal(err)
+		}
+		if err = a.PrepareChecklistSet(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- agents[1].Conclude(ctx)
+	}()
+	if err := agents[0].Conclude(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	return agents
+}
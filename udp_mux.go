@@ -0,0 +1,456 @@
+package ice
+
+import (
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	ct "gortc.io/ice/candidate"
+	"gortc.io/ice/gather"
+	"gortc.io/stun"
+)
+
+// UDPMux is set of UDP sockets, one per host address, that is shared by
+// host candidates of many agents, so all of them use single port.
+//
+// Incoming packets are routed to agents as follows:
+//   - STUN requests by local ufrag from USERNAME attribute,
+//   - STUN responses by transaction ID of request that was sent by agent,
+//   - other packets by remote address of nominated pair.
+//
+// Use WithUDPMux to plug UDPMux into Agent. Local credentials should be set
+// before gathering, and only single data stream is supported per ufrag.
+type UDPMux struct {
+	log     *zap.Logger
+	sockets []*udpMuxSocket
+}
+
+// udpMuxSocket is single shared socket of UDPMux.
+type udpMuxSocket struct {
+	log  *zap.Logger
+	conn net.PacketConn
+	addr *net.UDPAddr
+	host gather.Addr // with interface metadata, if known
+	now  func() time.Time
+
+	mux          sync.Mutex
+	ufrags       map[string]*udpMuxConn           // by local ufrag
+	transactions map[transactionID]muxTransaction // requests in progress
+	expiry       []muxExpiry                      // transactions by deadline
+	nominated    map[string]*udpMuxConn           // by remote address
+}
+
+// muxTransaction is request sent via UDPMux socket, response to which is
+// routed to conn until deadline.
+type muxTransaction struct {
+	conn     *udpMuxConn
+	deadline time.Time
+}
+
+// muxExpiry is deadline of transaction. Transactions have same timeout, so
+// appending expiries in order of requests keeps them ordered by deadline.
+type muxExpiry struct {
+	id       transactionID
+	deadline time.Time
+}
+
+const (
+	udpMuxQueueSize = 128
+	// udpMuxTransactionTimeout exceeds STUN transaction timeout with default
+	// RTO and retransmissions, which is 39.5s as per RFC 5389 Section 7.2.1.
+	udpMuxTransactionTimeout = time.Second * 40
+)
+
+var (
+	errMuxUfragExist      = errors.New("ufrag is already registered on UDPMux")
+	errMuxNoUfrag         = errors.New("local ufrag should be set before gathering on UDPMux")
+	errMuxComponents      = errors.New("UDPMux supports single component only")
+	errMuxDeadline        = errors.New("deadlines are not supported by UDPMux")
+	errMuxUnspecifiedAddr = errors.New("UDPMux socket should be bound to specific IP")
+)
+
+// NewUDPMux returns UDPMux that serves provided sockets, which should be
+// bound to specific IP addresses. Sockets are closed by Close.
+func NewUDPMux(log *zap.Logger, conns ...net.PacketConn) (*UDPMux, error) {
+	if log == nil {
+		log = zap.NewNop()
+	}
+	m := &UDPMux{log: log}
+	for _, conn := range conns {
+		addr, ok := conn.LocalAddr().(*net.UDPAddr)
+		if !ok || addr.IP.IsUnspecified() {
+			return nil, errMuxUnspecifiedAddr
+		}
+	}
+	for _, conn := range conns {
+		addr := conn.LocalAddr().(*net.UDPAddr)
+		s := &udpMuxSocket{
+			log:  log.With(zap.Stringer("addr", addr)),
+			conn: conn,
+			addr: addr,
+			host: gather.Addr{
+				IP:         addr.IP,
+				Zone:       addr.Zone,
+				Precedence: gather.Precedence(addr.IP),
+			},
+			now:          time.Now,
+			ufrags:       make(map[string]*udpMuxConn),
+			transactions: make(map[transactionID]muxTransaction),
+			nominated:    make(map[string]*udpMuxConn),
+		}
+		m.sockets = append(m.sockets, s)
+		go s.readUntilClose()
+	}
+	return m, nil
+}
+
+// ListenUDPMux binds UDP socket on provided port for each host address and
+// returns UDPMux that serves them.
+func ListenUDPMux(port int, log *zap.Logger) (*UDPMux, error) {
+	addrs, err := gather.DefaultGatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	hostAddrs, err := HostAddresses(addrs)
+	if err != nil {
+		return nil, err
+	}
+	var conns []net.PacketConn
+	for _, h := range hostAddrs {
+		addr := net.UDPAddr{IP: h.IP, Port: port}
+		conn, listenErr := net.ListenPacket("udp", addr.String())
+		if listenErr != nil {
+			for _, c := range conns {
+				_ = c.Close()
+			}
+			return nil, listenErr
+		}
+		conns = append(conns, conn)
+	}
+	m, err := NewUDPMux(log, conns...)
+	if err != nil {
+		return nil, err
+	}
+	// Keeping interface metadata for address filter and network cost.
+	for _, s := range m.sockets {
+		for _, a := range addrs {
+			if a.IP.Equal(s.host.IP) {
+				s.host = a
+			}
+		}
+	}
+	return m, nil
+}
+
+// Close closes all sockets of UDPMux.
+func (m *UDPMux) Close() error {
+	var err error
+	for _, s := range m.sockets {
+		if closeErr := s.conn.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// socketAddrs returns host addresses of sockets that can be used with
+// provided options, ordered by precedence.
+func (m *UDPMux) socketAddrs(opt gathererOptions) []gather.Addr {
+	addrs := make([]gather.Addr, 0, len(m.sockets))
+	for _, s := range m.sockets {
+		ip := s.host.IP
+		if opt.IPv4Only && ip.To4() == nil {
+			continue
+		}
+		if ip.To4() == nil && ip.IsLinkLocalUnicast() && !opt.LinkLocal {
+			continue
+		}
+		addrs = append(addrs, s.host)
+	}
+	addrs, filtered := opt.Filter.Filter(addrs)
+	if opt.Filtered != nil {
+		for _, f := range filtered {
+			opt.Filtered(f)
+		}
+	}
+	if opt.Policy != nil {
+		for i := range addrs {
+			addrs[i].Precedence = opt.Policy.Precedence(addrs[i].IP)
+		}
+	}
+	sort.Stable(gather.Addrs(addrs))
+	return addrs
+}
+
+// socket returns socket bound to provided host address that is not used, or
+// nil if there is no such socket.
+func (m *UDPMux) socket(h HostAddr, used map[*udpMuxSocket]bool) *udpMuxSocket {
+	for _, s := range m.sockets {
+		if used[s] || !s.host.IP.Equal(h.IP) || s.host.Zone != h.Zone {
+			continue
+		}
+		used[s] = true
+		return s
+	}
+	return nil
+}
+
+// gatherUDP implements candidateGatherer, returning host candidate on each
+// socket that accepts packets for opt.Username. Sockets are selected by
+// address filter, link-local and IPv4-only options, and local preferences
+// are computed like for gathered host addresses. Port options are ignored.
+func (m *UDPMux) gatherUDP(opt gathererOptions) ([]*localUDPCandidate, error) {
+	if opt.Components != 1 {
+		return nil, errMuxComponents
+	}
+	if opt.Username == "" {
+		return nil, errMuxNoUfrag
+	}
+	var (
+		candidates []*localUDPCandidate
+		used       = make(map[*udpMuxSocket]bool)
+	)
+	for _, h := range addrPreferences(m.socketAddrs(opt)) {
+		s := m.socket(h, used)
+		if s == nil {
+			continue
+		}
+		conn, err := s.register(opt.Username)
+		if err != nil {
+			for _, c := range candidates {
+				_ = c.Close()
+			}
+			return nil, err
+		}
+		addr := Addr{
+			IP:    s.addr.IP,
+			Zone:  s.addr.Zone,
+			Port:  s.addr.Port,
+			Proto: ct.UDP,
+		}
+		c := Candidate{
+			Base:            addr,
+			Addr:            addr,
+			Type:            ct.Host,
+			ComponentID:     1,
+			LocalPreference: h.LocalPreference,
+			NetworkCost:     h.NetworkCost,
+		}
+		c.Foundation = Foundation(&c, Addr{})
+		c.Priority = Priority(TypePreference(c.Type), c.LocalPreference, c.ComponentID)
+		candidates = append(candidates, &localUDPCandidate{
+			candidate: c,
+			conn:      conn,
+		})
+	}
+	return candidates, nil
+}
+
+func (s *udpMuxSocket) register(ufrag string) (*udpMuxConn, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.ufrags[ufrag]; ok {
+		return nil, errMuxUfragExist
+	}
+	c := &udpMuxConn{
+		socket:  s,
+		ufrag:   ufrag,
+		packets: make(chan muxPacket, udpMuxQueueSize),
+		closed:  make(chan struct{}),
+	}
+	s.ufrags[ufrag] = c
+	return c, nil
+}
+
+func (s *udpMuxSocket) unregister(c *udpMuxConn) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.ufrags[c.ufrag] == c {
+		delete(s.ufrags, c.ufrag)
+	}
+	for id, t := range s.transactions {
+		if t.conn == c {
+			delete(s.transactions, id)
+		}
+	}
+	for addr, n := range s.nominated {
+		if n == c {
+			delete(s.nominated, addr)
+		}
+	}
+}
+
+// route returns connection for packet from addr.
+func (s *udpMuxSocket) route(buf []byte, addr net.Addr) (*udpMuxConn, bool) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !stun.IsMessage(buf) {
+		c, ok := s.nominated[addr.String()]
+		return c, ok
+	}
+	m := &stun.Message{Raw: buf}
+	if err := m.Decode(); err != nil {
+		s.log.Debug("failed to decode STUN message", zap.Error(err))
+		return nil, false
+	}
+	switch m.Type.Class {
+	case stun.ClassRequest, stun.ClassIndication:
+		var username stun.Username
+		if err := username.GetFrom(m); err != nil {
+			return nil, false
+		}
+		// The USERNAME is "local:remote" for the receiving agent.
+		ufrag := strings.SplitN(username.String(), ":", 2)[0]
+		c, ok := s.ufrags[ufrag]
+		return c, ok
+	default:
+		id := transactionID(m.TransactionID)
+		t, ok := s.transactions[id]
+		delete(s.transactions, id)
+		if !ok || s.now().After(t.deadline) {
+			return nil, false
+		}
+		return t.conn, true
+	}
+}
+
+// addTransaction starts routing responses to request with provided id to c,
+// removing expired transactions, e.g. timed out ones.
+func (s *udpMuxSocket) addTransaction(id transactionID, c *udpMuxConn) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	now := s.now()
+	s.expire(now)
+	deadline := now.Add(udpMuxTransactionTimeout)
+	s.transactions[id] = muxTransaction{
+		conn:     c,
+		deadline: deadline,
+	}
+	s.expiry = append(s.expiry, muxExpiry{id: id, deadline: deadline})
+}
+
+// expire removes transactions with deadline before now, visiting only
+// expired ones. Should be called with s.mux held.
+func (s *udpMuxSocket) expire(now time.Time) {
+	i := 0
+	for ; i < len(s.expiry) && now.After(s.expiry[i].deadline); i++ {
+		// Transaction can be already removed by response or re-added with
+		// same id and later deadline.
+		id := s.expiry[i].id
+		if t, ok := s.transactions[id]; ok && now.After(t.deadline) {
+			delete(s.transactions, id)
+		}
+	}
+	// Backing array is reallocated by append when capacity is exhausted,
+	// dropping expired entries.
+	s.expiry = s.expiry[i:]
+}
+
+func (s *udpMuxSocket) readUntilClose() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if err != nil {
+			s.log.Debug("read failed", zap.Error(err))
+			break
+		}
+		c, ok := s.route(buf[:n], addr)
+		if !ok {
+			s.log.Debug("no route for packet", zap.Stringer("from", addr))
+			continue
+		}
+		p := muxPacket{addr: addr, buf: make([]byte, n)}
+		copy(p.buf, buf[:n])
+		select {
+		case c.packets <- p:
+		case <-c.closed:
+		default:
+			s.log.Debug("queue is full, dropping packet", zap.String("ufrag", c.ufrag))
+		}
+	}
+}
+
+type muxPacket struct {
+	addr net.Addr
+	buf  []byte
+}
+
+// udpMuxConn is net.PacketConn of host candidate on UDPMux socket.
+type udpMuxConn struct {
+	socket    *udpMuxSocket
+	ufrag     string
+	packets   chan muxPacket
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// ReadFrom returns next packet that was routed to c.
+func (c *udpMuxConn) ReadFrom(p []byte) (n int, addr net.Addr, err error) {
+	select {
+	case packet := <-c.packets:
+		return copy(p, packet.buf), packet.addr, nil
+	case <-c.closed:
+		return 0, nil, errClosedConn
+	}
+}
+
+// WriteTo writes packet via shared socket, remembering transaction ID of
+// STUN request to route response back to c.
+func (c *udpMuxConn) WriteTo(p []byte, addr net.Addr) (n int, err error) {
+	select {
+	case <-c.closed:
+		return 0, errClosedConn
+	default:
+	}
+	if stun.IsMessage(p) {
+		m := &stun.Message{Raw: append([]byte{}, p...)}
+		if m.Decode() == nil && m.Type.Class == stun.ClassRequest {
+			c.socket.addTransaction(transactionID(m.TransactionID), c)
+		}
+	}
+	return c.socket.conn.WriteTo(p, addr)
+}
+
+// nominate starts routing non-STUN packets from addr to c.
+func (c *udpMuxConn) nominate(addr net.Addr) {
+	c.socket.mux.Lock()
+	c.socket.nominated[addr.String()] = c
+	c.socket.mux.Unlock()
+}
+
+// Close unregisters c from socket, leaving socket open.
+func (c *udpMuxConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.socket.unregister(c)
+		close(c.closed)
+	})
+	return nil
+}
+
+func (c *udpMuxConn) LocalAddr() net.Addr { return c.socket.addr }
+
+func (c *udpMuxConn) SetDeadline(t time.Time) error { return errMuxDeadline }
+
+func (c *udpMuxConn) SetReadDeadline(t time.Time) error { return errMuxDeadline }
+
+func (c *udpMuxConn) SetWriteDeadline(t time.Time) error { return errMuxDeadline }
+
+var errClosedConn = errors.New("use of closed connection")
+
+// addrNominator is implemented by candidate connections that route traffic
+// by remote address of nominated pair, like UDPMux ones.
+type addrNominator interface {
+	nominate(addr net.Addr)
+}
+
+// nominate notifies candidate connection about nominated pair remote address.
+func (c *localUDPCandidate) nominate(raddr Addr) {
+	if n, ok := c.conn.(addrNominator); ok {
+		n.nominate(&net.UDPAddr{IP: raddr.IP, Port: raddr.Port, Zone: raddr.Zone})
+	}
+}
@@ -0,0 +1,290 @@
+package ice
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"gortc.io/ice/gather"
+	"gortc.io/ice/internal"
+	"gortc.io/stun"
+)
+
+func listenLoopback(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func muxConn(t *testing.T, m *UDPMux, ufrag string) *udpMuxConn {
+	t.Helper()
+	candidates, err := m.gatherUDP(gathererOptions{Components: 1, Username: ufrag})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 {
+		t.Fatalf("unexpected candidates count %d", len(candidates))
+	}
+	return candidates[0].conn.(*udpMuxConn)
+}
+
+func readTimeout(c *udpMuxConn, timeout time.Duration) ([]byte, bool) {
+	select {
+	case p := <-c.packets:
+		return p.buf, true
+	case <-time.After(timeout):
+		return nil, false
+	}
+}
+
+func TestUDPMux(t *testing.T) {
+	m, err := NewUDPMux(nil, listenLoopback(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if closeErr := m.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+	}()
+	muxAddr := m.sockets[0].addr
+	a, b := muxConn(t, m, "A"), muxConn(t, m, "B")
+	if _, err = m.gatherUDP(gathererOptions{Components: 1, Username: "A"}); err != errMuxUfragExist {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err = m.gatherUDP(gathererOptions{Components: 1}); err != errMuxNoUfrag {
+		t.Errorf("unexpected error %v", err)
+	}
+	client := listenLoopback(t)
+	defer mustClose(t, client)
+	t.Run("Request", func(t *testing.T) {
+		req := stun.MustBuild(stun.TransactionID, stun.BindingRequest, stun.NewUsername("B:client"))
+		if _, err := client.WriteTo(req.Raw, muxAddr); err != nil {
+			t.Fatal(err)
+		}
+		buf, ok := readTimeout(b, time.Second)
+		if !ok {
+			t.Fatal("request is not routed")
+		}
+		if !bytes.Equal(buf, req.Raw) {
+			t.Error("unexpected packet")
+		}
+	})
+	t.Run("Response", func(t *testing.T) {
+		req := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+		if _, err := a.WriteTo(req.Raw, client.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 1024)
+		if _, _, err := client.ReadFrom(buf); err != nil {
+			t.Fatal(err)
+		}
+		res := stun.MustBuild(stun.NewTransactionIDSetter(req.TransactionID), stun.BindingSuccess)
+		if _, err := client.WriteTo(res.Raw, muxAddr); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := readTimeout(a, time.Second); !ok {
+			t.Fatal("response is not routed")
+		}
+	})
+	t.Run("Data", func(t *testing.T) {
+		data := []byte{128, 1, 2, 3} // RTP
+		if _, err := client.WriteTo(data, muxAddr); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := readTimeout(a, time.Millisecond*100); ok {
+			t.Fatal("data should not be routed before nomination")
+		}
+		a.nominate(client.LocalAddr())
+		if _, err := client.WriteTo(data, muxAddr); err != nil {
+			t.Fatal(err)
+		}
+		buf, ok := readTimeout(a, time.Second)
+		if !ok {
+			t.Fatal("data is not routed")
+		}
+		if !bytes.Equal(buf, data) {
+			t.Error("unexpected packet")
+		}
+	})
+	t.Run("LargeData", func(t *testing.T) {
+		data := make([]byte, 1400) // video RTP or DTLS flight
+		copy(data, []byte{128, 1, 2, 3})
+		a.nominate(client.LocalAddr())
+		if _, err := client.WriteTo(data, muxAddr); err != nil {
+			t.Fatal(err)
+		}
+		buf, ok := readTimeout(a, time.Second)
+		if !ok {
+			t.Fatal("data is not routed")
+		}
+		if !bytes.Equal(buf, data) {
+			t.Errorf("unexpected packet of %d bytes", len(buf))
+		}
+	})
+	t.Run("Expire", func(t *testing.T) {
+		s := m.sockets[0]
+		now := time.Now()
+		s.now = func() time.Time { return now }
+		defer func() { s.now = time.Now }()
+		timedOut := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+		if _, err := a.WriteTo(timedOut.Raw, client.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(udpMuxTransactionTimeout + time.Second)
+		res := stun.MustBuild(stun.NewTransactionIDSetter(timedOut.TransactionID), stun.BindingSuccess)
+		if _, ok := s.route(res.Raw, client.LocalAddr()); ok {
+			t.Error("response to expired request should not be routed")
+		}
+		// Expired transactions are removed on next request.
+		if _, err := a.WriteTo(timedOut.Raw, client.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+		now = now.Add(udpMuxTransactionTimeout + time.Second)
+		next := stun.MustBuild(stun.TransactionID, stun.BindingRequest)
+		if _, err := a.WriteTo(next.Raw, client.LocalAddr()); err != nil {
+			t.Fatal(err)
+		}
+		s.mux.Lock()
+		count, expiry := len(s.transactions), len(s.expiry)
+		s.mux.Unlock()
+		if count != 1 || expiry != 1 {
+			t.Errorf("unexpected transactions count %d, expiry count %d", count, expiry)
+		}
+		buf := make([]byte, 1024)
+		for i := 0; i < 3; i++ {
+			if _, _, err := client.ReadFrom(buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+	t.Run("Close", func(t *testing.T) {
+		mustClose(t, a)
+		if _, err := a.WriteTo([]byte{1}, client.LocalAddr()); err != errClosedConn {
+			t.Errorf("unexpected error %v", err)
+		}
+		if _, _, err := a.ReadFrom(make([]byte, 10)); err != errClosedConn {
+			t.Errorf("unexpected error %v", err)
+		}
+		if len(m.sockets[0].nominated) != 0 {
+			t.Error("nominated address should be removed")
+		}
+		// Ufrag can be reused.
+		mustClose(t, muxConn(t, m, "A"))
+	})
+}
+
+func TestUDPMux_gatherOptions(t *testing.T) {
+	first := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 1000}
+	second := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 1000}
+	remote := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 3), Port: 1000}
+	firstConn, _ := packetPipe(first, remote)
+	secondConn, _ := packetPipe(second, remote)
+	m, err := NewUDPMux(nil, firstConn, secondConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if closeErr := m.Close(); closeErr != nil {
+			t.Error(closeErr)
+		}
+	}()
+	t.Run("Filter", func(t *testing.T) {
+		var filtered []FilteredAddr
+		candidates, err := m.gatherUDP(gathererOptions{
+			Components: 1,
+			Username:   "A",
+			Filter:     &AddrFilter{ExcludeNetworks: []*net.IPNet{internal.MustParseNet("10.0.0.2/32")}},
+			Filtered:   func(f FilteredAddr) { filtered = append(filtered, f) },
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) != 1 || !candidates[0].candidate.Addr.IP.Equal(first.IP) {
+			t.Fatalf("unexpected candidates %v", candidates)
+		}
+		if candidates[0].candidate.LocalPreference != singleIPAddrPreference {
+			t.Errorf("unexpected local preference %d", candidates[0].candidate.LocalPreference)
+		}
+		if len(filtered) != 1 || !filtered[0].Addr.IP.Equal(second.IP) {
+			t.Errorf("unexpected filtered %v", filtered)
+		}
+	})
+	t.Run("Policy", func(t *testing.T) {
+		table := append(gather.PolicyTable{
+			{Prefix: internal.MustParseNet("10.0.0.2/32"), Precedence: 100, Label: 4},
+		}, gather.DefaultPolicyTable...)
+		candidates, err := m.gatherUDP(gathererOptions{Components: 1, Username: "B", Policy: table})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(candidates) != 2 || !candidates[0].candidate.Addr.IP.Equal(second.IP) {
+			t.Fatalf("unexpected candidates %v", candidates)
+		}
+		if candidates[0].candidate.Priority <= candidates[1].candidate.Priority {
+			t.Error("preferred address should have higher priority")
+		}
+	})
+}
+
+func TestAgent_UDPMux(t *testing.T) {
+	var muxes []*UDPMux
+	defer func() {
+		for _, m := range muxes {
+			if err := m.Close(); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+	newAgent := func(ufrag string, opts ...AgentOption) *Agent {
+		m, err := NewUDPMux(nil, listenLoopback(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		muxes = append(muxes, m)
+		a, err := NewAgent(append(opts, WithUDPMux(m))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.SetLocalCredentials(ufrag, ufrag+"-password")
+		if err = a.GatherCandidates(); err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	a := newAgent("A")
+	defer mustClose(t, a)
+	b := newAgent("B", WithRole(Controlled))
+	defer mustClose(t, b)
+	a.SetRemoteCredentials(b.Username(), b.Password())
+	b.SetRemoteCredentials(a.Username(), a.Password())
+	for _, agents := range [][2]*Agent{{a, b}, {b, a}} {
+		candidates, err := agents[1].LocalCandidates()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = agents[0].AddRemoteCandidates(candidates); err != nil {
+			t.Fatal(err)
+		}
+		if err = agents[0].PrepareChecklistSet(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- b.Conclude(ctx)
+	}()
+	if err := a.Conclude(ctx); err != nil {
+		t.Errorf("failed to conclude A: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("failed to conclude B: %v", err)
+	}
+}